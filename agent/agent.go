@@ -71,3 +71,13 @@ func (a *Agent) Reload() {
 	a.Start()
 	log.Println("I! agent reloaded")
 }
+
+// Metrics returns the metrics agent module, nil if it failed to initialize
+func (a *Agent) Metrics() *MetricsAgent {
+	for _, ag := range a.agents {
+		if ma, ok := ag.(*MetricsAgent); ok {
+			return ma
+		}
+	}
+	return nil
+}
@@ -22,6 +22,10 @@ func NewIbexAgent() AgentModule {
 	if coreconfig.Config.Ibex.MetaDir == "" {
 		coreconfig.Config.Ibex.MetaDir = "tasks.d"
 	}
+	if err := coreconfig.Config.Ibex.Init(); err != nil {
+		log.Println("E! ibex agent disabled:", err)
+		return nil
+	}
 
 	return &IbexAgent{}
 }
@@ -140,7 +140,7 @@ func (la *LogsAgent) Start() error {
 	la.startInner()
 	if coreconfig.GetContainerCollectAll() {
 		// collect container all
-		if coreconfig.Config.DebugMode {
+		if coreconfig.DebugMode() {
 			log.Println("Adding ContainerCollectAll source to the Logs Agent")
 		}
 		kubesource := logsconfig.NewLogSource(logsconfig.ContainerCollectAll,
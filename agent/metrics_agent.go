@@ -2,7 +2,9 @@ package agent
 
 import (
 	"errors"
+	"fmt"
 	"log"
+	"sort"
 	"strings"
 	"sync"
 
@@ -79,6 +81,7 @@ import (
 	_ "flashcat.cloud/categraf/inputs/snmp_trap"
 	_ "flashcat.cloud/categraf/inputs/sockstat"
 	_ "flashcat.cloud/categraf/inputs/sqlserver"
+	_ "flashcat.cloud/categraf/inputs/statsd"
 	_ "flashcat.cloud/categraf/inputs/switch_legacy"
 	_ "flashcat.cloud/categraf/inputs/system"
 	_ "flashcat.cloud/categraf/inputs/systemd"
@@ -157,6 +160,7 @@ func NewMetricsAgent() AgentModule {
 		return nil
 	}
 	agent.InputProviders = provider
+	inputs.SetHealthFunc(agent.health)
 	return agent
 }
 
@@ -254,6 +258,10 @@ func (ma *MetricsAgent) RegisterInput(name string, configs []cfg.ConfigWithForma
 		log.Println("E! failed to load configuration of plugin:", name, "error:", err)
 		return
 	}
+	if err = config.LinkSecrets(); err != nil {
+		log.Println("E! failed to link secrets of plugin:", name, "error:", err)
+		return
+	}
 
 	for sum, nInput := range newInputs {
 		ma.inputGo(name, sum, nInput)
@@ -294,7 +302,7 @@ func (ma *MetricsAgent) inputGo(name string, sum string, input inputs.Input) {
 		}
 
 		if empty {
-			if config.Config.DebugMode {
+			if config.DebugMode() {
 				_, inputKey := inputs.ParseInputName(name)
 				log.Printf("W! no instances for input:%s", inputKey)
 			}
@@ -333,3 +341,89 @@ func parseFilter(filterStr string) map[string]struct{} {
 	}
 	return filtermap
 }
+
+// Readers returns the running readers of an input, name is either the input
+// key, e.g. cpu, or prefixed by its provider, e.g. local.cpu. All readers are
+// returned if name is empty.
+func (ma *MetricsAgent) Readers(name string) []*InputReader {
+	var ret []*InputReader
+	ma.InputReaders.lock.RLock()
+	defer ma.InputReaders.lock.RUnlock()
+	for fullName, readers := range ma.InputReaders.record {
+		if _, inputKey := inputs.ParseInputName(fullName); name != "" && fullName != name && inputKey != name {
+			continue
+		}
+		for _, r := range readers {
+			ret = append(ret, r)
+		}
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].inputName < ret[j].inputName })
+	return ret
+}
+
+// StopInput stops all readers of an input until the next reload
+func (ma *MetricsAgent) StopInput(name string) error {
+	stopped := false
+	for _, fullName := range ma.inputNames(name) {
+		ma.DeregisterInput(fullName, "")
+		stopped = true
+	}
+	if !stopped {
+		return fmt.Errorf("input %s is not running", name)
+	}
+	return nil
+}
+
+// ReloadInput reads the configuration of an input from its provider again
+// and restarts its readers, other inputs are left running
+func (ma *MetricsAgent) ReloadInput(name string) error {
+	typ, inputKey := inputs.ParseInputName(name)
+	if !ma.FilterPass(inputKey) {
+		return fmt.Errorf("input %s is filtered out", inputKey)
+	}
+
+	reloaded := false
+	for _, provider := range ma.InputProviders {
+		if typ != "" && provider.Name() != typ {
+			continue
+		}
+		configs, err := provider.GetInputConfig(inputKey)
+		if err != nil {
+			return fmt.Errorf("failed to get configuration of input %s: %v", inputKey, err)
+		}
+		if len(configs) == 0 {
+			continue
+		}
+		fullName := inputs.FormatInputName(provider.Name(), inputKey)
+		if _, has := ma.InputReaders.GetInput(fullName); has {
+			ma.DeregisterInput(fullName, "")
+		}
+		ma.RegisterInput(fullName, configs)
+		reloaded = true
+	}
+	if !reloaded {
+		return fmt.Errorf("input %s not found in any provider", name)
+	}
+	return nil
+}
+
+func (ma *MetricsAgent) inputNames(name string) []string {
+	var ret []string
+	ma.InputReaders.lock.RLock()
+	defer ma.InputReaders.lock.RUnlock()
+	for fullName := range ma.InputReaders.record {
+		if _, inputKey := inputs.ParseInputName(fullName); fullName == name || inputKey == name {
+			ret = append(ret, fullName)
+		}
+	}
+	return ret
+}
+
+func (ma *MetricsAgent) health() []inputs.InputHealth {
+	readers := ma.Readers("")
+	ret := make([]inputs.InputHealth, 0, len(readers))
+	for _, r := range readers {
+		ret = append(ret, r.Health())
+	}
+	return ret
+}
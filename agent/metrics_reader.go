@@ -1,13 +1,19 @@
 package agent
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"log"
+	"sort"
+	"strconv"
 	"sync"
 	"sync/atomic"
 	"time"
 
 	"flashcat.cloud/categraf/config"
 	"flashcat.cloud/categraf/inputs"
+	"flashcat.cloud/categraf/pipeline"
 	"flashcat.cloud/categraf/pkg/runtimex"
 	"flashcat.cloud/categraf/types"
 	"flashcat.cloud/categraf/writer"
@@ -18,7 +24,16 @@ type InputReader struct {
 	input      inputs.Input
 	quitChan   chan struct{}
 	runCounter uint64
-	waitGroup  sync.WaitGroup
+
+	// scheduled and on-demand gathers do not overlap
+	gatherLock sync.Mutex
+
+	statsLock sync.RWMutex
+	stats     map[string]inputs.GatherStats
+	skipped   uint64
+	// start of the gathers still running, by instance
+	inflight map[string]time.Time
+	timeout  time.Duration
 }
 
 func newInputReader(inputName string, in inputs.Input) *InputReader {
@@ -26,6 +41,78 @@ func newInputReader(inputName string, in inputs.Input) *InputReader {
 		inputName: inputName,
 		input:     in,
 		quitChan:  make(chan struct{}, 1),
+		stats:     make(map[string]inputs.GatherStats),
+		inflight:  make(map[string]time.Time),
+	}
+}
+
+// setStats records the outcome of a gather, counters of stats are added to
+// the previous ones
+func (r *InputReader) setStats(stats inputs.GatherStats) {
+	r.statsLock.Lock()
+	prev := r.stats[stats.Instance]
+	stats.Panics += prev.Panics
+	stats.Timeouts += prev.Timeouts
+	stats.Skipped += prev.Skipped
+	r.stats[stats.Instance] = stats
+	r.statsLock.Unlock()
+}
+
+// beginGather marks the instance as running, false if its previous gather
+// has not returned yet
+func (r *InputReader) beginGather(name string) bool {
+	r.statsLock.Lock()
+	defer r.statsLock.Unlock()
+	if started, ok := r.inflight[name]; ok {
+		stats := r.stats[name]
+		stats.Instance = name
+		stats.Skipped++
+		r.stats[name] = stats
+		log.Printf("W! %s: instance %q still running since %s, gather skipped", r.inputName, name, started.Format(time.RFC3339))
+		return false
+	}
+	r.inflight[name] = time.Now()
+	return true
+}
+
+func (r *InputReader) endGather(name string) {
+	r.statsLock.Lock()
+	delete(r.inflight, name)
+	r.statsLock.Unlock()
+}
+
+// Stats returns the outcome of the last gather of every instance, sorted by instance
+func (r *InputReader) Stats() []inputs.GatherStats {
+	now := time.Now()
+	r.statsLock.RLock()
+	ret := make([]inputs.GatherStats, 0, len(r.stats))
+	for _, s := range r.stats {
+		if started, ok := r.inflight[s.Instance]; ok && r.timeout > 0 && now.Sub(started) > r.timeout {
+			s.Stuck = true
+		}
+		ret = append(ret, s)
+	}
+	r.statsLock.RUnlock()
+
+	sort.Slice(ret, func(i, j int) bool {
+		if len(ret[i].Instance) != len(ret[j].Instance) {
+			return len(ret[i].Instance) < len(ret[j].Instance)
+		}
+		return ret[i].Instance < ret[j].Instance
+	})
+	return ret
+}
+
+func (r *InputReader) Name() string {
+	return r.inputName
+}
+
+// Health returns the stats of all instances and the skipped runs
+func (r *InputReader) Health() inputs.InputHealth {
+	return inputs.InputHealth{
+		Name:      r.inputName,
+		Instances: r.Stats(),
+		Skipped:   atomic.LoadUint64(&r.skipped),
 	}
 }
 
@@ -39,7 +126,15 @@ func (r *InputReader) startInput() {
 	if r.input.GetInterval() > 0 {
 		interval = time.Duration(r.input.GetInterval())
 	}
-	timer := time.NewTimer(0 * time.Second)
+	sched := schedule{interval: interval}
+	sched.jitter, sched.offset, sched.round = inputs.MayGetSchedule(r.input)
+
+	tick := sched.first(time.Now())
+	fire := sched.fireAt(tick)
+	if config.DebugMode() {
+		log.Println("D!", r.inputName, ": schedule", sched, "first gather at", fire.Format(time.RFC3339Nano))
+	}
+	timer := time.NewTimer(time.Until(fire))
 	defer timer.Stop()
 	var start time.Time
 
@@ -50,74 +145,214 @@ func (r *InputReader) startInput() {
 			return
 		case <-timer.C:
 			start = time.Now()
-			if config.Config.DebugMode {
+			if config.DebugMode() {
 				log.Println("D!", r.inputName, ": before gather once")
 			}
 
 			r.gatherOnce()
 
-			if config.Config.DebugMode {
+			if config.DebugMode() {
 				log.Println("D!", r.inputName, ": after gather once,", "duration:", time.Since(start))
 			}
 
-			next := interval - time.Since(start)
-			if next < 0 {
-				next = 0
+			var skipped uint64
+			tick, skipped = sched.next(tick, time.Now())
+			if skipped > 0 {
+				atomic.AddUint64(&r.skipped, skipped)
+				log.Printf("W! %s: gather took %s, longer than interval %s, %d runs skipped", r.inputName, time.Since(start), interval, skipped)
 			}
-			timer.Reset(next)
+			fire = sched.fireAt(tick)
+			if config.DebugMode() {
+				log.Println("D!", r.inputName, ": next gather at", fire.Format(time.RFC3339Nano))
+			}
+			timer.Reset(time.Until(fire))
 		}
 	}
 }
 
 func (r *InputReader) gatherOnce() {
-	defer func() {
-		if rc := recover(); rc != nil {
-			log.Println("E!", r.inputName, ": gather metrics panic:", r, string(runtimex.Stack(3)))
-		}
-	}()
+	r.gather(true, r.forward)
+}
 
-	// plugin level, for system plugins
-	slist := types.NewSampleList()
-	inputs.MayGather(r.input, slist)
-	r.forward(r.input.Process(slist))
+// ErrGatherResets is returned for inputs whose gathers reset what they
+// collected, gathering them out of schedule would lose it
+var ErrGatherResets = errors.New("gathers of the input reset its state, it is only gathered on schedule")
 
-	instances := inputs.MayGetInstances(r.input)
-	if len(instances) == 0 {
-		return
+// Gather runs the input once out of schedule, the samples are returned
+// instead of being forwarded to writers. Processors keeping state between
+// scheduled gathers, such as processor_rate, are not run.
+func (r *InputReader) Gather() ([]*types.Sample, error) {
+	if inputs.MayGatherResets(r.input) {
+		return nil, ErrGatherResets
 	}
+	var (
+		lock sync.Mutex
+		ret  []*types.Sample
+		done bool
+	)
+	r.gather(false, func(slist *types.SampleList) {
+		if slist == nil {
+			return
+		}
+		arr := slist.PopBackAll()
+		lock.Lock()
+		if !done {
+			ret = append(ret, arr...)
+		}
+		lock.Unlock()
+	})
+	lock.Lock()
+	done = true
+	lock.Unlock()
+	return ret, nil
+}
+
+// gatherTimeout is the gather_timeout of the input, 0 if gathers have no
+// deadline
+func (r *InputReader) gatherTimeout() time.Duration {
+	return inputs.MayGetGatherTimeout(r.input)
+}
 
-	concurrency := config.GetConcurrency()
-	concurrencyLimiter := make(chan struct{}, concurrency)
+// gather collects the input and its instances once, scheduled runs honour
+// interval_times of instances. Every instance is started, at most
+// concurrency at a time, and has its own deadline of gather_timeout from its
+// start: an instance still running then is left behind and skipped by the
+// next runs until it returns.
+func (r *InputReader) gather(scheduled bool, forward func(*types.SampleList)) {
+	r.gatherLock.Lock()
+	defer r.gatherLock.Unlock()
 
-	atomic.AddUint64(&r.runCounter, 1)
+	timeout := r.gatherTimeout()
+	r.statsLock.Lock()
+	r.timeout = timeout
+	r.statsLock.Unlock()
 
-	for i := 0; i < len(instances); i++ {
-		if !instances[i].Initialized() {
-			continue
+	var wg sync.WaitGroup
+	start := func(name string, p processor, limiter chan struct{}) {
+		if !r.beginGather(name) {
+			if limiter != nil {
+				<-limiter
+			}
+			return
 		}
-		concurrencyLimiter <- struct{}{}
-		r.waitGroup.Add(1)
-		go func(ins inputs.Instance) {
+		wg.Add(1)
+		go func() {
 			defer func() {
-				r.waitGroup.Done()
-				<- concurrencyLimiter
+				wg.Done()
+				if limiter != nil {
+					<-limiter
+				}
 			}()
 
-			it := ins.GetIntervalTimes()
-			if it > 0 {
-				counter := atomic.LoadUint64(&r.runCounter)
-				if counter%uint64(it) != 0 {
-					return
-				}
+			ctx := context.Background()
+			if timeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, timeout)
+				defer cancel()
 			}
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				r.gatherInstance(ctx, name, p, scheduled, forward)
+			}()
+			select {
+			case <-done:
+			case <-ctx.Done():
+				r.markTimeout(name, timeout)
+			}
+		}()
+	}
 
-			insList := types.NewSampleList()
-			inputs.MayGather(ins, insList)
-			r.forward(ins.Process(insList))
-		}(instances[i])
+	// plugin level, for system plugins
+	if _, ok := r.input.(inputs.SampleGatherer); ok {
+		start("", r.input, nil)
 	}
 
-	r.waitGroup.Wait()
+	instances := inputs.MayGetInstances(r.input)
+	if len(instances) > 0 {
+		concurrency := config.GetConcurrency()
+		concurrencyLimiter := make(chan struct{}, concurrency)
+
+		counter := atomic.LoadUint64(&r.runCounter)
+		if scheduled {
+			counter = atomic.AddUint64(&r.runCounter, 1)
+		}
+
+		for i := 0; i < len(instances); i++ {
+			if !instances[i].Initialized() {
+				continue
+			}
+			if it := instances[i].GetIntervalTimes(); scheduled && it > 0 && counter%uint64(it) != 0 {
+				continue
+			}
+			concurrencyLimiter <- struct{}{}
+			start(strconv.Itoa(i), instances[i], concurrencyLimiter)
+		}
+	}
+
+	wg.Wait()
+}
+
+// markTimeout records a timeout for the instance if it is still running
+func (r *InputReader) markTimeout(name string, timeout time.Duration) {
+	r.statsLock.Lock()
+	begin, ok := r.inflight[name]
+	if ok {
+		stats := r.stats[name]
+		stats.Instance = name
+		stats.LastGather = begin
+		stats.Duration = time.Since(begin)
+		stats.Error = fmt.Sprintf("gather timeout after %s", timeout)
+		stats.Timeouts++
+		r.stats[name] = stats
+	}
+	r.statsLock.Unlock()
+	if ok {
+		log.Printf("E! %s: gather timeout %s reached, instance %q still running", r.inputName, timeout, name)
+	}
+}
+
+type processor interface {
+	Process(*types.SampleList) *types.SampleList
+}
+
+// gatherInstance gathers the input itself(name is empty) or one of its
+// instances, recording the outcome in the stats of the reader. Samples of
+// gathers returning after the deadline of ctx are dropped, those of gathers
+// out of schedule are processed without state.
+func (r *InputReader) gatherInstance(ctx context.Context, name string, p processor, scheduled bool, forward func(*types.SampleList)) {
+	stats := inputs.GatherStats{
+		Instance:   name,
+		LastGather: time.Now(),
+	}
+	defer func() {
+		if rc := recover(); rc != nil {
+			stats.Error = fmt.Sprint("panic: ", rc)
+			stats.Panics = 1
+			log.Println("E!", r.inputName, ": gather metrics panic:", rc, string(runtimex.Stack(3)))
+		}
+		stats.Duration = time.Since(stats.LastGather)
+		r.setStats(stats)
+		r.endGather(name)
+	}()
+
+	slist := types.NewSampleList()
+	inputs.MayGatherContext(ctx, p, slist)
+	if scheduled {
+		slist = p.Process(slist)
+	} else {
+		slist = inputs.MayProcessStateless(p, slist)
+	}
+	if slist != nil {
+		stats.Samples = slist.Len()
+	}
+	if ctx.Err() != nil {
+		stats.Error = "gather returned after the timeout, samples dropped"
+		log.Printf("W! %s: instance %q returned after %s, past the gather timeout, %d samples dropped",
+			r.inputName, name, time.Since(stats.LastGather), stats.Samples)
+		return
+	}
+	forward(slist)
 }
 
 func (r *InputReader) forward(slist *types.SampleList) {
@@ -125,5 +360,7 @@ func (r *InputReader) forward(slist *types.SampleList) {
 		return
 	}
 	arr := slist.PopBackAll()
-	writer.WriteSamples(arr)
+	_, inputKey := inputs.ParseInputName(r.inputName)
+	// guarded after processors and aggregators, which may lower cardinality
+	writer.WriteSamples(writer.GuardSamples(inputKey, pipeline.Apply(arr)))
 }
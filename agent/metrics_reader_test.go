@@ -0,0 +1,152 @@
+package agent
+
+import (
+	"testing"
+	"time"
+
+	"flashcat.cloud/categraf/config"
+	"flashcat.cloud/categraf/inputs"
+	"flashcat.cloud/categraf/types"
+)
+
+// hangInput blocks its gathers until release is closed
+type hangInput struct {
+	release chan struct{}
+}
+
+func (h *hangInput) Clone() inputs.Input                           { return h }
+func (h *hangInput) Name() string                                  { return "hang" }
+func (h *hangInput) GetLabels() map[string]string                  { return nil }
+func (h *hangInput) GetInterval() config.Duration                  { return config.Duration(time.Minute) }
+func (h *hangInput) InitInternalConfig() error                     { return nil }
+func (h *hangInput) GetGatherTimeout() time.Duration               { return 50 * time.Millisecond }
+func (h *hangInput) Process(l *types.SampleList) *types.SampleList { return l }
+
+func (h *hangInput) Gather(slist *types.SampleList) {
+	<-h.release
+	slist.PushSample("hang", "up", 1)
+}
+
+func TestGatherTimeoutAndOverrun(t *testing.T) {
+	config.Config = &config.ConfigType{}
+	in := &hangInput{release: make(chan struct{})}
+	r := newInputReader("local.hang", in)
+
+	begin := time.Now()
+	if ss, _ := r.Gather(); len(ss) != 0 {
+		t.Fatalf("samples of a timed out gather returned: %v", ss)
+	}
+	if elapsed := time.Since(begin); elapsed > time.Second {
+		t.Fatalf("gather not bounded by the timeout, took %s", elapsed)
+	}
+	stats := r.Stats()
+	if len(stats) != 1 || stats[0].Timeouts != 1 || !stats[0].Stuck || stats[0].Error == "" {
+		t.Fatalf("unexpected stats after timeout: %+v", stats)
+	}
+
+	// the hung gather is still in flight, the next one is skipped
+	r.Gather()
+	if stats = r.Stats(); stats[0].Skipped != 1 || stats[0].Timeouts != 1 {
+		t.Fatalf("unexpected stats after overrun: %+v", stats)
+	}
+
+	close(in.release)
+	deadline := time.Now().Add(time.Second)
+	for r.Stats()[0].Stuck {
+		if time.Now().After(deadline) {
+			t.Fatal("instance still stuck after release")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if ss, _ := r.Gather(); len(ss) != 1 {
+		t.Fatalf("%d samples gathered after release, want 1", len(ss))
+	}
+}
+
+// slowInput only gathers its instances, each takes delay
+type slowInput struct {
+	instances []inputs.Instance
+}
+
+func (s *slowInput) Clone() inputs.Input                           { return s }
+func (s *slowInput) Name() string                                  { return "slow" }
+func (s *slowInput) GetLabels() map[string]string                  { return nil }
+func (s *slowInput) GetInterval() config.Duration                  { return config.Duration(time.Minute) }
+func (s *slowInput) InitInternalConfig() error                     { return nil }
+func (s *slowInput) GetGatherTimeout() time.Duration               { return 50 * time.Millisecond }
+func (s *slowInput) Process(l *types.SampleList) *types.SampleList { return l }
+func (s *slowInput) GetInstances() []inputs.Instance               { return s.instances }
+
+type slowInstance struct {
+	config.InstanceConfig
+	delay time.Duration
+}
+
+func (s *slowInstance) Gather(slist *types.SampleList) {
+	time.Sleep(s.delay)
+	slist.PushSample("slow", "up", 1)
+}
+
+func TestGatherTimeoutPerInstance(t *testing.T) {
+	config.Config = &config.ConfigType{Global: config.Global{Concurrency: 1}}
+	config.HostInfo = &config.HostInfoCache{}
+	in := &slowInput{}
+	// with concurrency 1 all together take longer than the timeout, every one is within it
+	for i := 0; i < 4; i++ {
+		ins := &slowInstance{delay: 30 * time.Millisecond}
+		ins.SetInitialized()
+		in.instances = append(in.instances, ins)
+	}
+	r := newInputReader("local.slow", in)
+
+	if ss, _ := r.Gather(); len(ss) != 4 {
+		t.Fatalf("%d samples gathered, want 4", len(ss))
+	}
+	for _, s := range r.Stats() {
+		if s.Timeouts != 0 || s.Error != "" {
+			t.Fatalf("unexpected stats: %+v", s)
+		}
+	}
+}
+
+// counterInstance gathers a counter going up by 100 every gather
+type counterInstance struct {
+	config.InstanceConfig
+	value float64
+}
+
+func (c *counterInstance) Gather(slist *types.SampleList) {
+	c.value += 100
+	slist.PushSample("", "bytes", c.value)
+}
+
+type resettingInput struct {
+	slowInput
+}
+
+func (r *resettingInput) GatherResets() bool { return true }
+
+func TestGatherOutOfSchedule(t *testing.T) {
+	config.Config = &config.ConfigType{}
+	config.HostInfo = &config.HostInfoCache{}
+
+	ins := &counterInstance{}
+	ins.ProcessorRate = []*config.ProcessorRate{{Metrics: []string{"bytes"}, DropOriginal: true}}
+	if err := ins.InitInternalConfig(); err != nil {
+		t.Fatal(err)
+	}
+	ins.SetInitialized()
+	r := newInputReader("local.counter", &slowInput{instances: []inputs.Instance{ins}})
+
+	// processor_rate is neither run nor fed, its originals are dropped
+	for i := 0; i < 2; i++ {
+		if ss, err := r.Gather(); err != nil || len(ss) != 0 {
+			t.Fatalf("gather %d: %v %+v", i, err, ss)
+		}
+	}
+
+	r = newInputReader("local.resetting", &resettingInput{})
+	if _, err := r.Gather(); err != ErrGatherResets {
+		t.Fatalf("got %v, want %v", err, ErrGatherResets)
+	}
+}
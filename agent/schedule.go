@@ -0,0 +1,56 @@
+package agent
+
+import (
+	"fmt"
+	"math/rand"
+	"time"
+)
+
+// schedule computes when an input gathers, ticks are interval apart, shifted
+// by offset, optionally aligned to wall clock multiples of interval, and each
+// gather is delayed by a random jitter which does not accumulate
+type schedule struct {
+	interval time.Duration
+	jitter   time.Duration
+	offset   time.Duration
+	round    bool
+}
+
+func (s schedule) String() string {
+	return fmt.Sprintf("interval: %s jitter: %s offset: %s round_interval: %v", s.interval, s.jitter, s.offset, s.round)
+}
+
+// first returns the first tick, on the next interval boundary if aligned
+func (s schedule) first(now time.Time) time.Time {
+	if !s.round {
+		return now.Add(s.offset)
+	}
+	tick := now.Truncate(s.interval).Add(s.offset)
+	for tick.Before(now) {
+		tick = tick.Add(s.interval)
+	}
+	return tick
+}
+
+// next returns the tick following tick, ticks already passed at now are
+// skipped and counted
+func (s schedule) next(tick, now time.Time) (time.Time, uint64) {
+	tick = tick.Add(s.interval)
+	if !tick.Before(now) {
+		return tick, 0
+	}
+	if !s.round {
+		skipped := uint64(now.Sub(tick)/s.interval) + 1
+		return now, skipped
+	}
+	skipped := uint64(now.Sub(tick)/s.interval) + 1
+	return tick.Add(time.Duration(skipped) * s.interval), skipped
+}
+
+// fireAt returns the moment to gather for tick
+func (s schedule) fireAt(tick time.Time) time.Time {
+	if s.jitter <= 0 {
+		return tick
+	}
+	return tick.Add(time.Duration(rand.Int63n(int64(s.jitter))))
+}
@@ -0,0 +1,41 @@
+package agent
+
+import (
+	"testing"
+	"time"
+)
+
+func TestScheduleRoundInterval(t *testing.T) {
+	s := schedule{interval: time.Minute, offset: 5 * time.Second, round: true}
+	now := time.Date(2024, 1, 1, 10, 0, 42, 0, time.UTC)
+
+	tick := s.first(now)
+	if want := time.Date(2024, 1, 1, 10, 1, 5, 0, time.UTC); !tick.Equal(want) {
+		t.Fatalf("first tick %s, want %s", tick, want)
+	}
+
+	// a gather taking 2.5 intervals skips 2 ticks and stays aligned
+	next, skipped := s.next(tick, tick.Add(150*time.Second))
+	if want := time.Date(2024, 1, 1, 10, 4, 5, 0, time.UTC); !next.Equal(want) || skipped != 2 {
+		t.Fatalf("next tick %s skipped %d, want %s skipped 2", next, skipped, want)
+	}
+
+	s.jitter = 10 * time.Second
+	for i := 0; i < 100; i++ {
+		if d := s.fireAt(next).Sub(next); d < 0 || d >= s.jitter {
+			t.Fatalf("jitter %s out of [0, %s)", d, s.jitter)
+		}
+	}
+}
+
+func TestScheduleRelative(t *testing.T) {
+	s := schedule{interval: 15 * time.Second}
+	now := time.Date(2024, 1, 1, 10, 0, 42, 0, time.UTC)
+	tick := s.first(now)
+	if !tick.Equal(now) {
+		t.Fatalf("first tick %s, want %s", tick, now)
+	}
+	if next, skipped := s.next(tick, now.Add(time.Second)); !next.Equal(now.Add(15*time.Second)) || skipped != 0 {
+		t.Fatalf("next tick %s skipped %d", next, skipped)
+	}
+}
@@ -0,0 +1,143 @@
+package api
+
+import (
+	"bufio"
+	"log"
+	"net"
+	"strings"
+	"time"
+
+	"flashcat.cloud/categraf/config"
+	"flashcat.cloud/categraf/parser/graphite"
+	"flashcat.cloud/categraf/types"
+)
+
+const graphiteBatch = 1000
+
+// StartGraphite listens for the graphite plaintext protocol, see [graphite]
+func StartGraphite() {
+	conf := config.Config.Graphite
+	if conf == nil || !conf.Enable || config.Config.TestMode {
+		return
+	}
+	if conf.Address == "" {
+		conf.Address = ":2003"
+	}
+
+	parser, err := graphite.NewParser(conf.Separator, conf.Templates)
+	if err != nil {
+		log.Println("E! graphite: invalid templates:", err)
+		return
+	}
+
+	protocol := strings.ToLower(conf.Protocol)
+	if protocol == "" || protocol == "tcp" {
+		ln, err := net.Listen("tcp", conf.Address)
+		if err != nil {
+			log.Println("E! graphite: failed to listen on tcp", conf.Address, "error:", err)
+		} else {
+			log.Println("I! graphite listening on tcp:", conf.Address)
+			go serveGraphiteTCP(ln, parser)
+		}
+	}
+	if protocol == "" || protocol == "udp" {
+		pc, err := net.ListenPacket("udp", conf.Address)
+		if err != nil {
+			log.Println("E! graphite: failed to listen on udp", conf.Address, "error:", err)
+		} else {
+			log.Println("I! graphite listening on udp:", conf.Address)
+			go serveGraphiteUDP(pc, parser)
+		}
+	}
+}
+
+func serveGraphiteTCP(ln net.Listener, parser *graphite.Parser) {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				time.Sleep(100 * time.Millisecond)
+				continue
+			}
+			log.Println("E! graphite: accept error:", err)
+			return
+		}
+		go handleGraphiteConn(conn, parser)
+	}
+}
+
+// handleGraphiteConn pushes the lines of a connection in batches, a partial
+// batch is pushed when the client pauses
+func handleGraphiteConn(conn net.Conn, parser *graphite.Parser) {
+	defer conn.Close()
+	lines := make(chan string, graphiteBatch)
+	go func() {
+		defer close(lines)
+		scanner := bufio.NewScanner(conn)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+	}()
+
+	batch := make([]*types.Sample, 0, graphiteBatch)
+	flush := func() {
+		if len(batch) > 0 {
+			pushSamples("push.graphite", batch, false, false)
+			batch = make([]*types.Sample, 0, graphiteBatch)
+		}
+	}
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case line, ok := <-lines:
+			if !ok {
+				flush()
+				return
+			}
+			if s := parseGraphiteLine(parser, line); s != nil {
+				batch = append(batch, s)
+			}
+			if len(batch) >= graphiteBatch {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+func serveGraphiteUDP(pc net.PacketConn, parser *graphite.Parser) {
+	buf := make([]byte, 65536)
+	for {
+		n, _, err := pc.ReadFrom(buf)
+		if err != nil {
+			log.Println("E! graphite: read udp error:", err)
+			return
+		}
+		var samples []*types.Sample
+		for _, line := range strings.Split(string(buf[:n]), "\n") {
+			if s := parseGraphiteLine(parser, line); s != nil {
+				samples = append(samples, s)
+			}
+		}
+		if len(samples) > 0 {
+			pushSamples("push.graphite", samples, false, false)
+		}
+	}
+}
+
+func parseGraphiteLine(parser *graphite.Parser, line string) *types.Sample {
+	line = strings.TrimSpace(line)
+	if line == "" {
+		return nil
+	}
+	s, err := parser.ParseLine(line)
+	if err != nil {
+		if config.DebugMode() {
+			log.Println("D! graphite: failed to parse line:", line, "error:", err)
+		}
+		return nil
+	}
+	return s
+}
@@ -0,0 +1,119 @@
+package api
+
+import (
+	"crypto/subtle"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"flashcat.cloud/categraf/agent"
+	"flashcat.cloud/categraf/config"
+	"flashcat.cloud/categraf/inputs"
+	"flashcat.cloud/categraf/pkg/conv"
+)
+
+var metricsAgent atomic.Pointer[agent.MetricsAgent]
+
+// SetAgent makes the inputs of ag manageable with the control api
+func SetAgent(ag *agent.Agent) {
+	metricsAgent.Store(ag.Metrics())
+}
+
+type (
+	gatheredSample struct {
+		Metric    string            `json:"metric"`
+		Labels    map[string]string `json:"labels"`
+		Value     interface{}       `json:"value"`
+		Timestamp int64             `json:"timestamp"`
+	}
+)
+
+// controlAuth requires the bearer token of http.control_token
+func controlAuth(c *gin.Context) {
+	token := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+	if subtle.ConstantTimeCompare([]byte(token), []byte(config.Config.HTTP.ControlToken)) != 1 {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	c.Next()
+}
+
+// agentRunning is required by the routes managing inputs
+func agentRunning(c *gin.Context) {
+	if metricsAgent.Load() == nil {
+		c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"error": "metrics agent is not running"})
+		return
+	}
+	c.Next()
+}
+
+func listInputs(c *gin.Context) {
+	readers := metricsAgent.Load().Readers(c.Param("name"))
+	if c.Param("name") != "" && len(readers) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "input not found"})
+		return
+	}
+
+	ret := make([]inputs.InputHealth, 0, len(readers))
+	for _, r := range readers {
+		ret = append(ret, r.Health())
+	}
+	c.JSON(http.StatusOK, ret)
+}
+
+// gatherInput runs an input once and returns the samples, they are not sent
+// to writers. Inputs whose gathers reset their state are refused.
+func gatherInput(c *gin.Context) {
+	readers := metricsAgent.Load().Readers(c.Param("name"))
+	if len(readers) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "input not found"})
+		return
+	}
+
+	ret := make([]gatheredSample, 0)
+	for _, r := range readers {
+		samples, err := r.Gather()
+		if err != nil {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		for _, s := range samples {
+			if s == nil {
+				continue
+			}
+			var value interface{} = s.Value
+			// json has no representation for NaN and Inf
+			if f, err := conv.ToFloat64(s.Value); err == nil && (math.IsNaN(f) || math.IsInf(f, 0)) {
+				value = strconv.FormatFloat(f, 'g', -1, 64)
+			}
+			ret = append(ret, gatheredSample{
+				Metric:    s.Metric,
+				Labels:    s.Labels,
+				Value:     value,
+				Timestamp: s.Timestamp.UnixNano() / int64(time.Millisecond),
+			})
+		}
+	}
+	c.JSON(http.StatusOK, ret)
+}
+
+func reloadInput(c *gin.Context) {
+	if err := metricsAgent.Load().ReloadInput(c.Param("name")); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "reloaded"})
+}
+
+func stopInput(c *gin.Context) {
+	if err := metricsAgent.Load().StopInput(c.Param("name")); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "stopped"})
+}
@@ -210,6 +210,6 @@ func openFalcon(c *gin.Context) {
 		log.Println("falcon forwarder error, message:", string(bytes))
 	}
 
-	writer.WriteTimeSeries(series)
+	writer.WriteTimeSeries(writer.GuardTimeSeries("push.openfalcon", series))
 	c.String(200, "succ:%d fail:%d message:%s", succ, fail, msg)
 }
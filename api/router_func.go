@@ -6,10 +6,15 @@ import (
 	"io"
 	"io/ioutil"
 	"net/http"
+	"time"
 
 	"github.com/gogo/protobuf/proto"
 	"github.com/golang/snappy"
 	"github.com/prometheus/prometheus/prompb"
+
+	"flashcat.cloud/categraf/config"
+	"flashcat.cloud/categraf/types"
+	"flashcat.cloud/categraf/writer"
 )
 
 const agentHostnameLabelKey = "agent_hostname"
@@ -57,3 +62,35 @@ func DecodeWriteRequest(r io.Reader) (*prompb.WriteRequest, error) {
 
 	return &req, nil
 }
+
+// pushSamples fills timestamps, global labels and agent_hostname of pushed
+// samples and hands them to the writers, source names them in the
+// cardinality guard
+func pushSamples(source string, samples []*types.Sample, ignoreHostname, ignoreGlobalLabels bool) {
+	now := time.Now()
+	for i := range samples {
+		if samples[i].Labels == nil {
+			samples[i].Labels = make(map[string]string)
+		}
+		// handle timestamp
+		if samples[i].Timestamp.IsZero() {
+			samples[i].Timestamp = now
+		}
+
+		// add global labels
+		if !ignoreGlobalLabels {
+			for k, v := range config.GlobalLabels() {
+				if _, has := samples[i].Labels[k]; has {
+					continue
+				}
+				samples[i].Labels[k] = v
+			}
+		}
+
+		// add label: agent_hostname
+		if _, has := samples[i].Labels[agentHostnameLabelKey]; !has && !ignoreHostname {
+			samples[i].Labels[agentHostnameLabelKey] = config.Config.GetHostname()
+		}
+	}
+	writer.WriteSamples(writer.GuardSamples(source, samples))
+}
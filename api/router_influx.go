@@ -0,0 +1,40 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"flashcat.cloud/categraf/parser/influx"
+	"flashcat.cloud/categraf/types"
+)
+
+// influxWrite accepts the line protocol of InfluxDB v1 /write and
+// v2 /api/v2/write, each field becomes a series named measurement_field
+func influxWrite(c *gin.Context) {
+	bs, err := readerGzipBody(c.GetHeader("Content-Encoding"), c.Request)
+	if err != nil {
+		c.String(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	parser, err := influx.NewParserWithPrecision(c.Query("precision"))
+	if err != nil {
+		c.String(http.StatusBadRequest, err.Error())
+		return
+	}
+	slist := types.NewSampleList()
+	if err = parser.Parse(bs, slist); err != nil {
+		c.String(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	samples := slist.PopBackAll()
+	if len(samples) == 0 {
+		c.String(http.StatusBadRequest, "no valid samples")
+		return
+	}
+
+	pushSamples("push.influx", samples, c.GetBool("ignore_hostname"), c.GetBool("ignore_global_labels"))
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,42 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"flashcat.cloud/categraf/types"
+)
+
+// jsonPush accepts an array of samples, e.g.
+// [{"metric":"app_requests","labels":{"path":"/"},"value":1,"timestamp":"2023-01-02T15:04:05Z"}],
+// timestamps are optional
+func jsonPush(c *gin.Context) {
+	bs, err := readerGzipBody(c.GetHeader("Content-Encoding"), c.Request)
+	if err != nil {
+		c.String(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var samples []*types.Sample
+	if err = json.Unmarshal(bs, &samples); err != nil {
+		c.String(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	valid := samples[:0]
+	for _, s := range samples {
+		if s == nil || s.Metric == "" || s.Value == nil {
+			continue
+		}
+		valid = append(valid, s)
+	}
+	if len(valid) == 0 {
+		c.String(http.StatusBadRequest, "no valid samples")
+		return
+	}
+
+	pushSamples("push.json", valid, c.GetBool("ignore_hostname"), c.GetBool("ignore_global_labels"))
+	c.String(200, "succ:%d fail:%d", len(valid), len(samples)-len(valid))
+}
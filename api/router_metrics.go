@@ -0,0 +1,31 @@
+package api
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"flashcat.cloud/categraf/writer"
+)
+
+// exposeMetrics serves gathered series for scraping, see http.expose_metrics
+func exposeMetrics(c *gin.Context) {
+	c.Header("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	c.Status(http.StatusOK)
+	if err := writer.WriteExposition(c.Writer); err != nil {
+		log.Println("W! write /metrics response got error:", err)
+	}
+}
+
+// cardinalityTop lists the metrics with the most series, ?n= limits the
+// result(default 20)
+func cardinalityTop(c *gin.Context) {
+	n, err := strconv.Atoi(c.DefaultQuery("n", "20"))
+	if err != nil {
+		c.String(http.StatusBadRequest, "invalid n: %v", err)
+		return
+	}
+	c.JSON(http.StatusOK, writer.CardinalityTop(n))
+}
@@ -195,6 +195,6 @@ func openTSDB(c *gin.Context) {
 		log.Println("opentsdb forwarder error, message:", string(bytes))
 	}
 
-	writer.WriteTimeSeries(series)
+	writer.WriteTimeSeries(writer.GuardTimeSeries("push.opentsdb", series))
 	c.String(200, "succ:%d fail:%d message:%s", succ, fail, msg)
 }
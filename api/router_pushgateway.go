@@ -2,14 +2,11 @@ package api
 
 import (
 	"net/http"
-	"time"
 
 	"github.com/gin-gonic/gin"
 
-	"flashcat.cloud/categraf/config"
 	"flashcat.cloud/categraf/parser/prometheus"
 	"flashcat.cloud/categraf/types"
-	"flashcat.cloud/categraf/writer"
 )
 
 func pushgateway(c *gin.Context) {
@@ -38,33 +35,6 @@ func pushgateway(c *gin.Context) {
 		return
 	}
 
-	ignoreHostname := c.GetBool("ignore_hostname")
-	ignoreGlobalLabels := c.GetBool("ignore_global_labels")
-
-	now := time.Now()
-
-	for i := 0; i < count; i++ {
-		// handle timestamp
-		if samples[i].Timestamp.IsZero() {
-			samples[i].Timestamp = now
-		}
-
-		// add global labels
-		if !ignoreGlobalLabels {
-			for k, v := range config.GlobalLabels() {
-				if _, has := samples[i].Labels[k]; has {
-					continue
-				}
-				samples[i].Labels[k] = v
-			}
-		}
-
-		// add label: agent_hostname
-		if _, has := samples[i].Labels[agentHostnameLabelKey]; !has && !ignoreHostname {
-			samples[i].Labels[agentHostnameLabelKey] = config.Config.GetHostname()
-		}
-
-	}
-	writer.WriteSamples(samples)
+	pushSamples("push.pushgateway", samples, c.GetBool("ignore_hostname"), c.GetBool("ignore_global_labels"))
 	c.String(200, "forwarding...")
 }
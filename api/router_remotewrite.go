@@ -50,7 +50,7 @@ func remoteWrite(c *gin.Context) {
 		}
 	}
 
-	writer.WriteTimeSeries(req.Timeseries)
+	writer.WriteTimeSeries(writer.GuardTimeSeries("push.remotewrite", req.Timeseries))
 	c.String(200, "forwarding...")
 }
 
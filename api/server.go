@@ -11,6 +11,7 @@ import (
 
 	"flashcat.cloud/categraf/config"
 	"flashcat.cloud/categraf/pkg/aop"
+	"flashcat.cloud/categraf/writer"
 )
 
 func Start() {
@@ -69,9 +70,32 @@ func configRoutes(r *gin.Engine) {
 		c.String(200, "pong")
 	})
 
+	if writer.ExposeEnabled() {
+		r.GET("/metrics", exposeMetrics)
+	}
+
+	if config.Config.HTTP.ControlToken != "" {
+		if writer.CardinalityEnabled() {
+			r.GET("/api/cardinality", controlAuth, cardinalityTop)
+		}
+
+		ctl := r.Group("/api/control", controlAuth, agentRunning)
+		ctl.GET("/inputs", listInputs)
+		ctl.GET("/inputs/:name", listInputs)
+		ctl.POST("/inputs/:name/gather", gatherInput)
+		ctl.POST("/inputs/:name/reload", reloadInput)
+		ctl.POST("/inputs/:name/stop", stopInput)
+	}
+
 	g := r.Group("/api/push")
 	g.POST("/opentsdb", openTSDB)
 	g.POST("/openfalcon", openFalcon)
 	g.POST("/remotewrite", remoteWrite)
 	g.POST("/pushgateway", pushgateway)
+	g.POST("/influx", influxWrite)
+	g.POST("/json", jsonPush)
+
+	// paths of InfluxDB v1 and v2 clients
+	r.POST("/write", influxWrite)
+	r.POST("/api/v2/write", influxWrite)
 }
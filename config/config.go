@@ -37,10 +37,22 @@ type Global struct {
 	Interval     Duration          `toml:"interval"`
 	Providers    []string          `toml:"providers"`
 	Concurrency  int               `toml:"concurrency"`
+
+	// gathers start at a random delay up to CollectionJitter, shifted by
+	// CollectionOffset, aligned to wall clock multiples of the interval if
+	// RoundInterval is set
+	CollectionJitter Duration `toml:"collection_jitter"`
+	CollectionOffset Duration `toml:"collection_offset"`
+	RoundInterval    bool     `toml:"round_interval"`
+
+	// deadline of the gather of an instance from its start, none if 0
+	GatherTimeout Duration `toml:"gather_timeout"`
 }
 
 type Log struct {
-	FileName   string `toml:"file_name"`
+	FileName string `toml:"file_name"`
+	// debug, info, warn or error, lines below it are dropped
+	Level      string `toml:"level"`
 	MaxSize    int    `toml:"max_size"`
 	MaxAge     int    `toml:"max_age"`
 	MaxBackups int    `toml:"max_backups"`
@@ -51,9 +63,61 @@ type Log struct {
 type WriterOpt struct {
 	Batch    int `toml:"batch"`
 	ChanSize int `toml:"chan_size"`
+
+	// labels hashed to pick a writer in shard mode, all labels if empty
+	ShardLabels []string `toml:"shard_labels"`
+
+	Wal WalOpt `toml:"wal"`
 }
 
+// WalOpt controls the on-disk write-ahead queue of writers. When enabled,
+// every batch is appended to segment files under Dir before being sent, in
+// order, so an outage of the backend or a restart of the agent loses nothing.
+type WalOpt struct {
+	Enable bool   `toml:"enable"`
+	Dir    string `toml:"dir"`
+	// size of one segment file, unit: MB
+	SegmentSize int64 `toml:"segment_size"`
+	// max bytes kept on disk per writer, unit: MB
+	MaxSize int64 `toml:"max_size"`
+	// segments older than MaxAge are dropped
+	MaxAge Duration `toml:"max_age"`
+	// pause between send attempts when the backend keeps failing
+	ReplayInterval Duration `toml:"replay_interval"`
+}
+
+const (
+	WriterModeBroadcast = "broadcast"
+	WriterModeShard     = "shard"
+	WriterModeFailover  = "failover"
+
+	WriterProtocolV1   = "v1"
+	WriterProtocolV2   = "v2"
+	WriterProtocolAuto = "auto"
+
+	WriterFormatPrometheus = "prometheus"
+	WriterFormatOTLPGrpc   = "otlp_grpc"
+	WriterFormatOTLPHttp   = "otlp_http"
+	WriterFormatKafka      = "kafka"
+	WriterFormatInflux     = "influx"
+
+	WriterEncodingJSON       = "json"
+	WriterEncodingPrometheus = "prometheus"
+)
+
 type WriterOption struct {
+	// broadcast: receive all series; shard: writers in shard mode split series
+	// between them by hashing labels; failover: only the first healthy writer
+	// in failover mode receives series
+	Mode string `toml:"mode"`
+	// prometheus: remote write; otlp_grpc, otlp_http: OpenTelemetry collector;
+	// kafka: publish to Topic of the brokers in Url; influx: line protocol to /write
+	Format string `toml:"format"`
+	// remote write protocol: v1, v2, or auto which tries v2 and falls back to v1
+	Protocol string `toml:"protocol"`
+	// v1 only, attach type and help of the metric families in every batch
+	SendMetadata bool `toml:"send_metadata"`
+
 	Url           string   `toml:"url"`
 	BasicAuthUser string   `toml:"basic_auth_user"`
 	BasicAuthPass string   `toml:"basic_auth_pass"`
@@ -63,9 +127,70 @@ type WriterOption struct {
 	DialTimeout         int64 `toml:"dial_timeout"`
 	MaxIdleConnsPerHost int   `toml:"max_idle_conns_per_host"`
 
+	// batches buffered for this writer before new ones are dropped
+	QueueSize int `toml:"queue_size"`
+	// retries of a batch on network errors, 5xx and 429
+	MaxRetries       int      `toml:"max_retries"`
+	RetryBackoffBase Duration `toml:"retry_backoff_base"`
+	RetryBackoffMax  Duration `toml:"retry_backoff_max"`
+	// consecutive failures that open the circuit breaker, and how long it stays open
+	BreakerThreshold int      `toml:"breaker_threshold"`
+	BreakerCooldown  Duration `toml:"breaker_cooldown"`
+
+	// only series passing these filters are sent to this writer,
+	// relabel_configs see the metric name as label __name__
+	MetricsDrop    []string         `toml:"metrics_drop"`
+	MetricsPass    []string         `toml:"metrics_pass"`
+	RelabelConfigs []*RelabelConfig `toml:"relabel_configs"`
+
+	// kafka format only, Url is a comma separated list of brokers and
+	// messages are keyed by the ident of the series
+	Topic string `toml:"topic"`
+	// json or prometheus(snappy compressed remote write 1.0 request)
+	Encoding      string `toml:"encoding"`
+	KafkaVersion  string `toml:"kafka_version"`
+	SaslUser      string `toml:"sasl_user"`
+	SaslPassword  string `toml:"sasl_password"`
+	SaslMechanism string `toml:"sasl_mechanism"`
+
 	tls.ClientConfig
 }
 
+func (w *WriterOption) setDefaults() {
+	if w.Mode == "" {
+		w.Mode = WriterModeBroadcast
+	}
+	if w.Format == "" {
+		w.Format = WriterFormatPrometheus
+	}
+	if w.Protocol == "" {
+		w.Protocol = WriterProtocolV1
+	}
+	if w.Encoding == "" {
+		w.Encoding = WriterEncodingJSON
+	}
+	if w.QueueSize <= 0 {
+		w.QueueSize = 100
+	}
+	if w.MaxRetries < 0 {
+		w.MaxRetries = 0
+	} else if w.MaxRetries == 0 {
+		w.MaxRetries = 3
+	}
+	if w.RetryBackoffBase <= 0 {
+		w.RetryBackoffBase = Duration(500 * time.Millisecond)
+	}
+	if w.RetryBackoffMax <= 0 {
+		w.RetryBackoffMax = Duration(30 * time.Second)
+	}
+	if w.BreakerThreshold <= 0 {
+		w.BreakerThreshold = 5
+	}
+	if w.BreakerCooldown <= 0 {
+		w.BreakerCooldown = Duration(30 * time.Second)
+	}
+}
+
 type HTTP struct {
 	Enable       bool   `toml:"enable"`
 	Address      string `toml:"address"`
@@ -76,6 +201,45 @@ type HTTP struct {
 	ReadTimeout  int    `toml:"read_timeout"`
 	WriteTimeout int    `toml:"write_timeout"`
 	IdleTimeout  int    `toml:"idle_timeout"`
+
+	// serve the latest value of every gathered series at /metrics,
+	// series not updated for MetricsStaleness intervals are dropped
+	ExposeMetrics    bool `toml:"expose_metrics"`
+	MetricsStaleness int  `toml:"metrics_staleness"`
+
+	// bearer token of the /api/control endpoints, they are disabled if empty
+	ControlToken string `toml:"control_token"`
+}
+
+const (
+	CardinalityDrop       = "drop"
+	CardinalityStripLabel = "strip_label"
+	CardinalityAlert      = "alert"
+)
+
+// Cardinality limits the series of every input and push endpoint, series not
+// seen within Window are forgotten
+type Cardinality struct {
+	Enable             bool     `toml:"enable"`
+	Window             Duration `toml:"window"`
+	MaxSeriesPerInput  int      `toml:"max_series_per_input"`
+	MaxSeriesPerMetric int      `toml:"max_series_per_metric"`
+	// max series of specific inputs, e.g. prometheus or push.remotewrite
+	InputLimits map[string]int `toml:"input_limits"`
+	// drop new series, strip strip_labels from them, or only count them
+	Action      string   `toml:"action"`
+	StripLabels []string `toml:"strip_labels"`
+}
+
+// Graphite receives the graphite plaintext protocol
+type Graphite struct {
+	Enable  bool   `toml:"enable"`
+	Address string `toml:"address"`
+	// tcp, udp, or both if empty
+	Protocol string `toml:"protocol"`
+	// joins the measurement parts of templates
+	Separator string   `toml:"separator"`
+	Templates []string `toml:"templates"`
 }
 
 type IbexConfig struct {
@@ -83,6 +247,19 @@ type IbexConfig struct {
 	Interval Duration `toml:"interval"`
 	MetaDir  string   `toml:"meta_dir"`
 	Servers  []string `toml:"servers"`
+
+	// rpc: msgpack rpc over tcp, servers are host:port; http: json over
+	// http(s), servers are urls, e.g. https://n9e:10090
+	Transport string `toml:"transport"`
+	// http: sent as "Authorization: Bearer <token>"
+	Token string `toml:"token"`
+	// servers are probed again to pick the fastest every ReselectInterval
+	ReselectInterval Duration `toml:"reselect_interval"`
+	// http: output of running tasks is sent every OutputInterval, off if 0
+	OutputInterval Duration `toml:"output_interval"`
+	tls.ClientConfig
+
+	Sandbox IbexSandbox `toml:"sandbox"`
 }
 
 type HeartbeatConfig struct {
@@ -95,6 +272,15 @@ type HeartbeatConfig struct {
 	Timeout             int64    `toml:"timeout"`
 	DialTimeout         int64    `toml:"dial_timeout"`
 	MaxIdleConnsPerHost int      `toml:"max_idle_conns_per_host"`
+	// act on the commands of the heartbeat response, e.g. set_log_level
+	EnableCommands bool `toml:"enable_commands"`
+	// add packages, listening ports, systemd units, kernel modules and
+	// container runtimes to extend_info
+	Inventory bool `toml:"inventory"`
+	// extend_info only carries the sections changed since the last accepted
+	// heartbeat, all of them every FullReportInterval, unit: s, default 3600
+	DeltaExtendInfo    bool  `toml:"delta_extend_info"`
+	FullReportInterval int64 `toml:"full_report_interval"`
 
 	HTTPProxy
 	tls.ClientConfig
@@ -103,7 +289,6 @@ type HeartbeatConfig struct {
 type ConfigType struct {
 	// from console args
 	ConfigDir    string
-	DebugMode    bool
 	TestMode     bool
 	InputFilters string
 
@@ -121,6 +306,14 @@ type ConfigType struct {
 
 	HTTPProviderConfig *HTTPProviderConfig `toml:"http_provider"`
 	Update             *UpdateConfig       `toml:"update"`
+
+	SecretStores []SecretStoreConfig `toml:"secretstores"`
+
+	Processors  []ProcessorConfig  `toml:"processors"`
+	Aggregators []AggregatorConfig `toml:"aggregators"`
+
+	Cardinality Cardinality `toml:"cardinality"`
+	Graphite    *Graphite   `toml:"graphite"`
 }
 
 var Config *ConfigType
@@ -133,10 +326,10 @@ func InitConfig(configDir string, debugMode, testMode bool, interval int64, inpu
 
 	Config = &ConfigType{
 		ConfigDir:    configDir,
-		DebugMode:    debugMode,
 		TestMode:     testMode,
 		InputFilters: inputFilters,
 	}
+	SetDebugMode(debugMode)
 
 	if err := cfg.LoadConfigByDir(configDir, Config); err != nil {
 		return fmt.Errorf("failed to load configs of dir: %s err:%s", configDir, err)
@@ -158,6 +351,50 @@ func InitConfig(configDir string, debugMode, testMode bool, interval int64, inpu
 		Config.WriterOpt.Batch = 1000
 	}
 
+	if Config.WriterOpt.Wal.Enable {
+		if Config.WriterOpt.Wal.Dir == "" {
+			Config.WriterOpt.Wal.Dir = "./wal"
+		}
+		if Config.WriterOpt.Wal.SegmentSize <= 0 {
+			Config.WriterOpt.Wal.SegmentSize = 64
+		}
+		if Config.WriterOpt.Wal.MaxSize <= 0 {
+			Config.WriterOpt.Wal.MaxSize = 1024
+		}
+		if Config.WriterOpt.Wal.MaxAge <= 0 {
+			Config.WriterOpt.Wal.MaxAge = Duration(24 * time.Hour)
+		}
+		if Config.WriterOpt.Wal.ReplayInterval <= 0 {
+			Config.WriterOpt.Wal.ReplayInterval = Duration(5 * time.Second)
+		}
+	}
+
+	for i := range Config.Writers {
+		Config.Writers[i].setDefaults()
+	}
+
+	if Config.HTTP != nil && Config.HTTP.MetricsStaleness <= 0 {
+		Config.HTTP.MetricsStaleness = 3
+	}
+
+	if err := SetLogLevel(Config.Log.Level); err != nil {
+		return err
+	}
+
+	if Config.Cardinality.Window <= 0 {
+		Config.Cardinality.Window = Duration(10 * time.Minute)
+	}
+	if Config.Cardinality.Action == "" {
+		Config.Cardinality.Action = CardinalityDrop
+	}
+
+	if err := InitSecretStores(Config.SecretStores); err != nil {
+		return err
+	}
+	if err := linkConfigSecrets(); err != nil {
+		return fmt.Errorf("failed to link secrets: %v", err)
+	}
+
 	Config.Global.Hostname = strings.TrimSpace(Config.Global.Hostname)
 
 	if err := InitHostInfo(); err != nil {
@@ -222,11 +459,14 @@ func GetEnv(key string) string {
 }
 
 func GetInterval() time.Duration {
-	if Config.Global.Interval <= 0 {
+	globalLock.RLock()
+	interval := Config.Global.Interval
+	globalLock.RUnlock()
+	if interval <= 0 {
 		return time.Second * 15
 	}
 
-	return time.Duration(Config.Global.Interval)
+	return time.Duration(interval)
 }
 
 func GetConcurrency() int {
@@ -312,8 +552,13 @@ func GetOutboundIP() (net.IP, error) {
 }
 
 func GlobalLabels() map[string]string {
+	globalLock.RLock()
+	labels := Config.Global.Labels
+	globalLock.RUnlock()
+
+	// the map is replaced, never modified, by SetGlobalLabels
 	ret := make(map[string]string)
-	for k, v := range Config.Global.Labels {
+	for k, v := range labels {
 		ret[k] = Expand(v)
 	}
 	return ret
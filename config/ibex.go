@@ -0,0 +1,75 @@
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+// IbexSandbox limits the scripts run by ibex tasks, every limit is off when
+// unset
+type IbexSandbox struct {
+	// cgroup v2 limits of every task, linux only. cpu_quota is in cores,
+	// e.g. 0.5, memory_max in MB
+	CPUQuota  float64 `toml:"cpu_quota"`
+	MemoryMax int64   `toml:"memory_max"`
+	PidsMax   int64   `toml:"pids_max"`
+	// parent of the cgroups of the tasks
+	CgroupRoot string `toml:"cgroup_root"`
+
+	// tasks running longer are killed with their process group
+	Timeout Duration `toml:"timeout"`
+	// bytes of stdout and stderr kept per task, the beginning and the end
+	// are kept around a truncation marker, all of it if 0
+	MaxOutputSize int `toml:"max_output_size"`
+
+	// accounts the scripts may run as, deny wins over allow, all accounts
+	// are allowed if AllowAccounts is empty
+	AllowAccounts []string `toml:"allow_accounts"`
+	DenyAccounts  []string `toml:"deny_accounts"`
+	// hex sha256 of the scripts, same rules as accounts
+	AllowScriptHashes []string `toml:"allow_script_hashes"`
+	DenyScriptHashes  []string `toml:"deny_script_hashes"`
+}
+
+const (
+	IbexTransportRPC  = "rpc"
+	IbexTransportHTTP = "http"
+)
+
+func (c *IbexConfig) Init() error {
+	switch c.Transport {
+	case "":
+		c.Transport = IbexTransportRPC
+	case IbexTransportRPC, IbexTransportHTTP:
+	default:
+		return fmt.Errorf("ibex: unknown transport %q", c.Transport)
+	}
+	if len(c.Servers) == 0 {
+		return fmt.Errorf("ibex: servers required")
+	}
+	if c.ReselectInterval <= 0 {
+		c.ReselectInterval = Duration(5 * time.Minute)
+	}
+	if c.OutputInterval < 0 {
+		return fmt.Errorf("ibex: invalid output_interval %s", time.Duration(c.OutputInterval))
+	}
+	return c.Sandbox.Init()
+}
+
+func (s *IbexSandbox) Init() error {
+	if s.CPUQuota < 0 || s.MemoryMax < 0 || s.PidsMax < 0 || s.MaxOutputSize < 0 {
+		return fmt.Errorf("ibex sandbox: cpu_quota, memory_max, pids_max and max_output_size must not be negative")
+	}
+	if s.Timeout < 0 {
+		return fmt.Errorf("ibex sandbox: invalid timeout %s", time.Duration(s.Timeout))
+	}
+	if s.CgroupRoot == "" {
+		s.CgroupRoot = "/sys/fs/cgroup/categraf-ibex"
+	}
+	return nil
+}
+
+// CgroupEnabled reports whether tasks run in their own cgroup
+func (s *IbexSandbox) CgroupEnabled() bool {
+	return s.CPUQuota > 0 || s.MemoryMax > 0 || s.PidsMax > 0
+}
@@ -36,6 +36,9 @@ type InternalConfig struct {
 	// mapping value
 	ProcessorEnum []*ProcessorEnum `toml:"processor_enum"`
 
+	// rates or deltas of counters
+	ProcessorRate []*ProcessorRate `toml:"processor_rate"`
+
 	// whether instance initial success
 	inited bool `toml:"-"`
 
@@ -95,42 +98,69 @@ func (ic *InternalConfig) InitInternalConfig() error {
 			}
 		}
 	}
+	for i := 0; i < len(ic.ProcessorRate); i++ {
+		if err := ic.ProcessorRate[i].init(); err != nil {
+			return err
+		}
+	}
+
 	if len(ic.RelabelConfigs) != 0 {
-		for _, rc := range ic.RelabelConfigs {
-			if len(rc.Regex) == 0 {
-				rc.Regex = "(.*)"
-			}
-			if len(rc.Action) == 0 {
-				rc.Action = relabel.Replace
-			}
-			if len(rc.Replacement) == 0 {
-				rc.Replacement = "$1"
-			}
-			if rc.Separator == "" {
-				rc.Separator = ";"
-			}
-			reg, err := relabel.NewRegexp(rc.Regex)
-			if err != nil {
-				msg := fmt.Errorf("relabel_configs regex:%s compile error:%s", rc.Regex, err)
-				return msg
-			}
-			r := &relabel.Config{
-				SourceLabels: rc.SourceLabels,
-				Separator:    rc.Separator,
-				Regex:        reg,
-				Modulus:      rc.Modulus,
-				TargetLabel:  rc.TargetLabel,
-				Replacement:  rc.Replacement,
-				Action:       rc.Action,
-			}
-			ic.relabelConfigs = append(ic.relabelConfigs, r)
+		var err error
+		ic.relabelConfigs, err = CompileRelabelConfigs(ic.RelabelConfigs)
+		if err != nil {
+			return err
 		}
 	}
 
 	return nil
 }
 
+// CompileRelabelConfigs fills defaults of relabel_configs and compiles them
+func CompileRelabelConfigs(rcs []*RelabelConfig) ([]*relabel.Config, error) {
+	ret := make([]*relabel.Config, 0, len(rcs))
+	for _, rc := range rcs {
+		if len(rc.Regex) == 0 {
+			rc.Regex = "(.*)"
+		}
+		if len(rc.Action) == 0 {
+			rc.Action = relabel.Replace
+		}
+		if len(rc.Replacement) == 0 {
+			rc.Replacement = "$1"
+		}
+		if rc.Separator == "" {
+			rc.Separator = ";"
+		}
+		reg, err := relabel.NewRegexp(rc.Regex)
+		if err != nil {
+			msg := fmt.Errorf("relabel_configs regex:%s compile error:%s", rc.Regex, err)
+			return nil, msg
+		}
+		r := &relabel.Config{
+			SourceLabels: rc.SourceLabels,
+			Separator:    rc.Separator,
+			Regex:        reg,
+			Modulus:      rc.Modulus,
+			TargetLabel:  rc.TargetLabel,
+			Replacement:  rc.Replacement,
+			Action:       rc.Action,
+		}
+		ret = append(ret, r)
+	}
+	return ret, nil
+}
+
 func (ic *InternalConfig) Process(slist *types.SampleList) *types.SampleList {
+	return ic.process(slist, true)
+}
+
+// ProcessStateless is Process without processor_rate, whose state belongs to
+// the scheduled gathers, for gathers out of schedule
+func (ic *InternalConfig) ProcessStateless(slist *types.SampleList) *types.SampleList {
+	return ic.process(slist, false)
+}
+
+func (ic *InternalConfig) process(slist *types.SampleList, stateful bool) *types.SampleList {
 	nlst := types.NewSampleList()
 	if slist.Len() == 0 {
 		return nlst
@@ -173,6 +203,9 @@ func (ic *InternalConfig) Process(slist *types.SampleList) *types.SampleList {
 			ss[i].Timestamp = now
 		}
 
+		// processor_rate matches names without prefix, as processor_enum does
+		name := ss[i].Metric
+
 		// name prefix
 		if len(ic.MetricsNamePrefix) > 0 {
 			ss[i].Metric = ic.MetricsNamePrefix + ss[i].Metric
@@ -221,6 +254,25 @@ func (ic *InternalConfig) Process(slist *types.SampleList) *types.SampleList {
 		// add ip_address
 		ss[i].Labels["agent_ip"] = hostIp
 
+		keep := true
+		for j := 0; j < len(ic.ProcessorRate); j++ {
+			if !ic.ProcessorRate[j].MetricsFilter.Match(name) {
+				continue
+			}
+			// out of schedule, the originals are dropped all the same
+			if stateful {
+				if rs := ic.ProcessorRate[j].process(ss[i]); rs != nil {
+					nlst.PushFront(rs)
+				}
+			}
+			if ic.ProcessorRate[j].DropOriginal {
+				keep = false
+			}
+		}
+		if !keep {
+			continue
+		}
+
 		nlst.PushFront(ss[i])
 	}
 
@@ -238,12 +290,44 @@ func (ic *InternalConfig) SetInitialized() {
 type PluginConfig struct {
 	InternalConfig
 	Interval Duration `toml:"interval"`
+
+	// override the schedule options of [global]
+	CollectionJitter *Duration `toml:"collection_jitter"`
+	CollectionOffset *Duration `toml:"collection_offset"`
+	RoundInterval    *bool     `toml:"round_interval"`
+	GatherTimeout    Duration  `toml:"gather_timeout"`
 }
 
 func (pc *PluginConfig) GetInterval() Duration {
 	return pc.Interval
 }
 
+// GetGatherTimeout returns the deadline of gathers, falling back to the one of [global]
+func (pc *PluginConfig) GetGatherTimeout() time.Duration {
+	if pc.GatherTimeout > 0 {
+		return time.Duration(pc.GatherTimeout)
+	}
+	return time.Duration(Config.Global.GatherTimeout)
+}
+
+// GetSchedule returns the jitter, offset and alignment of gathers, falling
+// back to those of [global]
+func (pc *PluginConfig) GetSchedule() (jitter, offset time.Duration, round bool) {
+	jitter = time.Duration(Config.Global.CollectionJitter)
+	offset = time.Duration(Config.Global.CollectionOffset)
+	round = Config.Global.RoundInterval
+	if pc.CollectionJitter != nil {
+		jitter = time.Duration(*pc.CollectionJitter)
+	}
+	if pc.CollectionOffset != nil {
+		offset = time.Duration(*pc.CollectionOffset)
+	}
+	if pc.RoundInterval != nil {
+		round = *pc.RoundInterval
+	}
+	return
+}
+
 type InstanceConfig struct {
 	InternalConfig
 	IntervalTimes int64 `toml:"interval_times"`
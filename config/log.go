@@ -0,0 +1,81 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"sync/atomic"
+)
+
+const (
+	LogLevelDebug = "debug"
+	LogLevelInfo  = "info"
+	LogLevelWarn  = "warn"
+	LogLevelError = "error"
+)
+
+var (
+	logLevels  = []string{LogLevelDebug, LogLevelInfo, LogLevelWarn, LogLevelError}
+	logMarkers = [][]byte{[]byte("D! "), []byte("I! "), []byte("W! "), []byte("E! ")}
+	logLevel   atomic.Int32
+)
+
+// SetLogLevel drops log lines below level, empty keeps every line. Lines of
+// level debug are only written in debug mode, so debug also turns it on, and
+// leaving debug turns it off again unless it was on already
+func SetLogLevel(level string) error {
+	if level == "" {
+		logLevel.Store(0)
+		leaveDebugLevel()
+		return nil
+	}
+	for i, l := range logLevels {
+		if strings.EqualFold(l, level) {
+			logLevel.Store(int32(i))
+			if i == 0 {
+				if !debugMode.Swap(true) {
+					debugByLevel.Store(true)
+				}
+			} else {
+				leaveDebugLevel()
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown log level %q, expected one of %v", level, logLevels)
+}
+
+// leaveDebugLevel turns off the debug mode turned on by the log level
+func leaveDebugLevel() {
+	if debugByLevel.Swap(false) {
+		debugMode.Store(false)
+	}
+}
+
+func GetLogLevel() string {
+	return logLevels[logLevel.Load()]
+}
+
+// LevelWriter drops the lines written by the log package whose D!, I!, W!
+// or E! marker is below the log level, lines without marker are kept
+type LevelWriter struct {
+	io.Writer
+}
+
+func (w LevelWriter) Write(p []byte) (int, error) {
+	min := int(logLevel.Load())
+	if min > 0 {
+		// the marker follows the date and time written by the log package
+		head := p
+		if len(head) > 40 {
+			head = head[:40]
+		}
+		for i := 0; i < min; i++ {
+			if bytes.Contains(head, logMarkers[i]) {
+				return len(p), nil
+			}
+		}
+	}
+	return w.Writer.Write(p)
+}
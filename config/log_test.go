@@ -0,0 +1,24 @@
+package config
+
+import "testing"
+
+func TestLogLevelDebugMode(t *testing.T) {
+	defer SetLogLevel("")
+	defer SetDebugMode(false)
+
+	SetDebugMode(false)
+	if err := SetLogLevel("debug"); err != nil || !DebugMode() {
+		t.Fatalf("debug level: err %v, debug mode %v", err, DebugMode())
+	}
+	if err := SetLogLevel("info"); err != nil || DebugMode() {
+		t.Fatalf("info level: err %v, debug mode %v", err, DebugMode())
+	}
+
+	// debug mode turned on by itself outlives the debug level
+	SetDebugMode(true)
+	SetLogLevel("debug")
+	SetLogLevel("warn")
+	if !DebugMode() {
+		t.Fatal("debug mode turned off by the log level")
+	}
+}
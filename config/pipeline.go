@@ -0,0 +1,46 @@
+package config
+
+const (
+	ProcessorRename     = "rename"
+	ProcessorConvert    = "convert"
+	ProcessorLabelAllow = "label_allow"
+	ProcessorDedup      = "dedup"
+)
+
+// ProcessorConfig is one step of the global [[processors]] chain, applied to
+// the samples of every input before they reach the writers
+type ProcessorConfig struct {
+	Type string `toml:"type"`
+
+	// only matching metrics are processed, the others pass through
+	MetricsPass []string `toml:"metrics_pass"`
+	MetricsDrop []string `toml:"metrics_drop"`
+
+	// rename: old name -> new name
+	MetricRenames map[string]string `toml:"metric_renames"`
+	LabelRenames  map[string]string `toml:"label_renames"`
+
+	// convert: value * scale + offset, scale defaults to 1
+	Scale  float64 `toml:"scale"`
+	Offset float64 `toml:"offset"`
+
+	// label_allow: labels kept, the others are removed
+	Labels []string `toml:"labels"`
+
+	// dedup: unchanged values are dropped until dedup_interval elapsed
+	DedupInterval Duration `toml:"dedup_interval"`
+}
+
+// AggregatorConfig summarizes matching series over period, one series is
+// emitted per stat, named after the metric with the stat as suffix
+type AggregatorConfig struct {
+	MetricsPass []string `toml:"metrics_pass"`
+	MetricsDrop []string `toml:"metrics_drop"`
+
+	Period Duration `toml:"period"`
+	// min, max, mean, sum, count, last, rate
+	Stats       []string  `toml:"stats"`
+	Percentiles []float64 `toml:"percentiles"`
+	// drop_original emits the summarized series only
+	DropOriginal bool `toml:"drop_original"`
+}
@@ -0,0 +1,142 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"flashcat.cloud/categraf/pkg/conv"
+	"flashcat.cloud/categraf/pkg/filter"
+	"flashcat.cloud/categraf/types"
+)
+
+const (
+	RateModeRate  = "rate"
+	RateModeDelta = "delta"
+)
+
+// ProcessorRate turns cumulative counters into per second rates or deltas
+// between two gathers, the first gather and the one after a counter reset
+// only record state
+type ProcessorRate struct {
+	Metrics       []string `toml:"metrics"` // support glob
+	MetricsFilter filter.Filter
+	// rate or delta
+	Mode string `toml:"mode"`
+	// appended to the metric name, default _rate or _delta
+	Suffix string `toml:"suffix"`
+	// drop_original emits the computed series only
+	DropOriginal bool `toml:"drop_original"`
+	// state of series not gathered for state_ttl is forgotten
+	StateTTL Duration `toml:"state_ttl"`
+
+	lock      sync.Mutex
+	state     map[string]rateState
+	lastSweep time.Time
+}
+
+type rateState struct {
+	value float64
+	ts    time.Time
+}
+
+func (pr *ProcessorRate) init() error {
+	if len(pr.Metrics) == 0 {
+		return fmt.Errorf("processor_rate: metrics required")
+	}
+	var err error
+	if pr.MetricsFilter, err = filter.Compile(pr.Metrics); err != nil {
+		return err
+	}
+	switch pr.Mode {
+	case "":
+		pr.Mode = RateModeRate
+	case RateModeRate, RateModeDelta:
+	default:
+		return fmt.Errorf("processor_rate: unknown mode %q", pr.Mode)
+	}
+	if pr.Suffix == "" {
+		pr.Suffix = "_" + pr.Mode
+	}
+	if pr.StateTTL <= 0 {
+		pr.StateTTL = Duration(10 * time.Minute)
+	}
+	pr.state = make(map[string]rateState)
+	return nil
+}
+
+// process returns the computed sample of s, nil if there is none yet
+func (pr *ProcessorRate) process(s *types.Sample) *types.Sample {
+	if s.Histogram != nil {
+		return nil
+	}
+	v, err := conv.ToFloat64(s.Value)
+	if err != nil {
+		return nil
+	}
+	key := rateKey(s)
+
+	pr.lock.Lock()
+	defer pr.lock.Unlock()
+	pr.sweep(s.Timestamp)
+
+	prev, ok := pr.state[key]
+	pr.state[key] = rateState{value: v, ts: s.Timestamp}
+	if !ok || v < prev.value {
+		return nil
+	}
+	elapsed := s.Timestamp.Sub(prev.ts).Seconds()
+	if elapsed <= 0 {
+		return nil
+	}
+
+	value := v - prev.value
+	if pr.Mode == RateModeRate {
+		value = value / elapsed
+	}
+	labels := make(map[string]string, len(s.Labels))
+	for k, lv := range s.Labels {
+		labels[k] = lv
+	}
+	return &types.Sample{
+		Metric:    s.Metric + pr.Suffix,
+		Timestamp: s.Timestamp,
+		Value:     value,
+		Labels:    labels,
+		Meta:      &types.Metadata{Type: types.Gauge},
+	}
+}
+
+// sweep forgets stale series, the caller holds the lock
+func (pr *ProcessorRate) sweep(now time.Time) {
+	ttl := time.Duration(pr.StateTTL)
+	if now.Sub(pr.lastSweep) < ttl {
+		return
+	}
+	for key, st := range pr.state {
+		if now.Sub(st.ts) > ttl {
+			delete(pr.state, key)
+		}
+	}
+	pr.lastSweep = now
+}
+
+func rateKey(s *types.Sample) string {
+	names := make([]string, 0, len(s.Labels))
+	for k := range s.Labels {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	var sb strings.Builder
+	sb.WriteString(s.Metric)
+	for _, k := range names {
+		sb.WriteByte(0)
+		sb.WriteString(k)
+		sb.WriteByte(0)
+		sb.WriteString(s.Labels[k])
+	}
+	return sb.String()
+}
@@ -0,0 +1,48 @@
+package config
+
+import (
+	"testing"
+	"time"
+
+	"flashcat.cloud/categraf/types"
+)
+
+func TestProcessorRate(t *testing.T) {
+	pr := &ProcessorRate{Metrics: []string{"net_bytes_*"}}
+	if err := pr.init(); err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Unix(1700000000, 0)
+	points := []struct {
+		value float64
+		want  interface{}
+	}{
+		{100, nil},  // first gather only records state
+		{400, 30.0}, // (400-100)/10s
+		{50, nil},   // counter reset
+		{250, 20.0}, // (250-50)/10s
+		{250, 0.0},  // unchanged
+	}
+	for i, p := range points {
+		s := types.NewSample("", "net_bytes_recv", p.value, map[string]string{"interface": "eth0"})
+		s.Timestamp = start.Add(time.Duration(i) * 10 * time.Second)
+		rs := pr.process(s)
+		if p.want == nil {
+			if rs != nil {
+				t.Fatalf("point %d: unexpected rate %v", i, rs.Value)
+			}
+			continue
+		}
+		if rs == nil || rs.Metric != "net_bytes_recv_rate" || rs.Value != p.want || rs.Labels["interface"] != "eth0" {
+			t.Fatalf("point %d: got %+v, want %v", i, rs, p.want)
+		}
+	}
+
+	// stale state is forgotten
+	s := types.NewSample("", "net_bytes_recv", 300, map[string]string{"interface": "eth0"})
+	s.Timestamp = start.Add(time.Hour)
+	if rs := pr.process(s); rs != nil {
+		t.Fatalf("rate computed from stale state: %v", rs.Value)
+	}
+}
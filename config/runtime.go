@@ -0,0 +1,45 @@
+package config
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// settings changed at runtime, by heartbeat commands, are read by gather
+// goroutines, they are only accessed through these functions
+var (
+	debugMode atomic.Bool
+	// debug mode was turned on by the debug log level, see SetLogLevel
+	debugByLevel atomic.Bool
+
+	// guards Config.Global.Labels and Config.Global.Interval
+	globalLock sync.RWMutex
+)
+
+// DebugMode reports whether gathered samples and debug details are printed
+func DebugMode() bool {
+	return debugMode.Load()
+}
+
+// SetDebugMode turns debug mode on or off, whatever the log level
+func SetDebugMode(on bool) {
+	debugByLevel.Store(false)
+	debugMode.Store(on)
+}
+
+// SetGlobalLabels replaces the global labels, readers get them from
+// GlobalLabels
+func SetGlobalLabels(labels map[string]string) {
+	globalLock.Lock()
+	Config.Global.Labels = labels
+	globalLock.Unlock()
+}
+
+// SetInterval changes the global collection interval, inputs pick it up when
+// the agent is reloaded
+func SetInterval(interval time.Duration) {
+	globalLock.Lock()
+	Config.Global.Interval = Duration(interval)
+	globalLock.Unlock()
+}
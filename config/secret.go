@@ -103,7 +103,9 @@ func (s *Secret) UnmarshalText(b []byte) error {
 	// Keep track of secrets that contain references to secret-stores
 	// for later resolving by the config.
 	if len(s.unlinked) > 0 && s.notempty {
+		unlinkedLock.Lock()
 		unlinkedSecrets = append(unlinkedSecrets, s)
+		unlinkedLock.Unlock()
 	}
 
 	return nil
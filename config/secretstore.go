@@ -0,0 +1,495 @@
+package config
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"flashcat.cloud/categraf/pkg/cfg"
+	"flashcat.cloud/categraf/pkg/tls"
+)
+
+const (
+	SecretStoreFile      = "file"
+	SecretStoreDir       = "dir"
+	SecretStoreEnv       = "env"
+	SecretStoreEncrypted = "encrypted"
+	SecretStoreHTTP      = "http"
+)
+
+// SecretStoreConfig is one [[secretstores]], secrets are referenced as
+// @{id:key} in config.Secret fields and in the passwords of writers,
+// heartbeat, http_provider and update
+type SecretStoreConfig struct {
+	ID   string `toml:"id"`
+	Type string `toml:"type"`
+
+	// file: json object of keys and values; dir: one file per key;
+	// encrypted: json object encrypted with aes-256-gcm
+	Path string `toml:"path"`
+	// encrypted: file holding the 32 bytes key, raw, hex or base64 encoded
+	KeyFile string `toml:"key_file"`
+	// env: secrets are read from variables named Prefix + key
+	Prefix string `toml:"prefix"`
+
+	// http: vault compatible kv api, secrets are the keys of the secret at Url,
+	// e.g. https://vault:8200/v1/secret/data/categraf
+	Url       string            `toml:"url"`
+	Token     string            `toml:"token"`
+	Headers   map[string]string `toml:"headers"`
+	KVVersion int               `toml:"kv_version"`
+	Timeout   Duration          `toml:"timeout"`
+	// values are fetched again after CacheTTL, 0 means they never expire
+	CacheTTL Duration `toml:"cache_ttl"`
+	tls.ClientConfig
+}
+
+// SecretStore resolves the keys of a secret store
+type SecretStore interface {
+	Get(key string) ([]byte, error)
+	// Dynamic reports whether values may change, their resolvers are then
+	// called on every Secret.Get instead of once at link time
+	Dynamic() bool
+}
+
+var (
+	secretStores     = make(map[string]SecretStore)
+	secretStoresLock sync.RWMutex
+	// guards unlinkedSecrets, inputs may be loaded concurrently by providers
+	unlinkedLock sync.Mutex
+)
+
+// InitSecretStores creates the configured secret stores
+func InitSecretStores(confs []SecretStoreConfig) error {
+	stores := make(map[string]SecretStore, len(confs))
+	for _, c := range confs {
+		if !secretStorePattern.MatchString(c.ID) {
+			return fmt.Errorf("invalid secret store id %q", c.ID)
+		}
+		if _, has := stores[c.ID]; has {
+			return fmt.Errorf("duplicate secret store id %q", c.ID)
+		}
+		store, err := newSecretStore(c)
+		if err != nil {
+			return fmt.Errorf("secret store %s: %v", c.ID, err)
+		}
+		stores[c.ID] = store
+	}
+
+	secretStoresLock.Lock()
+	secretStores = stores
+	secretStoresLock.Unlock()
+	return nil
+}
+
+func newSecretStore(c SecretStoreConfig) (SecretStore, error) {
+	switch c.Type {
+	case SecretStoreFile:
+		return newFileSecretStore(c.Path)
+	case SecretStoreDir:
+		return &dirSecretStore{dir: c.Path}, nil
+	case SecretStoreEnv:
+		return &envSecretStore{prefix: c.Prefix}, nil
+	case SecretStoreEncrypted:
+		return newEncryptedSecretStore(c.Path, c.KeyFile)
+	case SecretStoreHTTP:
+		return newHTTPSecretStore(c)
+	default:
+		return nil, fmt.Errorf("unknown type %q", c.Type)
+	}
+}
+
+// GetSecretStore returns the secret store of id
+func GetSecretStore(id string) (SecretStore, bool) {
+	secretStoresLock.RLock()
+	defer secretStoresLock.RUnlock()
+	s, ok := secretStores[id]
+	return s, ok
+}
+
+// LinkSecrets links the secrets unmarshaled since the last call to their stores
+func LinkSecrets() error {
+	unlinkedLock.Lock()
+	secrets := unlinkedSecrets
+	unlinkedSecrets = make([]*Secret, 0)
+	unlinkedLock.Unlock()
+
+	var errs []string
+	for _, s := range secrets {
+		if err := linkSecret(s); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+func linkSecret(s *Secret) error {
+	resolvers := make(map[string]ResolveFunc)
+	for _, ref := range s.GetUnlinked() {
+		id, key := splitLink(ref)
+		store, ok := GetSecretStore(id)
+		if !ok {
+			return fmt.Errorf("unknown secret store %q in %s", id, ref)
+		}
+		resolvers[ref] = func() ([]byte, bool, error) {
+			v, err := store.Get(key)
+			return v, store.Dynamic(), err
+		}
+	}
+	return s.Link(resolvers)
+}
+
+// linkConfigSecrets resolves the secret references of config.toml
+func linkConfigSecrets() error {
+	var plain []*string
+	for i := range Config.Writers {
+		plain = append(plain, &Config.Writers[i].BasicAuthPass, &Config.Writers[i].SaslPassword)
+	}
+	if Config.Heartbeat != nil {
+		plain = append(plain, &Config.Heartbeat.BasicAuthPass)
+	}
+	if Config.HTTPProviderConfig != nil {
+		plain = append(plain, &Config.HTTPProviderConfig.AuthPassword)
+	}
+	if Config.Update != nil {
+		plain = append(plain, &Config.Update.BasicAuthPass)
+	}
+	if Config.Ibex != nil {
+		plain = append(plain, &Config.Ibex.Token)
+	}
+	for _, v := range plain {
+		if err := resolveSecretString(v); err != nil {
+			return err
+		}
+	}
+	return LinkSecrets()
+}
+
+// resolveSecretString replaces the secret references in a plain string
+// option, the values are resolved once
+func resolveSecretString(v *string) error {
+	if !secretPattern.MatchString(*v) {
+		return nil
+	}
+	s := NewSecret([]byte(*v))
+	defer s.Destroy()
+	if err := linkSecret(&s); err != nil {
+		return err
+	}
+	buf, err := s.Get()
+	if err != nil {
+		return err
+	}
+	*v = buf.String()
+	buf.Destroy()
+	return nil
+}
+
+type fileSecretStore struct {
+	values map[string]string
+}
+
+func newFileSecretStore(path string) (*fileSecretStore, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	s := &fileSecretStore{}
+	if err := json.Unmarshal(data, &s.values); err != nil {
+		return nil, fmt.Errorf("parse %s: %v", path, err)
+	}
+	return s, nil
+}
+
+func (s *fileSecretStore) Get(key string) ([]byte, error) {
+	v, ok := s.values[key]
+	if !ok {
+		return nil, fmt.Errorf("key %q not found", key)
+	}
+	return []byte(v), nil
+}
+
+func (s *fileSecretStore) Dynamic() bool { return false }
+
+// dirSecretStore reads the file named key, the way docker and kubernetes
+// mount secrets, a trailing newline is trimmed
+type dirSecretStore struct {
+	dir string
+}
+
+func (s *dirSecretStore) Get(key string) ([]byte, error) {
+	data, err := os.ReadFile(filepath.Join(s.dir, key))
+	if err != nil {
+		return nil, err
+	}
+	return []byte(strings.TrimRight(string(data), "\r\n")), nil
+}
+
+func (s *dirSecretStore) Dynamic() bool { return false }
+
+type envSecretStore struct {
+	prefix string
+}
+
+func (s *envSecretStore) Get(key string) ([]byte, error) {
+	v, ok := os.LookupEnv(s.prefix + key)
+	if !ok {
+		return nil, fmt.Errorf("environment variable %s not set", s.prefix+key)
+	}
+	return []byte(v), nil
+}
+
+func (s *envSecretStore) Dynamic() bool { return false }
+
+// encryptedSecretStore is a json object of keys and values, encrypted with
+// aes-256-gcm, the file content is the nonce followed by the ciphertext
+type encryptedSecretStore struct {
+	path   string
+	aead   cipher.AEAD
+	values map[string]string
+}
+
+func newEncryptedSecretStore(path, keyFile string) (*encryptedSecretStore, error) {
+	raw, err := os.ReadFile(keyFile)
+	if err != nil {
+		return nil, err
+	}
+	key, err := decodeSecretKey(raw)
+	if err != nil {
+		return nil, fmt.Errorf("key file %s: %v", keyFile, err)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &encryptedSecretStore{path: path, aead: aead, values: make(map[string]string)}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < aead.NonceSize() {
+		return nil, fmt.Errorf("%s is too short", path)
+	}
+	plain, err := aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], nil)
+	if err != nil {
+		return nil, fmt.Errorf("decrypt %s: %v", path, err)
+	}
+	if err := json.Unmarshal(plain, &s.values); err != nil {
+		return nil, fmt.Errorf("parse %s: %v", path, err)
+	}
+	return s, nil
+}
+
+// decodeSecretKey accepts a 32 bytes key, raw or hex or base64 encoded
+func decodeSecretKey(raw []byte) ([]byte, error) {
+	if len(raw) == 32 {
+		return raw, nil
+	}
+	text := strings.TrimSpace(string(raw))
+	if key, err := hex.DecodeString(text); err == nil && len(key) == 32 {
+		return key, nil
+	}
+	if key, err := base64.StdEncoding.DecodeString(text); err == nil && len(key) == 32 {
+		return key, nil
+	}
+	return nil, errors.New("key must be 32 bytes, raw, hex or base64 encoded")
+}
+
+func (s *encryptedSecretStore) Get(key string) ([]byte, error) {
+	v, ok := s.values[key]
+	if !ok {
+		return nil, fmt.Errorf("key %q not found", key)
+	}
+	return []byte(v), nil
+}
+
+func (s *encryptedSecretStore) Dynamic() bool { return false }
+
+// Set stores a value and rewrites the encrypted file
+func (s *encryptedSecretStore) Set(key string, value []byte) error {
+	s.values[key] = string(value)
+	plain, err := json.Marshal(s.values)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, s.aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return err
+	}
+	data := s.aead.Seal(nonce, nonce, plain, nil)
+
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
+
+// SetSecret stores a value in a secret store of the config dir, only encrypted
+// stores support writes. Secret references are not resolved, so a secret can be
+// set before the configuration using it is valid.
+func SetSecret(configDir, id, key string, value []byte) error {
+	c := &ConfigType{}
+	if err := cfg.LoadConfigByDir(configDir, c); err != nil {
+		return fmt.Errorf("failed to load configs of dir: %s err:%s", configDir, err)
+	}
+	for _, sc := range c.SecretStores {
+		if sc.ID != id {
+			continue
+		}
+		if sc.Type != SecretStoreEncrypted {
+			return fmt.Errorf("secret store %q is read only", id)
+		}
+		store, err := newEncryptedSecretStore(sc.Path, sc.KeyFile)
+		if err != nil {
+			return err
+		}
+		return store.Set(key, value)
+	}
+	return fmt.Errorf("unknown secret store %q", id)
+}
+
+// httpSecretStore reads the keys of a secret from a vault compatible kv api
+type httpSecretStore struct {
+	conf   SecretStoreConfig
+	client *http.Client
+
+	sync.Mutex
+	values  map[string]string
+	fetched time.Time
+}
+
+func newHTTPSecretStore(c SecretStoreConfig) (*httpSecretStore, error) {
+	if c.Url == "" {
+		return nil, errors.New("url is required")
+	}
+	if c.KVVersion == 0 {
+		c.KVVersion = 2
+	}
+	if c.Timeout <= 0 {
+		c.Timeout = Duration(5 * time.Second)
+	}
+	tr := &http.Transport{Proxy: http.ProxyFromEnvironment}
+	if c.UseTLS || strings.HasPrefix(c.Url, "https") {
+		c.UseTLS = true
+		tlsConfig, err := c.TLSConfig()
+		if err != nil {
+			return nil, err
+		}
+		tr.TLSClientConfig = tlsConfig
+	}
+	return &httpSecretStore{
+		conf:   c,
+		client: &http.Client{Transport: tr, Timeout: time.Duration(c.Timeout)},
+	}, nil
+}
+
+func (s *httpSecretStore) Dynamic() bool {
+	return s.conf.CacheTTL > 0
+}
+
+func (s *httpSecretStore) Get(key string) ([]byte, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	if s.values == nil || (s.conf.CacheTTL > 0 && time.Since(s.fetched) > time.Duration(s.conf.CacheTTL)) {
+		values, err := s.fetch()
+		if err != nil {
+			// keep serving the previous values while the server is unreachable
+			if s.values == nil {
+				return nil, err
+			}
+			log.Println("W! refresh secret store", s.conf.ID, "got error:", err)
+		} else {
+			s.values = values
+			s.fetched = time.Now()
+		}
+	}
+
+	v, ok := s.values[key]
+	if !ok {
+		return nil, fmt.Errorf("key %q not found", key)
+	}
+	return []byte(v), nil
+}
+
+func (s *httpSecretStore) fetch() (map[string]string, error) {
+	req, err := http.NewRequest(http.MethodGet, s.conf.Url, nil)
+	if err != nil {
+		return nil, err
+	}
+	if s.conf.Token != "" {
+		req.Header.Set("X-Vault-Token", s.conf.Token)
+	}
+	for k, v := range s.conf.Headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("get %s got status code: %d, response body: %s", s.conf.Url, resp.StatusCode, string(body))
+	}
+
+	// kv v1: {"data": {...}}, kv v2: {"data": {"data": {...}}}
+	var v1 struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	var v2 struct {
+		Data struct {
+			Data map[string]interface{} `json:"data"`
+		} `json:"data"`
+	}
+	var data map[string]interface{}
+	if s.conf.KVVersion == 1 {
+		err = json.Unmarshal(body, &v1)
+		data = v1.Data
+	} else {
+		err = json.Unmarshal(body, &v2)
+		data = v2.Data.Data
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	values := make(map[string]string, len(data))
+	for k, v := range data {
+		if str, ok := v.(string); ok {
+			values[k] = str
+		} else {
+			values[k] = fmt.Sprint(v)
+		}
+	}
+	return values, nil
+}
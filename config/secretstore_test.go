@@ -0,0 +1,42 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestEncryptedSecretStore(t *testing.T) {
+	dir := t.TempDir()
+	keyFile := filepath.Join(dir, "key")
+	if err := os.WriteFile(keyFile, []byte(strings.Repeat("ab", 32)+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "secrets.enc")
+
+	store, err := newEncryptedSecretStore(path, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Set("password", []byte("s3cret")); err != nil {
+		t.Fatal(err)
+	}
+
+	// reopen from disk and resolve a reference mixed with clear text
+	if err := InitSecretStores([]SecretStoreConfig{{ID: "local", Type: SecretStoreEncrypted, Path: path, KeyFile: keyFile}}); err != nil {
+		t.Fatal(err)
+	}
+	v := "user:@{local:password}"
+	if err := resolveSecretString(&v); err != nil {
+		t.Fatal(err)
+	}
+	if v != "user:s3cret" {
+		t.Fatalf("unexpected value %q", v)
+	}
+
+	v = "@{local:missing}"
+	if err := resolveSecretString(&v); err == nil {
+		t.Fatal("expected an error for a missing key")
+	}
+}
@@ -1,9 +1,24 @@
 package config
 
+// UpdateConfig polls Url with HEAD requests, a binary is downloaded when the
+// client-version header differs from the running version. The response
+// carries the hex sha256 of the binary in client-sha256 and the base64
+// ed25519 signature of that digest in client-signature, the canary
+// percentage may be set by client-canary-percent.
 type UpdateConfig struct {
-	Enable        bool   `boml:"enable"`
+	Enable        bool   `toml:"enable"`
 	Url           string `toml:"url"`
-	Interval      int64  `toml:"interval"`
+	Interval      int64  `toml:"interval"` // unit: s, default 300
 	BasicAuthUser string `toml:"basic_auth_user"`
 	BasicAuthPass string `toml:"basic_auth_pass"`
+
+	// base64 ed25519 public key verifying client-signature, required
+	PublicKey string `toml:"public_key"`
+	// the new binary must heartbeat, or keep running if heartbeat is
+	// disabled, within HealthTimeout after restart, or the previous binary
+	// is restored. unit: s, default 120
+	HealthTimeout int64 `toml:"health_timeout"`
+	// percentage of hosts upgraded, picked by a hash of their hostname,
+	// all of them if 0
+	CanaryPercent int `toml:"canary_percent"`
 }
@@ -46,7 +46,7 @@ func (ul *UrlLabel) PrepareUrlTemplate() error {
 				value = k + "=" + v
 			}
 		}
-		if Config.DebugMode {
+		if DebugMode() {
 			log.Printf("D! label pair tpl:%s", value)
 		}
 		ul.LabelPairTpl, err = template.New("pair").Parse(value)
@@ -99,7 +99,7 @@ func (ul *UrlLabel) GenerateLabel(u *url.URL) (map[string]string, error) {
 			if len(kvs) != 2 {
 				continue
 			}
-			if Config.DebugMode {
+			if DebugMode() {
 				log.Printf("D! label pairs after rendering: %s=%s", kvs[0], kvs[1])
 			}
 			ret[kvs[0]] = kvs[1]
@@ -0,0 +1,227 @@
+package heartbeat
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"flashcat.cloud/categraf/config"
+)
+
+// commands carried by the heartbeat response
+const (
+	CommandSetLogLevel     = "set_log_level"
+	CommandSetDebug        = "set_debug"
+	CommandReload          = "reload"
+	CommandSetInterval     = "set_interval"
+	CommandSetGlobalLabels = "set_global_labels"
+	// send every section of extend_info in the next heartbeat
+	CommandFullReport = "full_report"
+)
+
+const (
+	AckOK     = "ok"
+	AckFailed = "failed"
+
+	// ids of executed commands are remembered to not run a command twice
+	// when the server resends it before it got the ack
+	maxSeenCommands = 1024
+)
+
+// Command is one directive of the heartbeat response, the fields used
+// depend on Type. Changes are not written to the config files, they are
+// lost when categraf restarts.
+type Command struct {
+	ID   string `json:"id"`
+	Type string `json:"type"`
+	// set_log_level: debug, info, warn or error
+	LogLevel string `json:"log_level,omitempty"`
+	// set_debug
+	Debug bool `json:"debug,omitempty"`
+	// set_interval: global collection interval, unit: s
+	Interval int64 `json:"interval,omitempty"`
+	// set_global_labels: merged into the global labels, labels with an
+	// empty value are removed, or replace all of them if Replace is set
+	Labels  map[string]string `json:"labels,omitempty"`
+	Replace bool              `json:"replace,omitempty"`
+}
+
+// CommandAck reports the result of a command in the next heartbeat
+type CommandAck struct {
+	ID       string `json:"id"`
+	Type     string `json:"type"`
+	Status   string `json:"status"`
+	Error    string `json:"error,omitempty"`
+	Unixtime int64  `json:"unixtime"`
+}
+
+type heartbeatResponse struct {
+	Commands []Command `json:"commands"`
+	Dat      struct {
+		Commands []Command `json:"commands"`
+	} `json:"dat"`
+}
+
+// Reloader restarts the agent modules, see agent.Agent
+type Reloader interface {
+	Reload()
+}
+
+type commander struct {
+	sync.Mutex
+	reloader Reloader
+	acks     []CommandAck
+	seen     map[string]struct{}
+	seenIDs  []string
+}
+
+var commands = &commander{seen: make(map[string]struct{})}
+
+// SetAgent makes the reload and set_interval commands reload ag
+func SetAgent(ag Reloader) {
+	commands.Lock()
+	commands.reloader = ag
+	commands.Unlock()
+}
+
+// pendingAcks returns the acks to send with the next heartbeat
+func (c *commander) pendingAcks() []CommandAck {
+	c.Lock()
+	defer c.Unlock()
+	return append([]CommandAck(nil), c.acks...)
+}
+
+// acked forgets the acks sent, the server received them, acks added since
+// they were taken are kept
+func (c *commander) acked(sent []CommandAck) {
+	if len(sent) == 0 {
+		return
+	}
+	ids := make(map[string]struct{}, len(sent))
+	for _, ack := range sent {
+		ids[ack.ID] = struct{}{}
+	}
+
+	c.Lock()
+	defer c.Unlock()
+	left := c.acks[:0]
+	for _, ack := range c.acks {
+		if _, ok := ids[ack.ID]; !ok {
+			left = append(left, ack)
+		}
+	}
+	c.acks = left
+}
+
+// handle runs the commands of a heartbeat response body
+func (c *commander) handle(body []byte) {
+	var resp heartbeatResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		// servers not sending commands may answer anything
+		return
+	}
+	cmds := append(resp.Commands, resp.Dat.Commands...)
+
+	reload := false
+	for _, cmd := range cmds {
+		if cmd.ID == "" {
+			log.Println("W! heartbeat command without id ignored:", cmd.Type)
+			continue
+		}
+		if c.isSeen(cmd.ID) {
+			continue
+		}
+		err := c.run(cmd, &reload)
+		ack := CommandAck{ID: cmd.ID, Type: cmd.Type, Status: AckOK, Unixtime: time.Now().UnixMilli()}
+		if err != nil {
+			ack.Status = AckFailed
+			ack.Error = err.Error()
+			log.Printf("E! heartbeat command %s(%s) failed: %v", cmd.Type, cmd.ID, err)
+		} else {
+			log.Printf("I! heartbeat command %s(%s) done", cmd.Type, cmd.ID)
+		}
+		c.Lock()
+		c.acks = append(c.acks, ack)
+		c.Unlock()
+	}
+
+	if reload {
+		c.Lock()
+		r := c.reloader
+		c.Unlock()
+		r.Reload()
+	}
+}
+
+// isSeen reports whether id ran already, and remembers it
+func (c *commander) isSeen(id string) bool {
+	c.Lock()
+	defer c.Unlock()
+	if _, ok := c.seen[id]; ok {
+		return true
+	}
+	c.seen[id] = struct{}{}
+	c.seenIDs = append(c.seenIDs, id)
+	if len(c.seenIDs) > maxSeenCommands {
+		delete(c.seen, c.seenIDs[0])
+		c.seenIDs = c.seenIDs[1:]
+	}
+	return false
+}
+
+// run applies cmd, commands needing the agent to restart set reload, which
+// is done once after all commands of the response
+func (c *commander) run(cmd Command, reload *bool) error {
+	switch cmd.Type {
+	case CommandSetLogLevel:
+		return config.SetLogLevel(cmd.LogLevel)
+	case CommandSetDebug:
+		config.SetDebugMode(cmd.Debug)
+		return nil
+	case CommandReload:
+		return c.scheduleReload(reload)
+	case CommandSetInterval:
+		if cmd.Interval <= 0 {
+			return fmt.Errorf("invalid interval %d", cmd.Interval)
+		}
+		if err := c.scheduleReload(reload); err != nil {
+			return err
+		}
+		config.SetInterval(time.Duration(cmd.Interval) * time.Second)
+		return nil
+	case CommandSetGlobalLabels:
+		labels := make(map[string]string, len(cmd.Labels))
+		// commands are the only writer, they run on this goroutine
+		if !cmd.Replace {
+			for k, v := range config.Config.Global.Labels {
+				labels[k] = v
+			}
+		}
+		for k, v := range cmd.Labels {
+			if v == "" {
+				delete(labels, k)
+				continue
+			}
+			labels[k] = v
+		}
+		config.SetGlobalLabels(labels)
+		return nil
+	case CommandFullReport:
+		extendInfo.reset()
+		return nil
+	default:
+		return fmt.Errorf("unknown command type %q", cmd.Type)
+	}
+}
+
+func (c *commander) scheduleReload(reload *bool) error {
+	c.Lock()
+	defer c.Unlock()
+	if c.reloader == nil {
+		return fmt.Errorf("agent not started yet")
+	}
+	*reload = true
+	return nil
+}
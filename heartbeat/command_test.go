@@ -0,0 +1,95 @@
+package heartbeat
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"flashcat.cloud/categraf/config"
+)
+
+type fakeAgent struct{ reloads int }
+
+func (a *fakeAgent) Reload() { a.reloads++ }
+
+func TestCommands(t *testing.T) {
+	config.Config = &config.ConfigType{
+		Global: config.Global{Labels: map[string]string{"region": "bj", "zone": "a"}},
+	}
+	ag := &fakeAgent{}
+	c := &commander{seen: make(map[string]struct{}), reloader: ag}
+
+	body := `{"dat": {"commands": [
+		{"id": "1", "type": "set_interval", "interval": 30},
+		{"id": "2", "type": "reload"},
+		{"id": "3", "type": "set_global_labels", "labels": {"zone": "", "env": "prod"}},
+		{"id": "4", "type": "set_log_level", "log_level": "verbose"},
+		{"id": "5", "type": "set_debug", "debug": true}
+	]}}`
+	c.handle([]byte(body))
+
+	if ag.reloads != 1 {
+		t.Errorf("expected one reload, got %d", ag.reloads)
+	}
+	if config.GetInterval() != 30*time.Second {
+		t.Errorf("unexpected interval %s", config.GetInterval())
+	}
+	labels := config.Config.Global.Labels
+	if len(labels) != 2 || labels["region"] != "bj" || labels["env"] != "prod" {
+		t.Errorf("unexpected labels %v", labels)
+	}
+	if !config.DebugMode() {
+		t.Error("debug mode not set")
+	}
+
+	acks := c.pendingAcks()
+	if len(acks) != 5 {
+		t.Fatalf("expected 5 acks, got %d", len(acks))
+	}
+	for _, ack := range acks {
+		want := AckOK
+		if ack.ID == "4" {
+			want = AckFailed
+		}
+		if ack.Status != want {
+			t.Errorf("command %s: status %s, want %s", ack.ID, ack.Status, want)
+		}
+	}
+
+	// acks of commands run after the heartbeat was sent are kept
+	c.handle([]byte(`{"commands": [{"id": "6", "type": "set_debug"}]}`))
+	c.acked(acks)
+	if left := c.pendingAcks(); len(left) != 1 || left[0].ID != "6" {
+		t.Errorf("unexpected acks left %v", left)
+	}
+
+	// resent commands are not run again
+	c.acked(c.pendingAcks())
+	c.handle([]byte(body))
+	if ag.reloads != 1 || len(c.pendingAcks()) != 0 {
+		t.Errorf("resent commands ran again")
+	}
+}
+
+func TestCommandsWhileGathering(t *testing.T) {
+	config.Config = &config.ConfigType{}
+	config.HostInfo = &config.HostInfoCache{}
+	c := &commander{seen: make(map[string]struct{})}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			_ = config.DebugMode()
+			_ = config.GlobalLabels()
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		c.handle([]byte(fmt.Sprintf(`{"commands": [
+			{"id": "d%d", "type": "set_debug", "debug": true},
+			{"id": "l%d", "type": "set_global_labels", "labels": {"n": "%d"}}
+		]}`, i, i, i)))
+	}
+	<-done
+	config.SetDebugMode(false)
+}
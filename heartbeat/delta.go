@@ -0,0 +1,104 @@
+package heartbeat
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sort"
+	"sync"
+	"time"
+)
+
+const defaultFullReportInterval = time.Hour
+
+// extendInfoEncoder sends every section of extend_info once, then only the
+// sections whose hash changed since the last heartbeat the server accepted.
+// The hash of the whole inventory lets the server detect it missed a delta
+// and ask for a full report with the full_report command.
+type extendInfoEncoder struct {
+	sync.Mutex
+	// hashes of the sections the server has
+	sent     map[string]string
+	lastFull time.Time
+}
+
+var extendInfo = &extendInfoEncoder{}
+
+type extendInfoReport struct {
+	// changed sections, all of them if full
+	sections map[string]interface{}
+	removed  []string
+	hashes   map[string]string
+	hash     string
+	full     bool
+}
+
+func (e *extendInfoEncoder) encode(sections map[string]interface{}, now time.Time, fullInterval time.Duration) (*extendInfoReport, error) {
+	if fullInterval <= 0 {
+		fullInterval = defaultFullReportInterval
+	}
+	r := &extendInfoReport{
+		sections: make(map[string]interface{}),
+		hashes:   make(map[string]string, len(sections)),
+	}
+	for name, section := range sections {
+		bs, err := json.Marshal(section)
+		if err != nil {
+			return nil, err
+		}
+		sum := sha256.Sum256(bs)
+		r.hashes[name] = hex.EncodeToString(sum[:])
+	}
+	r.hash = hashOfHashes(r.hashes)
+
+	e.Lock()
+	defer e.Unlock()
+	r.full = e.sent == nil || now.Sub(e.lastFull) >= fullInterval
+	for name, section := range sections {
+		if r.full || e.sent[name] != r.hashes[name] {
+			r.sections[name] = section
+		}
+	}
+	if !r.full {
+		for name := range e.sent {
+			if _, ok := r.hashes[name]; !ok {
+				r.removed = append(r.removed, name)
+			}
+		}
+		sort.Strings(r.removed)
+	}
+	return r, nil
+}
+
+// commit records what the server received
+func (e *extendInfoEncoder) commit(r *extendInfoReport, now time.Time) {
+	e.Lock()
+	defer e.Unlock()
+	e.sent = r.hashes
+	if r.full {
+		e.lastFull = now
+	}
+}
+
+// reset makes the next report a full one
+func (e *extendInfoEncoder) reset() {
+	e.Lock()
+	e.sent = nil
+	e.Unlock()
+}
+
+func hashOfHashes(hashes map[string]string) string {
+	names := make([]string, 0, len(hashes))
+	for name := range hashes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	h := sha256.New()
+	for _, name := range names {
+		h.Write([]byte(name))
+		h.Write([]byte{':'})
+		h.Write([]byte(hashes[name]))
+		h.Write([]byte{'\n'})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
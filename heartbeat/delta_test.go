@@ -0,0 +1,57 @@
+package heartbeat
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestExtendInfoEncoder(t *testing.T) {
+	e := &extendInfoEncoder{}
+	now := time.Now()
+	sections := map[string]interface{}{
+		"cpu":      map[string]string{"cpu_cores": "8"},
+		"packages": []string{"bash"},
+		"ports":    []int{22},
+	}
+
+	r, err := e.encode(sections, now, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !r.full || len(r.sections) != 3 {
+		t.Fatalf("first report should be full: %+v", r)
+	}
+
+	// not committed, the server did not get it
+	if r, _ = e.encode(sections, now, time.Hour); !r.full {
+		t.Fatal("report should stay full until committed")
+	}
+	e.commit(r, now)
+	hash := r.hash
+
+	sections["packages"] = []string{"bash", "curl"}
+	delete(sections, "ports")
+	r, _ = e.encode(sections, now.Add(time.Minute), time.Hour)
+	if r.full || len(r.sections) != 1 || r.sections["packages"] == nil {
+		t.Fatalf("expected packages only: %+v", r.sections)
+	}
+	if !reflect.DeepEqual(r.removed, []string{"ports"}) {
+		t.Fatalf("unexpected removed sections %v", r.removed)
+	}
+	if r.hash == hash {
+		t.Fatal("hash should change")
+	}
+	e.commit(r, now.Add(time.Minute))
+
+	if r, _ = e.encode(sections, now.Add(2*time.Minute), time.Hour); r.full || len(r.sections) != 0 {
+		t.Fatalf("nothing changed: %+v", r.sections)
+	}
+	if r, _ = e.encode(sections, now.Add(time.Hour), time.Hour); !r.full {
+		t.Fatal("expected a full report after full_report_interval")
+	}
+	e.reset()
+	if r, _ = e.encode(sections, now.Add(2*time.Minute), time.Hour); !r.full {
+		t.Fatal("expected a full report after reset")
+	}
+}
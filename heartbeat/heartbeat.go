@@ -11,6 +11,7 @@ import (
 	"runtime"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"flashcat.cloud/categraf/config"
@@ -20,6 +21,24 @@ import (
 
 const collinterval = 3
 
+// unix time in ms of the last heartbeat accepted by the server
+var lastSuccess atomic.Int64
+
+// LastSuccess returns when the server last accepted a heartbeat, zero if
+// it never did
+func LastSuccess() time.Time {
+	ms := lastSuccess.Load()
+	if ms == 0 {
+		return time.Time{}
+	}
+	return time.UnixMilli(ms)
+}
+
+// Enabled reports whether heartbeats are sent
+func Enabled() bool {
+	return config.Config.Heartbeat != nil && config.Config.Heartbeat.Enable
+}
+
 func Work() {
 	conf := config.Config.Heartbeat
 
@@ -116,8 +135,23 @@ func work(ps *system.SystemPS, client *http.Client) {
 		"busigroup":     config.Config.Global.Labels["busigroup"],
 	}
 
+	var report *extendInfoReport
 	if ext, err := collectSystemInfo(); err == nil {
-		data["extend_info"] = ext
+		if config.Config.Heartbeat.DeltaExtendInfo {
+			fullInterval := time.Duration(config.Config.Heartbeat.FullReportInterval) * time.Second
+			if report, err = extendInfo.encode(ext.sections(), time.Now(), fullInterval); err != nil {
+				log.Println("E! failed to encode extend info:", err)
+			} else {
+				data["extend_info"] = report.sections
+				data["extend_info_hash"] = report.hash
+				data["extend_info_delta"] = !report.full
+				if len(report.removed) > 0 {
+					data["extend_info_removed"] = report.removed
+				}
+			}
+		} else {
+			data["extend_info"] = ext
+		}
 		if cpuInfo, ok := ext.CPU.(map[string]string); ok {
 			cpuNum := cpuInfo["cpu_cores"]
 			if num, err := strconv.Atoi(cpuNum); err == nil {
@@ -128,6 +162,11 @@ func work(ps *system.SystemPS, client *http.Client) {
 		log.Println("E! failed to collect system info:", err)
 	}
 
+	acks := commands.pendingAcks()
+	if len(acks) > 0 {
+		data["command_acks"] = acks
+	}
+
 	bs, err := json.Marshal(data)
 	if err != nil {
 		log.Println("E! failed to marshal heartbeat request:", err)
@@ -145,7 +184,7 @@ func work(ps *system.SystemPS, client *http.Client) {
 		log.Println("E! failed to close gzip buffer:", err)
 		return
 	}
-	if config.Config.DebugMode {
+	if config.DebugMode() {
 		log.Printf("D! heartbeat request: %s", string(bs))
 	}
 
@@ -188,9 +227,18 @@ func work(ps *system.SystemPS, client *http.Client) {
 		return
 	}
 
-	if config.Config.DebugMode {
+	if config.DebugMode() {
 		log.Println("D! heartbeat response:", string(bs), "status code:", res.StatusCode)
 	}
+
+	lastSuccess.Store(time.Now().UnixMilli())
+	commands.acked(acks)
+	if report != nil {
+		extendInfo.commit(report, time.Now())
+	}
+	if config.Config.Heartbeat.EnableCommands {
+		commands.handle(bs)
+	}
 }
 
 func memUsage(ps *system.SystemPS) float64 {
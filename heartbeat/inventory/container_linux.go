@@ -0,0 +1,82 @@
+//go:build linux
+// +build linux
+
+package inventory
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"time"
+)
+
+var runtimeSockets = []struct {
+	name   string
+	socket string
+}{
+	{"docker", "/var/run/docker.sock"},
+	{"containerd", "/run/containerd/containerd.sock"},
+	{"podman", "/run/podman/podman.sock"},
+	{"crio", "/var/run/crio/crio.sock"},
+}
+
+// containerRuntimes lists the runtimes whose socket exists, the version and
+// the running containers are asked to docker compatible apis
+func containerRuntimes() ([]ContainerRuntime, error) {
+	runtimes := []ContainerRuntime{}
+	for _, rs := range runtimeSockets {
+		fi, err := os.Stat(rs.socket)
+		if err != nil || fi.Mode()&os.ModeSocket == 0 {
+			continue
+		}
+		rt := ContainerRuntime{Name: rs.name, Socket: rs.socket}
+		if rs.name == "docker" || rs.name == "podman" {
+			// the runtime may be down, its socket is still reported
+			dockerInfo(&rt)
+		}
+		runtimes = append(runtimes, rt)
+	}
+	return runtimes, nil
+}
+
+func dockerInfo(rt *ContainerRuntime) {
+	client := &http.Client{
+		Timeout: 3 * time.Second,
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", rt.Socket)
+			},
+		},
+	}
+	defer client.CloseIdleConnections()
+
+	var version struct {
+		Version string `json:"Version"`
+	}
+	if err := getJSON(client, "http://runtime/version", &version); err != nil {
+		return
+	}
+	rt.Version = version.Version
+
+	var containers []json.RawMessage
+	if err := getJSON(client, "http://runtime/containers/json", &containers); err != nil {
+		return
+	}
+	rt.Containers = len(containers)
+}
+
+func getJSON(client *http.Client, url string, v interface{}) error {
+	res, err := client.Get(url)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("status code %d", res.StatusCode)
+	}
+	return json.NewDecoder(res.Body).Decode(v)
+}
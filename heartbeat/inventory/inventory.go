@@ -0,0 +1,90 @@
+package inventory
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"time"
+
+	"flashcat.cloud/categraf/pkg/cmdx"
+)
+
+// sections of the inventory
+const (
+	SectionPackages         = "packages"
+	SectionPorts            = "ports"
+	SectionSystemdUnits     = "systemd_units"
+	SectionKernelModules    = "kernel_modules"
+	SectionContainerRuntime = "container_runtime"
+)
+
+const commandTimeout = 10 * time.Second
+
+type Inventory struct{}
+
+const name = "inventory"
+
+func (self *Inventory) Name() string {
+	return name
+}
+
+// Collect returns the sections available on this host, keyed by section
+// name, sections failing to be collected are left out and reported in err
+func (self *Inventory) Collect() (map[string]interface{}, error) {
+	return collectSections()
+}
+
+type Package struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+	Arch    string `json:"arch,omitempty"`
+	// dpkg, rpm or apk
+	Source string `json:"source"`
+}
+
+type Port struct {
+	// tcp, tcp6, udp or udp6
+	Protocol string `json:"protocol"`
+	Address  string `json:"address"`
+	Port     int    `json:"port"`
+	Pid      int    `json:"pid,omitempty"`
+	Process  string `json:"process,omitempty"`
+}
+
+type SystemdUnit struct {
+	Name   string `json:"name"`
+	Load   string `json:"load"`
+	Active string `json:"active"`
+	Sub    string `json:"sub"`
+}
+
+type KernelModule struct {
+	Name     string `json:"name"`
+	Size     int64  `json:"size"`
+	RefCount int    `json:"ref_count"`
+	State    string `json:"state"`
+}
+
+type ContainerRuntime struct {
+	// docker, containerd, podman or crio
+	Name       string `json:"name"`
+	Socket     string `json:"socket"`
+	Version    string `json:"version,omitempty"`
+	Containers int    `json:"containers,omitempty"`
+}
+
+// run returns the stdout of a command, killed after commandTimeout
+func run(name string, args ...string) ([]byte, error) {
+	cmd := exec.Command(name, args...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err, timeout := cmdx.RunTimeout(cmd, commandTimeout)
+	if timeout {
+		return nil, fmt.Errorf("%s timeout", name)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v %s", name, err, bytes.TrimSpace(stderr.Bytes()))
+	}
+	return stdout.Bytes(), nil
+}
@@ -0,0 +1,38 @@
+//go:build linux
+// +build linux
+
+package inventory
+
+import (
+	"fmt"
+	"strings"
+)
+
+func collectSections() (map[string]interface{}, error) {
+	sections := make(map[string]interface{})
+	var errs []string
+
+	collectors := []struct {
+		name    string
+		collect func() (interface{}, error)
+	}{
+		{SectionPackages, func() (interface{}, error) { return packages() }},
+		{SectionPorts, func() (interface{}, error) { return listeningPorts() }},
+		{SectionSystemdUnits, func() (interface{}, error) { return systemdUnits() }},
+		{SectionKernelModules, func() (interface{}, error) { return kernelModules() }},
+		{SectionContainerRuntime, func() (interface{}, error) { return containerRuntimes() }},
+	}
+	for _, c := range collectors {
+		v, err := c.collect()
+		if err != nil {
+			errs = append(errs, c.name+": "+err.Error())
+			continue
+		}
+		sections[c.name] = v
+	}
+
+	if len(errs) > 0 {
+		return sections, fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+	return sections, nil
+}
@@ -0,0 +1,74 @@
+//go:build linux
+// +build linux
+
+package inventory
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseDpkgStatus(t *testing.T) {
+	status := `Package: bash
+Status: install ok installed
+Architecture: amd64
+Version: 5.1-6ubuntu1
+Description: GNU Bourne Again SHell
+ Bash is an sh-compatible command language interpreter.
+
+Package: removed-pkg
+Status: deinstall ok config-files
+Version: 1.0
+
+Package: tzdata
+Status: install ok installed
+Architecture: all
+Version: 2024a-0ubuntu0.22.04
+`
+	got := parseDpkgStatus(strings.NewReader(status))
+	want := []Package{
+		{Name: "bash", Version: "5.1-6ubuntu1", Arch: "amd64", Source: "dpkg"},
+		{Name: "tzdata", Version: "2024a-0ubuntu0.22.04", Arch: "all", Source: "dpkg"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestParseProcNet(t *testing.T) {
+	tcp := `  sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode
+   0: 0100007F:0CEA 00000000:0000 0A 00000000:00000000 00:00000000 00000000   999        0 21345 1 0000000000000000 100 0 0 10 0
+   1: 0100007F:0CEA 0100007F:A1B2 01 00000000:00000000 00:00000000 00000000   999        0 21346 1 0000000000000000 100 0 0 10 0
+`
+	entries, err := parseProcNet(strings.NewReader(tcp), "tcp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("expected the listening socket only, got %d", len(entries))
+	}
+	want := Port{Protocol: "tcp", Address: "127.0.0.1", Port: 3306}
+	if entries[0].port != want || entries[0].inode != "21345" {
+		t.Fatalf("got %+v", entries[0])
+	}
+
+	addr, port, err := parseHexAddr("00000000000000000000000001000000:1F90")
+	if err != nil || addr != "::1" || port != 8080 {
+		t.Fatalf("unexpected ipv6 address %s %d %v", addr, port, err)
+	}
+}
+
+func TestParseSystemctl(t *testing.T) {
+	out := `cron.service loaded active running Regular background program processing daemon
+● nginx.service loaded failed failed A high performance web server
+`
+	got := parseSystemctl(out)
+	want := []SystemdUnit{
+		{Name: "cron.service", Load: "loaded", Active: "active", Sub: "running"},
+		{Name: "nginx.service", Load: "loaded", Active: "failed", Sub: "failed"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,8 @@
+//go:build !linux
+// +build !linux
+
+package inventory
+
+func collectSections() (map[string]interface{}, error) {
+	return map[string]interface{}{}, nil
+}
@@ -0,0 +1,48 @@
+//go:build linux
+// +build linux
+
+package inventory
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// kernelModules lists the loaded modules of /proc/modules
+func kernelModules() ([]KernelModule, error) {
+	f, err := os.Open(filepath.Join(procRoot, "modules"))
+	if err != nil {
+		// kernels without module support
+		if os.IsNotExist(err) {
+			return []KernelModule{}, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+	return parseModules(f)
+}
+
+// parseModules parses "name size refcount deps state address" lines
+func parseModules(r io.Reader) ([]KernelModule, error) {
+	modules := []KernelModule{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 5 {
+			continue
+		}
+		size, _ := strconv.ParseInt(fields[1], 10, 64)
+		refs, _ := strconv.Atoi(fields[2])
+		modules = append(modules, KernelModule{
+			Name:     fields[0],
+			Size:     size,
+			RefCount: refs,
+			State:    fields[4],
+		})
+	}
+	return modules, scanner.Err()
+}
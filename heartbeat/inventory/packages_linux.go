@@ -0,0 +1,152 @@
+//go:build linux
+// +build linux
+
+package inventory
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+)
+
+var (
+	dpkgStatus   = "/var/lib/dpkg/status"
+	apkInstalled = "/lib/apk/db/installed"
+	rpmDBDir     = "/var/lib/rpm"
+)
+
+// packages lists the installed packages. The dpkg and apk databases are
+// plain text and parsed directly, the rpm database is berkeley db, ndb or
+// sqlite depending on the distribution, so it is queried with rpm.
+func packages() ([]Package, error) {
+	var pkgs []Package
+
+	if f, err := os.Open(dpkgStatus); err == nil {
+		pkgs = append(pkgs, parseDpkgStatus(f)...)
+		f.Close()
+	}
+
+	if f, err := os.Open(apkInstalled); err == nil {
+		pkgs = append(pkgs, parseApkInstalled(f)...)
+		f.Close()
+	}
+
+	if _, err := os.Stat(rpmDBDir); err == nil {
+		if _, err := exec.LookPath("rpm"); err == nil {
+			out, err := run("rpm", "-qa", "--queryformat", `%{NAME}\t%{VERSION}-%{RELEASE}\t%{ARCH}\n`)
+			if err != nil {
+				return nil, err
+			}
+			pkgs = append(pkgs, parseRpmOutput(string(out))...)
+		}
+	}
+
+	sort.Slice(pkgs, func(i, j int) bool {
+		if pkgs[i].Name != pkgs[j].Name {
+			return pkgs[i].Name < pkgs[j].Name
+		}
+		return pkgs[i].Arch < pkgs[j].Arch
+	})
+	return pkgs, nil
+}
+
+// parseDpkgStatus parses the stanzas of /var/lib/dpkg/status, only the
+// packages whose status is installed are returned
+func parseDpkgStatus(r io.Reader) []Package {
+	var (
+		pkgs   []Package
+		cur    Package
+		status string
+	)
+	flush := func() {
+		if cur.Name != "" && strings.HasSuffix(status, " installed") {
+			cur.Source = "dpkg"
+			pkgs = append(pkgs, cur)
+		}
+		cur, status = Package{}, ""
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			flush()
+			continue
+		}
+		// continuation of a multi-line field
+		if line[0] == ' ' || line[0] == '\t' {
+			continue
+		}
+		kv := strings.SplitN(line, ":", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		value := strings.TrimSpace(kv[1])
+		switch kv[0] {
+		case "Package":
+			cur.Name = value
+		case "Version":
+			cur.Version = value
+		case "Architecture":
+			cur.Arch = value
+		case "Status":
+			status = value
+		}
+	}
+	flush()
+	return pkgs
+}
+
+// parseApkInstalled parses /lib/apk/db/installed, P: is the name, V: the
+// version and A: the architecture of a package
+func parseApkInstalled(r io.Reader) []Package {
+	var (
+		pkgs []Package
+		cur  Package
+	)
+	flush := func() {
+		if cur.Name != "" {
+			cur.Source = "apk"
+			pkgs = append(pkgs, cur)
+		}
+		cur = Package{}
+	}
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			flush()
+			continue
+		}
+		if len(line) < 2 || line[1] != ':' {
+			continue
+		}
+		switch line[0] {
+		case 'P':
+			cur.Name = line[2:]
+		case 'V':
+			cur.Version = line[2:]
+		case 'A':
+			cur.Arch = line[2:]
+		}
+	}
+	flush()
+	return pkgs
+}
+
+func parseRpmOutput(out string) []Package {
+	var pkgs []Package
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Split(line, "\t")
+		if len(fields) != 3 || fields[0] == "" || strings.HasPrefix(fields[0], "gpg-pubkey") {
+			continue
+		}
+		pkgs = append(pkgs, Package{Name: fields[0], Version: fields[1], Arch: fields[2], Source: "rpm"})
+	}
+	return pkgs
+}
@@ -0,0 +1,185 @@
+//go:build linux
+// +build linux
+
+package inventory
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var procRoot = "/proc"
+
+const tcpListen = "0A"
+
+// listeningPorts lists the listening tcp sockets and the bound udp sockets
+// of /proc/net, with the process owning them when it is visible
+func listeningPorts() ([]Port, error) {
+	var (
+		ports  []Port
+		inodes = make(map[string][]int)
+	)
+
+	for _, proto := range []string{"tcp", "tcp6", "udp", "udp6"} {
+		f, err := os.Open(filepath.Join(procRoot, "net", proto))
+		if err != nil {
+			// ipv6 disabled
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, err
+		}
+		entries, err := parseProcNet(f, proto)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", proto, err)
+		}
+		for _, e := range entries {
+			inodes[e.inode] = append(inodes[e.inode], len(ports))
+			ports = append(ports, e.port)
+		}
+	}
+
+	owners := socketOwners(inodes)
+	for inode, idxs := range inodes {
+		if pid, ok := owners[inode]; ok {
+			process := processName(pid)
+			for _, i := range idxs {
+				ports[i].Pid = pid
+				ports[i].Process = process
+			}
+		}
+	}
+
+	// sockets bound with SO_REUSEPORT appear several times
+	sort.Slice(ports, func(i, j int) bool {
+		a, b := ports[i], ports[j]
+		if a.Protocol != b.Protocol {
+			return a.Protocol < b.Protocol
+		}
+		if a.Port != b.Port {
+			return a.Port < b.Port
+		}
+		if a.Address != b.Address {
+			return a.Address < b.Address
+		}
+		return a.Pid < b.Pid
+	})
+	uniq := ports[:0]
+	for i, p := range ports {
+		if i > 0 && p == ports[i-1] {
+			continue
+		}
+		uniq = append(uniq, p)
+	}
+	return uniq, nil
+}
+
+type procNetEntry struct {
+	port  Port
+	inode string
+}
+
+// parseProcNet parses the format of /proc/net/{tcp,tcp6,udp,udp6}
+func parseProcNet(r io.Reader, proto string) ([]procNetEntry, error) {
+	var entries []procNetEntry
+	scanner := bufio.NewScanner(r)
+	// header
+	scanner.Scan()
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 10 {
+			continue
+		}
+		local, remote, state, inode := fields[1], fields[2], fields[3], fields[9]
+		if strings.HasPrefix(proto, "tcp") && state != tcpListen {
+			continue
+		}
+		// connected udp sockets are clients
+		if strings.HasPrefix(proto, "udp") && !strings.HasSuffix(remote, ":0000") {
+			continue
+		}
+		addr, port, err := parseHexAddr(local)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, procNetEntry{
+			port:  Port{Protocol: proto, Address: addr, Port: port},
+			inode: inode,
+		})
+	}
+	return entries, scanner.Err()
+}
+
+// parseHexAddr parses "0100007F:0035", the address is made of 32 bits words
+// in host byte order, the port is big endian
+func parseHexAddr(s string) (string, int, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) != 2 {
+		return "", 0, fmt.Errorf("invalid address %q", s)
+	}
+	ip, err := hex.DecodeString(parts[0])
+	if err != nil || (len(ip) != net.IPv4len && len(ip) != net.IPv6len) {
+		return "", 0, fmt.Errorf("invalid address %q", s)
+	}
+	for i := 0; i < len(ip); i += 4 {
+		ip[i], ip[i+1], ip[i+2], ip[i+3] = ip[i+3], ip[i+2], ip[i+1], ip[i]
+	}
+	port, err := strconv.ParseUint(parts[1], 16, 16)
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid port %q", s)
+	}
+	return net.IP(ip).String(), int(port), nil
+}
+
+// socketOwners maps the socket inodes to the pid holding them
+func socketOwners(inodes map[string][]int) map[string]int {
+	owners := make(map[string]int)
+	dirs, err := os.ReadDir(procRoot)
+	if err != nil {
+		return owners
+	}
+	for _, d := range dirs {
+		pid, err := strconv.Atoi(d.Name())
+		if err != nil {
+			continue
+		}
+		fdDir := filepath.Join(procRoot, d.Name(), "fd")
+		fds, err := os.ReadDir(fdDir)
+		if err != nil {
+			continue
+		}
+		for _, fd := range fds {
+			link, err := os.Readlink(filepath.Join(fdDir, fd.Name()))
+			if err != nil || !strings.HasPrefix(link, "socket:[") {
+				continue
+			}
+			inode := link[len("socket:[") : len(link)-1]
+			if _, ok := inodes[inode]; ok {
+				if _, found := owners[inode]; !found {
+					owners[inode] = pid
+				}
+			}
+		}
+		if len(owners) == len(inodes) {
+			break
+		}
+	}
+	return owners
+}
+
+func processName(pid int) string {
+	bs, err := os.ReadFile(filepath.Join(procRoot, strconv.Itoa(pid), "comm"))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(bs))
+}
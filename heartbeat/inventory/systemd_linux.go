@@ -0,0 +1,49 @@
+//go:build linux
+// +build linux
+
+package inventory
+
+import (
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// systemdUnits lists the service units known to systemd, empty on hosts
+// not booted with systemd
+func systemdUnits() ([]SystemdUnit, error) {
+	if _, err := os.Stat("/run/systemd/system"); err != nil {
+		return []SystemdUnit{}, nil
+	}
+	if _, err := exec.LookPath("systemctl"); err != nil {
+		return []SystemdUnit{}, nil
+	}
+	out, err := run("systemctl", "list-units", "--type=service", "--all", "--no-legend", "--no-pager", "--plain")
+	if err != nil {
+		return nil, err
+	}
+	return parseSystemctl(string(out)), nil
+}
+
+// parseSystemctl parses the "UNIT LOAD ACTIVE SUB DESCRIPTION" lines of
+// systemctl list-units
+func parseSystemctl(out string) []SystemdUnit {
+	units := []SystemdUnit{}
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		// failed units are marked with a leading bullet without --plain
+		if len(fields) > 0 && !strings.Contains(fields[0], ".") {
+			fields = fields[1:]
+		}
+		if len(fields) < 4 {
+			continue
+		}
+		units = append(units, SystemdUnit{
+			Name:   fields[0],
+			Load:   fields[1],
+			Active: fields[2],
+			Sub:    fields[3],
+		})
+	}
+	return units
+}
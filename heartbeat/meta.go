@@ -2,10 +2,13 @@ package heartbeat
 
 import (
 	"log"
+	"sync"
 	"time"
 
+	"flashcat.cloud/categraf/config"
 	"flashcat.cloud/categraf/heartbeat/cpu"
 	"flashcat.cloud/categraf/heartbeat/filesystem"
+	"flashcat.cloud/categraf/heartbeat/inventory"
 	"flashcat.cloud/categraf/heartbeat/memory"
 	"flashcat.cloud/categraf/heartbeat/network"
 	"flashcat.cloud/categraf/heartbeat/platform"
@@ -18,11 +21,50 @@ type (
 		Network    interface{} `json:"network"`
 		Platform   interface{} `json:"platform"`
 		Filesystem interface{} `json:"filesystem"`
+
+		// inventory, see heartbeat.inventory
+		Packages         interface{} `json:"packages,omitempty"`
+		Ports            interface{} `json:"ports,omitempty"`
+		SystemdUnits     interface{} `json:"systemd_units,omitempty"`
+		KernelModules    interface{} `json:"kernel_modules,omitempty"`
+		ContainerRuntime interface{} `json:"container_runtime,omitempty"`
 	}
 )
 
 var meta *SystemInfo
 
+// the inventory is slower to collect and changes less often than the rest
+// of the system info, it is refreshed every inventoryInterval
+const inventoryInterval = 5 * time.Minute
+
+var (
+	inventoryLock      sync.Mutex
+	inventorySections  map[string]interface{}
+	inventoryCollected time.Time
+)
+
+// sections returns the non empty sections by their json name
+func (info *SystemInfo) sections() map[string]interface{} {
+	all := map[string]interface{}{
+		"cpu":                             info.CPU,
+		"memory":                          info.Memory,
+		"network":                         info.Network,
+		"platform":                        info.Platform,
+		"filesystem":                      info.Filesystem,
+		inventory.SectionPackages:         info.Packages,
+		inventory.SectionPorts:            info.Ports,
+		inventory.SectionSystemdUnits:     info.SystemdUnits,
+		inventory.SectionKernelModules:    info.KernelModules,
+		inventory.SectionContainerRuntime: info.ContainerRuntime,
+	}
+	for name, section := range all {
+		if section == nil {
+			delete(all, name)
+		}
+	}
+	return all
+}
+
 func collectSystemInfo() (*SystemInfo, error) {
 	if meta != nil {
 		return meta, nil
@@ -75,11 +117,35 @@ func collect() (*SystemInfo, error) {
 		return nil, err
 	}
 
-	return &SystemInfo{
+	info := &SystemInfo{
 		CPU:        cpuInfo,
 		Memory:     memInfo,
 		Filesystem: fs,
 		Network:    net,
 		Platform:   pl,
-	}, nil
+	}
+	if config.Config.Heartbeat.Inventory {
+		collectInventory(info)
+	}
+	return info, nil
+}
+
+func collectInventory(info *SystemInfo) {
+	inventoryLock.Lock()
+	defer inventoryLock.Unlock()
+
+	if inventorySections == nil || time.Since(inventoryCollected) >= inventoryInterval {
+		sections, err := new(inventory.Inventory).Collect()
+		if err != nil {
+			log.Println("W! failed to collect inventory:", err)
+		}
+		inventorySections = sections
+		inventoryCollected = time.Now()
+	}
+
+	info.Packages = inventorySections[inventory.SectionPackages]
+	info.Ports = inventorySections[inventory.SectionPorts]
+	info.SystemdUnits = inventorySections[inventory.SectionSystemdUnits]
+	info.KernelModules = inventorySections[inventory.SectionKernelModules]
+	info.ContainerRuntime = inventorySections[inventory.SectionContainerRuntime]
 }
@@ -0,0 +1,133 @@
+//go:build !no_ibex && linux
+
+package ibex
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"flashcat.cloud/categraf/config"
+)
+
+const (
+	cgroupMount = "/sys/fs/cgroup"
+	cpuPeriod   = 100000
+)
+
+// cgroup is the cgroup v2 of one task
+type cgroup struct {
+	dir string
+}
+
+// newCgroup creates the cgroup name under the cgroup root with the limits
+// of sb
+func newCgroup(sb *config.IbexSandbox, name string) (*cgroup, error) {
+	if _, err := os.Stat(filepath.Join(cgroupMount, "cgroup.controllers")); err != nil {
+		return nil, fmt.Errorf("cgroup v2 is not mounted at %s", cgroupMount)
+	}
+
+	var controllers []string
+	if sb.CPUQuota > 0 {
+		controllers = append(controllers, "+cpu")
+	}
+	if sb.MemoryMax > 0 {
+		controllers = append(controllers, "+memory")
+	}
+	if sb.PidsMax > 0 {
+		controllers = append(controllers, "+pids")
+	}
+
+	root := sb.CgroupRoot
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return nil, err
+	}
+	// the controllers must be enabled in the parents of the task cgroup
+	for _, dir := range []string{filepath.Dir(root), root} {
+		if err := writeCgroupFile(dir, "cgroup.subtree_control", strings.Join(controllers, " ")); err != nil {
+			return nil, err
+		}
+	}
+
+	c := &cgroup{dir: filepath.Join(root, name)}
+	// left by a previous run of the task
+	os.Remove(c.dir)
+	if err := os.Mkdir(c.dir, 0755); err != nil {
+		return nil, err
+	}
+
+	var err error
+	if sb.CPUQuota > 0 {
+		err = writeCgroupFile(c.dir, "cpu.max", fmt.Sprintf("%d %d", int64(sb.CPUQuota*cpuPeriod), cpuPeriod))
+	}
+	if err == nil && sb.MemoryMax > 0 {
+		err = writeCgroupFile(c.dir, "memory.max", strconv.FormatInt(sb.MemoryMax*1024*1024, 10))
+	}
+	if err == nil && sb.PidsMax > 0 {
+		err = writeCgroupFile(c.dir, "pids.max", strconv.FormatInt(sb.PidsMax, 10))
+	}
+	if err != nil {
+		c.remove()
+		return nil, err
+	}
+	return c, nil
+}
+
+func writeCgroupFile(dir, name, value string) error {
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(value), 0644); err != nil {
+		return fmt.Errorf("write %q to %s: %w", value, filepath.Join(dir, name), err)
+	}
+	return nil
+}
+
+// wrap returns a command joining the cgroup before it execs cmd, so no
+// process of the task starts outside of it
+func (c *cgroup) wrap(cmd *exec.Cmd) *exec.Cmd {
+	args := append([]string{"-c", `echo $$ > "$0" && exec "$@"`, filepath.Join(c.dir, "cgroup.procs")}, cmd.Args...)
+	wrapped := exec.Command("sh", args...)
+	wrapped.Dir = cmd.Dir
+	wrapped.Env = cmd.Env
+	return wrapped
+}
+
+// kill kills every process of the cgroup, including those which left the
+// process group of the task
+func (c *cgroup) kill() error {
+	err := writeCgroupFile(c.dir, "cgroup.kill", "1")
+	// cgroup.kill requires linux 5.14
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// oomKilled reports whether a process was killed by the memory limit
+func (c *cgroup) oomKilled() bool {
+	bs, err := os.ReadFile(filepath.Join(c.dir, "memory.events"))
+	if err != nil {
+		return false
+	}
+	for _, line := range strings.Split(string(bs), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 2 && fields[0] == "oom_kill" {
+			n, _ := strconv.Atoi(fields[1])
+			return n > 0
+		}
+	}
+	return false
+}
+
+// remove deletes the cgroup once its processes exited
+func (c *cgroup) remove() {
+	for i := 0; i < 20; i++ {
+		if err := os.Remove(c.dir); err == nil || os.IsNotExist(err) {
+			return
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
@@ -0,0 +1,13 @@
+//go:build !no_ibex && linux
+
+package ibex
+
+import "testing"
+
+func TestCgroupKillWithoutCgroupKillFile(t *testing.T) {
+	// kernels before 5.14 have no cgroup.kill, the process group kill is enough
+	c := &cgroup{dir: t.TempDir() + "/missing"}
+	if err := c.kill(); err != nil {
+		t.Fatalf("kill without cgroup.kill: %v", err)
+	}
+}
@@ -0,0 +1,24 @@
+//go:build !no_ibex && !linux
+
+package ibex
+
+import (
+	"fmt"
+	"os/exec"
+
+	"flashcat.cloud/categraf/config"
+)
+
+type cgroup struct{}
+
+func newCgroup(sb *config.IbexSandbox, name string) (*cgroup, error) {
+	return nil, fmt.Errorf("cgroup limits are supported on linux only")
+}
+
+func (c *cgroup) wrap(cmd *exec.Cmd) *exec.Cmd { return cmd }
+
+func (c *cgroup) kill() error { return nil }
+
+func (c *cgroup) oomKilled() bool { return false }
+
+func (c *cgroup) remove() {}
@@ -20,11 +20,18 @@ import (
 	"flashcat.cloud/categraf/ibex/types"
 )
 
-var cli *gobrpc.RPCClient
+var (
+	cli        *gobrpc.RPCClient
+	selectedAt time.Time
+)
 
 func getCli() *gobrpc.RPCClient {
 	if cli != nil {
-		return cli
+		if time.Since(selectedAt) < time.Duration(config.Config.Ibex.ReselectInterval) {
+			return cli
+		}
+		// a faster or recovered server may be available
+		CloseCli()
 	}
 
 	// detect the fastest server
@@ -91,6 +98,7 @@ func getCli() *gobrpc.RPCClient {
 	}
 
 	cli = gobrpc.NewRPCClient(address, client, 5*time.Second)
+	selectedAt = time.Now()
 	return cli
 }
 
@@ -114,26 +122,31 @@ func CloseCli() {
 	}
 }
 
-// Meta 从Server端获取任务元信息
-func Meta(id int64) (script string, args string, account string, stdin string, err error) {
-	var resp types.TaskMetaResponse
-	err = GetCli().Call("Server.GetTaskMeta", id, &resp)
-	if err != nil {
-		log.Println("E! rpc call Server.GetTaskMeta:", err)
+// rpcTransport calls the servers with msgpack rpc over plain tcp
+type rpcTransport struct{}
+
+func (rpcTransport) Report(req types.ReportRequest) (*types.ReportResponse, error) {
+	var resp types.ReportResponse
+	if err := GetCli().Call("Server.Report", req, &resp); err != nil {
 		CloseCli()
-		return
+		return nil, fmt.Errorf("rpc call Server.Report fail: %v", err)
 	}
+	return &resp, nil
+}
 
-	if resp.Message != "" {
-		log.Println("E! rpc call Server.GetTaskMeta:", resp.Message)
-		err = fmt.Errorf(resp.Message)
-		return
+func (rpcTransport) Meta(id int64) (*types.TaskMetaResponse, error) {
+	var resp types.TaskMetaResponse
+	if err := GetCli().Call("Server.GetTaskMeta", id, &resp); err != nil {
+		CloseCli()
+		return nil, err
 	}
+	return &resp, nil
+}
 
-	script = resp.Script
-	args = resp.Args
-	account = resp.Account
-	stdin = resp.Stdin
+func (rpcTransport) Output(types.TaskOutput) error {
+	return ErrNotSupported
+}
 
-	return
+func (rpcTransport) Close() {
+	CloseCli()
 }
@@ -0,0 +1,105 @@
+//go:build !no_ibex
+
+package client
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+
+	"flashcat.cloud/categraf/config"
+	"flashcat.cloud/categraf/ibex/types"
+)
+
+// ErrNotSupported is returned by transports not implementing a call
+var ErrNotSupported = errors.New("not supported by the transport")
+
+// Transport talks to the ibex servers, it picks the fastest one, probes
+// them again every reselect_interval and fails over when a call fails
+type Transport interface {
+	Report(req types.ReportRequest) (*types.ReportResponse, error)
+	Meta(id int64) (*types.TaskMetaResponse, error)
+	// Output sends the output written by a running task since the last call
+	Output(out types.TaskOutput) error
+	Close()
+}
+
+var (
+	lock      sync.Mutex
+	transport Transport
+)
+
+func getTransport() (Transport, error) {
+	lock.Lock()
+	defer lock.Unlock()
+	if transport != nil {
+		return transport, nil
+	}
+	switch config.Config.Ibex.Transport {
+	case config.IbexTransportHTTP:
+		t, err := newHTTPTransport(config.Config.Ibex)
+		if err != nil {
+			return nil, err
+		}
+		transport = t
+	default:
+		transport = rpcTransport{}
+	}
+	return transport, nil
+}
+
+// Close closes the connections to the servers
+func Close() {
+	lock.Lock()
+	defer lock.Unlock()
+	if transport != nil {
+		transport.Close()
+		transport = nil
+	}
+}
+
+// Report sends the results of the finished tasks and returns the tasks
+// assigned to this host
+func Report(req types.ReportRequest) (*types.ReportResponse, error) {
+	t, err := getTransport()
+	if err != nil {
+		return nil, err
+	}
+	return t.Report(req)
+}
+
+// Output sends the output of a running task
+func Output(out types.TaskOutput) error {
+	t, err := getTransport()
+	if err != nil {
+		return err
+	}
+	return t.Output(out)
+}
+
+// Meta 从Server端获取任务元信息
+func Meta(id int64) (script string, args string, account string, stdin string, err error) {
+	t, err := getTransport()
+	if err != nil {
+		return
+	}
+	resp, err := t.Meta(id)
+	if err != nil {
+		log.Println("E! call Server.GetTaskMeta:", err)
+		return
+	}
+
+	if resp.Message != "" {
+		log.Println("E! call Server.GetTaskMeta:", resp.Message)
+		err = fmt.Errorf(resp.Message)
+		return
+	}
+
+	script = resp.Script
+	args = resp.Args
+	account = resp.Account
+	stdin = resp.Stdin
+
+	return
+}
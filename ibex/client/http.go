@@ -0,0 +1,217 @@
+//go:build !no_ibex
+
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"flashcat.cloud/categraf/config"
+	"flashcat.cloud/categraf/ibex/types"
+)
+
+// paths of the http transport, relative to the server url
+const (
+	pathPing   = "/ibex/v1/ping"
+	pathReport = "/ibex/v1/report"
+	pathMeta   = "/ibex/v1/task/%d/meta"
+	pathOutput = "/ibex/v1/task/%d/output"
+)
+
+// httpTransport posts json to the servers, with mutual tls when a client
+// certificate is configured, and a bearer token
+type httpTransport struct {
+	sync.Mutex
+	servers  []string
+	token    string
+	reselect time.Duration
+	client   *http.Client
+
+	current    string
+	selectedAt time.Time
+}
+
+func newHTTPTransport(c *config.IbexConfig) (*httpTransport, error) {
+	tlsCfg, err := c.TLSConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to init ibex tls: %v", err)
+	}
+	servers := make([]string, len(c.Servers))
+	for i, s := range c.Servers {
+		if !strings.HasPrefix(s, "http://") && !strings.HasPrefix(s, "https://") {
+			return nil, fmt.Errorf("ibex server %q is not an http url", s)
+		}
+		servers[i] = strings.TrimRight(s, "/")
+	}
+	return &httpTransport{
+		servers:  servers,
+		token:    c.Token,
+		reselect: time.Duration(c.ReselectInterval),
+		client: &http.Client{
+			Timeout: 30 * time.Second,
+			Transport: &http.Transport{
+				Proxy:               http.ProxyFromEnvironment,
+				DialContext:         (&net.Dialer{Timeout: 5 * time.Second}).DialContext,
+				TLSClientConfig:     tlsCfg,
+				TLSHandshakeTimeout: 5 * time.Second,
+				MaxIdleConnsPerHost: 2,
+			},
+		},
+	}, nil
+}
+
+// a server slower than this to answer a ping is not selected
+var pingTimeout = 5 * time.Second
+
+// server returns the server to call, the fastest to answer a ping. Servers
+// are pinged in parallel without holding the lock.
+func (h *httpTransport) server() (string, error) {
+	h.Lock()
+	if h.current != "" && time.Since(h.selectedAt) < h.reselect {
+		defer h.Unlock()
+		return h.current, nil
+	}
+	h.Unlock()
+
+	durations := make([]time.Duration, len(h.servers))
+	var wg sync.WaitGroup
+	for i, s := range h.servers {
+		wg.Add(1)
+		go func(i int, s string) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(context.Background(), pingTimeout)
+			defer cancel()
+			begin := time.Now()
+			if err := h.call(ctx, s, http.MethodGet, pathPing, nil, nil); err != nil {
+				log.Printf("W! ping %s fail: %s", s, err)
+				durations[i] = -1
+				return
+			}
+			durations[i] = time.Since(begin)
+		}(i, s)
+	}
+	wg.Wait()
+
+	var (
+		address  string
+		duration = time.Duration(math.MaxInt64)
+	)
+	for i, s := range h.servers {
+		if use := durations[i]; use >= 0 && use < duration {
+			address, duration = s, use
+		}
+	}
+	if address == "" {
+		return "", fmt.Errorf("no job server found")
+	}
+
+	h.Lock()
+	defer h.Unlock()
+	if address != h.current {
+		log.Printf("I! choose server: %s, duration: %dms", address, duration.Milliseconds())
+	}
+	h.current = address
+	h.selectedAt = time.Now()
+	return address, nil
+}
+
+// do calls the selected server, the servers are probed again and the call
+// retried once on another server when it fails
+func (h *httpTransport) do(method, path string, in, out interface{}) error {
+	var err error
+	for i := 0; i < 2; i++ {
+		var s string
+		if s, err = h.server(); err != nil {
+			return err
+		}
+		if err = h.call(context.Background(), s, method, path, in, out); err == nil {
+			return nil
+		}
+		log.Printf("W! call %s%s fail: %v", s, path, err)
+		h.Lock()
+		if h.current == s {
+			h.current = ""
+		}
+		h.Unlock()
+	}
+	return err
+}
+
+func (h *httpTransport) call(ctx context.Context, server, method, path string, in, out interface{}) error {
+	var body io.Reader
+	if in != nil {
+		bs, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(bs)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, server+path, body)
+	if err != nil {
+		return err
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if h.token != "" {
+		req.Header.Set("Authorization", "Bearer "+h.token)
+	}
+
+	res, err := h.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	bs, err := io.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+	if res.StatusCode/100 != 2 {
+		return fmt.Errorf("status code: %d, response: %s", res.StatusCode, bs)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.Unmarshal(bs, out)
+}
+
+func (h *httpTransport) Report(req types.ReportRequest) (*types.ReportResponse, error) {
+	var resp types.ReportResponse
+	if err := h.do(http.MethodPost, pathReport, req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (h *httpTransport) Meta(id int64) (*types.TaskMetaResponse, error) {
+	var resp types.TaskMetaResponse
+	if err := h.do(http.MethodGet, fmt.Sprintf(pathMeta, id), nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (h *httpTransport) Output(out types.TaskOutput) error {
+	var resp types.OutputResponse
+	if err := h.do(http.MethodPost, fmt.Sprintf(pathOutput, out.Id), out, &resp); err != nil {
+		return err
+	}
+	if resp.Message != "" {
+		return fmt.Errorf("%s", resp.Message)
+	}
+	return nil
+}
+
+func (h *httpTransport) Close() {
+	h.client.CloseIdleConnections()
+}
@@ -0,0 +1,95 @@
+//go:build !no_ibex
+
+package client
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"flashcat.cloud/categraf/config"
+	"flashcat.cloud/categraf/ibex/types"
+)
+
+func TestHTTPTransportFailover(t *testing.T) {
+	var down bool
+	newServer := func(name string, fail *bool) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Authorization") != "Bearer secret" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			if fail != nil && *fail {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			if r.URL.Path == pathReport {
+				json.NewEncoder(w).Encode(types.ReportResponse{Message: name})
+			}
+		}))
+	}
+	first := newServer("first", &down)
+	defer first.Close()
+	second := newServer("second", nil)
+	defer second.Close()
+
+	h, err := newHTTPTransport(&config.IbexConfig{
+		Servers:          []string{first.URL, second.URL},
+		Token:            "secret",
+		ReselectInterval: config.Duration(time.Hour),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// pin the first server, then take it down
+	h.current, h.selectedAt = first.URL, time.Now()
+	if resp, err := h.Report(types.ReportRequest{}); err != nil || resp.Message != "first" {
+		t.Fatalf("got %v %v", resp, err)
+	}
+	down = true
+	if resp, err := h.Report(types.ReportRequest{}); err != nil || resp.Message != "second" {
+		t.Fatalf("got %v %v", resp, err)
+	}
+	if h.current != second.URL {
+		t.Fatalf("current %s, want %s", h.current, second.URL)
+	}
+
+	h.token = "wrong"
+	h.current = ""
+	if _, err := h.Report(types.ReportRequest{}); err == nil {
+		t.Fatal("expected an error with a wrong token")
+	}
+}
+
+func TestHTTPTransportPingTimeout(t *testing.T) {
+	defer func(old time.Duration) { pingTimeout = old }(pingTimeout)
+	pingTimeout = 100 * time.Millisecond
+
+	release := make(chan struct{})
+	hung := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer hung.Close()
+	defer close(release)
+	fast := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer fast.Close()
+
+	h, err := newHTTPTransport(&config.IbexConfig{
+		Servers:          []string{hung.URL, hung.URL, fast.URL},
+		ReselectInterval: config.Duration(time.Hour),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	begin := time.Now()
+	s, err := h.server()
+	if err != nil || s != fast.URL {
+		t.Fatalf("got %s %v, want %s", s, err, fast.URL)
+	}
+	// the hung servers are pinged in parallel, each up to the ping timeout
+	if use := time.Since(begin); use > time.Second {
+		t.Fatalf("selecting a server took %s", use)
+	}
+}
@@ -18,12 +18,18 @@ import (
 func heartbeatCron(ctx context.Context, ib *config.IbexConfig) {
 	log.Println("I! ibex agent start rolling request Server.Report.")
 	interval := time.Duration(ib.Interval)
+	var lastStream time.Time
 	for {
 		select {
 		case <-ctx.Done():
+			client.Close()
 			return
 		case <-time.After(interval):
 			heartbeat()
+			if ib.OutputInterval > 0 && time.Since(lastStream) >= time.Duration(ib.OutputInterval) {
+				streamOutputs()
+				lastStream = time.Now()
+			}
 		}
 	}
 }
@@ -35,12 +41,9 @@ func heartbeat() {
 		ReportTasks: Locals.ReportTasks(),
 	}
 
-	var resp types.ReportResponse
-	err := client.GetCli().Call("Server.Report", req, &resp)
-
+	resp, err := client.Report(req)
 	if err != nil {
-		log.Println("E! rpc call Server.Report fail:", err)
-		client.CloseCli()
+		log.Println("E! report to server fail:", err)
 		return
 	}
 
@@ -67,6 +70,39 @@ func heartbeat() {
 	Locals.Clean(assigned)
 }
 
+// streamOutputs sends the output written by the running tasks since the
+// previous call, the full output is still reported once they are done
+func streamOutputs() {
+	ident := config.Config.GetHostname()
+	for id, t := range Locals.M {
+		if t.GetStatus() != "running" {
+			continue
+		}
+		stdout, stdoutEnd := t.Stdout.since(t.streamedStdout)
+		stderr, stderrEnd := t.Stderr.since(t.streamedStderr)
+		if stdout == "" && stderr == "" {
+			continue
+		}
+		err := client.Output(types.TaskOutput{
+			Ident:        ident,
+			Id:           id,
+			Clock:        t.Clock,
+			Stdout:       stdout,
+			Stderr:       stderr,
+			StdoutOffset: t.streamedStdout,
+			StderrOffset: t.streamedStderr,
+		})
+		if err == client.ErrNotSupported {
+			return
+		}
+		if err != nil {
+			log.Printf("E! send output of task[%d] fail: %v", id, err)
+			return
+		}
+		t.streamedStdout, t.streamedStderr = stdoutEnd, stderrEnd
+	}
+}
+
 func mapKeys(m map[int64]struct{}) []int64 {
 	lst := make([]int64, 0, len(m))
 	for k := range m {
@@ -0,0 +1,92 @@
+//go:build !no_ibex
+
+package ibex
+
+import (
+	"fmt"
+	"sync"
+)
+
+// output captures stdout or stderr of a task. Once max bytes are written,
+// it keeps the first and the last max/2 bytes, the bytes between them are
+// replaced by a truncation marker. max 0 keeps everything.
+type output struct {
+	sync.Mutex
+	max       int
+	head      []byte
+	tail      []byte
+	truncated int64
+	// bytes written in total
+	written int64
+}
+
+func (o *output) Write(p []byte) (int, error) {
+	o.Lock()
+	defer o.Unlock()
+
+	n := len(p)
+	o.written += int64(n)
+	if o.max <= 0 || len(o.tail) == 0 && len(o.head)+len(p) <= o.max {
+		o.head = append(o.head, p...)
+		return n, nil
+	}
+
+	half := o.max / 2
+	if len(o.head) > half {
+		// first overflow, the end of head becomes the tail
+		o.tail = append(o.tail, o.head[half:]...)
+		o.head = o.head[:half:half]
+	}
+	o.tail = append(o.tail, p...)
+	if over := len(o.tail) - (o.max - half); over > 0 {
+		o.truncated += int64(over)
+		o.tail = o.tail[over:]
+	}
+	return n, nil
+}
+
+func (o *output) String() string {
+	o.Lock()
+	defer o.Unlock()
+	if o.truncated == 0 {
+		return string(o.head) + string(o.tail)
+	}
+	return fmt.Sprintf("%s%s%s", o.head, truncationMarker(o.truncated), o.tail)
+}
+
+func truncationMarker(n int64) string {
+	return fmt.Sprintf("\n...[categraf: %d bytes truncated]...\n", n)
+}
+
+// since returns what was written after offset, with a truncation marker
+// for the bytes dropped since, and the offset of the end
+func (o *output) since(offset int64) (string, int64) {
+	o.Lock()
+	defer o.Unlock()
+
+	var b []byte
+	if offset < int64(len(o.head)) {
+		b = append(b, o.head[offset:]...)
+		offset = int64(len(o.head))
+	}
+	tailStart := o.written - int64(len(o.tail))
+	if offset < tailStart {
+		b = append(b, truncationMarker(tailStart-offset)...)
+		offset = tailStart
+	}
+	b = append(b, o.tail[offset-tailStart:]...)
+	return string(b), o.written
+}
+
+func (o *output) Reset() {
+	o.Lock()
+	o.head, o.tail, o.truncated, o.written = nil, nil, 0, 0
+	o.Unlock()
+}
+
+// set replaces the content, e.g. with the output persisted by a previous run
+func (o *output) set(s string) {
+	o.Lock()
+	o.head, o.tail, o.truncated, o.written = []byte(s), nil, 0, int64(len(s))
+	o.Unlock()
+}
@@ -0,0 +1,64 @@
+//go:build !no_ibex
+
+package ibex
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+
+	"flashcat.cloud/categraf/config"
+)
+
+// checkPolicy refuses the tasks whose account or script is denied, or not
+// allowed when an allow list is set
+func checkPolicy(sb *config.IbexSandbox, account, scriptFile string) error {
+	if !permitted(account, sb.AllowAccounts, sb.DenyAccounts) {
+		return fmt.Errorf("account %q is not allowed", account)
+	}
+	if len(sb.AllowScriptHashes) == 0 && len(sb.DenyScriptHashes) == 0 {
+		return nil
+	}
+	sum, err := scriptHash(scriptFile)
+	if err != nil {
+		return err
+	}
+	if !permitted(sum, sb.AllowScriptHashes, sb.DenyScriptHashes) {
+		return fmt.Errorf("script sha256 %s is not allowed", sum)
+	}
+	return nil
+}
+
+func permitted(v string, allow, deny []string) bool {
+	for _, d := range deny {
+		if strings.EqualFold(d, v) {
+			return false
+		}
+	}
+	if len(allow) == 0 {
+		return true
+	}
+	for _, a := range allow {
+		if strings.EqualFold(a, v) {
+			return true
+		}
+	}
+	return false
+}
+
+// scriptHash returns the hex sha256 of the script as sent by the server,
+// without the line prepended to batch files
+func scriptHash(scriptFile string) (string, error) {
+	bs, err := os.ReadFile(scriptFile)
+	if err != nil {
+		return "", err
+	}
+	if runtime.GOOS == "windows" {
+		bs = []byte(strings.TrimPrefix(string(bs), windowsScriptHeader))
+	}
+	sum := sha256.Sum256(bs)
+	return hex.EncodeToString(sum[:]), nil
+}
@@ -0,0 +1,84 @@
+//go:build !no_ibex
+
+package ibex
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"flashcat.cloud/categraf/config"
+)
+
+func TestOutputTruncation(t *testing.T) {
+	o := &output{max: 10}
+	o.Write([]byte("0123"))
+	o.Write([]byte("456"))
+	if got := o.String(); got != "0123456" {
+		t.Fatalf("got %q", got)
+	}
+	o.Write([]byte("789abcdef"))
+	got := o.String()
+	if !strings.HasPrefix(got, "01234\n") || !strings.HasSuffix(got, "\nbcdef") || !strings.Contains(got, "6 bytes truncated") {
+		t.Fatalf("got %q", got)
+	}
+	o.Write([]byte("XY"))
+	if got := o.String(); !strings.HasSuffix(got, "\ndefXY") || !strings.Contains(got, "8 bytes truncated") {
+		t.Fatalf("got %q", got)
+	}
+}
+
+func TestCheckPolicy(t *testing.T) {
+	script := filepath.Join(t.TempDir(), "script")
+	if err := os.WriteFile(script, []byte("echo hello\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256([]byte("echo hello\n"))
+	hash := hex.EncodeToString(sum[:])
+
+	sb := &config.IbexSandbox{}
+	if err := checkPolicy(sb, "root", script); err != nil {
+		t.Fatalf("no lists should allow everything: %v", err)
+	}
+
+	sb = &config.IbexSandbox{AllowAccounts: []string{"deploy", "root"}, DenyAccounts: []string{"root"}}
+	if err := checkPolicy(sb, "root", script); err == nil {
+		t.Error("denied account allowed")
+	}
+	if err := checkPolicy(sb, "nobody", script); err == nil {
+		t.Error("account not in allow list allowed")
+	}
+	if err := checkPolicy(sb, "deploy", script); err != nil {
+		t.Errorf("allowed account refused: %v", err)
+	}
+
+	sb = &config.IbexSandbox{AllowScriptHashes: []string{strings.ToUpper(hash)}}
+	if err := checkPolicy(sb, "root", script); err != nil {
+		t.Errorf("allowed script refused: %v", err)
+	}
+	sb = &config.IbexSandbox{DenyScriptHashes: []string{hash}}
+	if err := checkPolicy(sb, "root", script); err == nil {
+		t.Error("denied script allowed")
+	}
+}
+
+func TestOutputSince(t *testing.T) {
+	o := &output{max: 10}
+	o.Write([]byte("0123"))
+	s, off := o.since(0)
+	if s != "0123" || off != 4 {
+		t.Fatalf("got %q %d", s, off)
+	}
+	o.Write([]byte("456789abcdef"))
+	s, off = o.since(off)
+	if s != "\n...[categraf: 7 bytes truncated]...\nbcdef" || off != 16 {
+		t.Fatalf("got %q %d", s, off)
+	}
+	o.Write([]byte("XY"))
+	if s, off = o.since(off); s != "XY" || off != 18 {
+		t.Fatalf("got %q %d", s, off)
+	}
+}
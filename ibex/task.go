@@ -13,6 +13,7 @@ import (
 	"runtime"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/toolkits/pkg/file"
 	"github.com/toolkits/pkg/sys"
@@ -21,6 +22,8 @@ import (
 	"flashcat.cloud/categraf/ibex/client"
 )
 
+const windowsScriptHeader = "@echo off\r\n"
+
 type Task struct {
 	sync.Mutex
 
@@ -31,10 +34,18 @@ type Task struct {
 
 	alive  bool
 	Cmd    *exec.Cmd
-	Stdout bytes.Buffer
-	Stderr bytes.Buffer
+	Stdout output
+	Stderr output
 	Stdin  *bytes.Reader
 
+	cgroup   *cgroup
+	timer    *time.Timer
+	timedOut bool
+
+	// offsets of the output already streamed to the server
+	streamedStdout int64
+	streamedStderr int64
+
 	Args     string
 	Account  string
 	StdinStr string
@@ -114,8 +125,8 @@ func (t *Task) loadResult() {
 		log.Printf("E! read file %s fail %v", stderrFile, err)
 	}
 
-	t.Stdout = *bytes.NewBufferString(stdout)
-	t.Stderr = *bytes.NewBufferString(stderr)
+	t.Stdout.set(stdout)
+	t.Stderr.set(stderr)
 }
 
 func (t *Task) prepare() error {
@@ -170,7 +181,7 @@ func (t *Task) prepare() error {
 		switch runtime.GOOS {
 		case "windows":
 			scriptFile := filepath.Join(IdDir, "script.bat")
-			_, err = file.WriteString(scriptFile, fmt.Sprintf("@echo off\r\n%s", script))
+			_, err = file.WriteString(scriptFile, windowsScriptHeader+script)
 			if err != nil {
 				log.Printf("E! write script to %s fail: %v", scriptFile, err)
 				return err
@@ -253,6 +264,17 @@ func (t *Task) start() {
 		return
 	}
 
+	sb := &config.Config.Ibex.Sandbox
+	if err := checkPolicy(sb, t.Account, scriptFile); err != nil {
+		log.Printf("W! task[%d] refused: %v", t.Id, err)
+		fmt.Fprintf(&t.Stderr, "[categraf] task refused: %v\n", err)
+		t.SetStatus("failed")
+		persistResult(t)
+		return
+	}
+	t.Stdout.max = sb.MaxOutputSize
+	t.Stderr.max = sb.MaxOutputSize
+
 	sh := fmt.Sprintf("%s %s", scriptFile, args)
 	var cmd *exec.Cmd
 
@@ -281,6 +303,20 @@ func (t *Task) start() {
 		}
 	}
 
+	if sb.CgroupEnabled() {
+		cg, err := newCgroup(sb, fmt.Sprintf("task-%d-%d", t.Id, t.Clock))
+		if err != nil {
+			// the limits are asked for, the task does not run without them
+			log.Printf("E! cannot create cgroup of task[%d]: %v", t.Id, err)
+			fmt.Fprintf(&t.Stderr, "[categraf] cannot apply resource limits: %v\n", err)
+			t.SetStatus("failed")
+			persistResult(t)
+			return
+		}
+		t.cgroup = cg
+		cmd = cg.wrap(cmd)
+	}
+
 	cmd.Stdout = &t.Stdout
 	cmd.Stderr = &t.Stderr
 	cmd.Stdin = t.Stdin
@@ -289,12 +325,36 @@ func (t *Task) start() {
 	err = CmdStart(cmd)
 	if err != nil {
 		log.Printf("E! cannot start cmd of task[%d]: %v", t.Id, err)
+		if t.cgroup != nil {
+			t.cgroup.remove()
+		}
 		return
 	}
 
+	if sb.Timeout > 0 {
+		timeout := time.Duration(sb.Timeout)
+		t.timer = time.AfterFunc(timeout, func() { t.timeout(timeout) })
+	}
+
 	go runProcess(t)
 }
 
+// timeout kills the task, with every process it started
+func (t *Task) timeout(d time.Duration) {
+	t.Lock()
+	t.timedOut = true
+	t.Unlock()
+
+	log.Printf("W! task[%d] running longer than %s, killing it", t.Id, d)
+	fmt.Fprintf(&t.Stderr, "\n[categraf] killed after timeout %s\n", d)
+	if err := CmdKill(t.Cmd); err != nil {
+		log.Printf("E! kill process of task[%d] fail: %v", t.Id, err)
+	}
+	if t.cgroup != nil {
+		t.cgroup.kill()
+	}
+}
+
 func (t *Task) kill() {
 	go killProcess(t)
 }
@@ -304,8 +364,25 @@ func runProcess(t *Task) {
 	defer t.SetAlive(false)
 
 	err := t.Cmd.Wait()
+	if t.timer != nil {
+		t.timer.Stop()
+	}
+	if t.cgroup != nil {
+		if t.cgroup.oomKilled() {
+			fmt.Fprintf(&t.Stderr, "\n[categraf] killed by the memory limit of %dMB\n", config.Config.Ibex.Sandbox.MemoryMax)
+		}
+		t.cgroup.remove()
+	}
+
+	t.Lock()
+	timedOut := t.timedOut
+	t.Unlock()
+
 	if err != nil {
-		if strings.Contains(err.Error(), "signal: killed") {
+		if timedOut {
+			t.SetStatus("timeout")
+			log.Printf("D! process of task[%d] timeout", t.Id)
+		} else if strings.Contains(err.Error(), "signal: killed") {
 			t.SetStatus("killed")
 			log.Printf("D! process of task[%d] killed", t.Id)
 		} else if strings.Contains(err.Error(), "signal: terminated") {
@@ -343,6 +420,11 @@ func killProcess(t *Task) {
 	log.Printf("D! begin kill process of task[%d]", t.Id)
 
 	err := CmdKill(t.Cmd)
+	if t.cgroup != nil {
+		if cerr := t.cgroup.kill(); err == nil {
+			err = cerr
+		}
+	}
 	if err != nil {
 		t.SetStatus("killfailed")
 		log.Printf("D! kill process of task[%d] fail: %v", t.Id, err)
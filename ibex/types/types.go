@@ -33,3 +33,19 @@ type ReportResponse struct {
 	Message     string
 	AssignTasks []AssignTask
 }
+
+// TaskOutput is the output a running task wrote since the previous one,
+// Offsets are the positions of Stdout and Stderr in the whole outputs
+type TaskOutput struct {
+	Ident        string
+	Id           int64
+	Clock        int64
+	Stdout       string
+	Stderr       string
+	StdoutOffset int64
+	StderrOffset int64
+}
+
+type OutputResponse struct {
+	Message string
+}
@@ -0,0 +1,120 @@
+package inputs
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/toolkits/pkg/file"
+
+	"flashcat.cloud/categraf/config"
+	"flashcat.cloud/categraf/pkg/cfg"
+)
+
+// CheckConfig validates config.toml and every input.* dir of the local
+// provider without initializing or gathering any input. Inputs not built into
+// this binary are skipped by the agent too, they are returned as warnings.
+func CheckConfig(c *config.ConfigType) (problems, warnings []string) {
+	keys, err := unknownMainKeys(c.ConfigDir)
+	if err != nil {
+		problems = append(problems, fmt.Sprintf("config: %v", err))
+	}
+	for _, k := range keys {
+		problems = append(problems, fmt.Sprintf("config: unknown key %s", k))
+	}
+
+	lp, _ := newLocalProvider(c, nil)
+	if _, err := lp.LoadConfig(); err != nil {
+		return append(problems, err.Error()), warnings
+	}
+	names, _ := lp.GetInputs()
+	for _, name := range names {
+		creator, has := InputCreators[name]
+		if !has {
+			warnings = append(warnings, fmt.Sprintf("input %s: not supported by this build, skipped", name))
+			continue
+		}
+		configs, err := lp.GetInputConfig(name)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("input %s: %v", name, err))
+			continue
+		}
+		for _, p := range checkInput(creator, configs) {
+			problems = append(problems, fmt.Sprintf("input %s: %s", name, p))
+		}
+	}
+	return problems, warnings
+}
+
+func unknownMainKeys(configDir string) ([]string, error) {
+	files, err := file.FilesUnder(configDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list files under: %s : %v", configDir, err)
+	}
+	configs := make([]cfg.ConfigWithFormat, 0, len(files))
+	for _, f := range files {
+		if !strings.HasSuffix(f, ".toml") {
+			continue
+		}
+		bs, err := file.ReadBytes(path.Join(configDir, f))
+		if err != nil {
+			return nil, err
+		}
+		configs = append(configs, cfg.ConfigWithFormat{Config: string(bs), Format: cfg.TomlFormat})
+	}
+	return cfg.UndecodedKeys(configs, &config.ConfigType{})
+}
+
+// checkInput decodes configs into a fresh input, compiles its internal
+// configs and validates the inputs and instances implementing Validator.
+// Init and Drop are not called as they start real collectors, settings only
+// checked by Init are not validated.
+func checkInput(creator Creator, configs []cfg.ConfigWithFormat) []string {
+	var problems []string
+	keys, err := cfg.UndecodedKeys(configs, creator())
+	if err != nil {
+		return []string{err.Error()}
+	}
+	for _, k := range keys {
+		problems = append(problems, fmt.Sprintf("unknown key %s", k))
+	}
+
+	input := creator()
+	if err := cfg.LoadConfigs(configs, input); err != nil {
+		return append(problems, err.Error())
+	}
+	if err := config.LinkSecrets(); err != nil {
+		problems = append(problems, err.Error())
+	}
+
+	instances := MayGetInstances(input)
+	seen := make(map[string]int, len(instances))
+	for i := range instances {
+		bs, err := json.Marshal(instances[i])
+		if err != nil {
+			continue
+		}
+		if j, ok := seen[string(bs)]; ok {
+			problems = append(problems, fmt.Sprintf("instances[%d] duplicates instances[%d]", i, j))
+			continue
+		}
+		seen[string(bs)] = i
+	}
+
+	if err := input.InitInternalConfig(); err != nil {
+		problems = append(problems, err.Error())
+	}
+	if err := MayValidate(input); err != nil {
+		problems = append(problems, err.Error())
+	}
+	for i := range instances {
+		if err := instances[i].InitInternalConfig(); err != nil {
+			problems = append(problems, fmt.Sprintf("instances[%d]: %v", i, err))
+		}
+		if err := MayValidate(instances[i]); err != nil {
+			problems = append(problems, fmt.Sprintf("instances[%d]: %v", i, err))
+		}
+	}
+	return problems
+}
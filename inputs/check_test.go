@@ -0,0 +1,57 @@
+package inputs
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"flashcat.cloud/categraf/config"
+	"flashcat.cloud/categraf/pkg/cfg"
+)
+
+type checkedInput struct {
+	config.PluginConfig
+	Instances []*checkedInstance `toml:"instances"`
+}
+
+func (c *checkedInput) Clone() Input { return &checkedInput{} }
+func (c *checkedInput) Name() string { return "checked" }
+
+func (c *checkedInput) GetInstances() []Instance {
+	ret := make([]Instance, len(c.Instances))
+	for i := range c.Instances {
+		ret[i] = c.Instances[i]
+	}
+	return ret
+}
+
+type checkedInstance struct {
+	config.InstanceConfig
+	Target string `toml:"target"`
+}
+
+func (ins *checkedInstance) Validate() error {
+	if ins.Target == "" {
+		return fmt.Errorf("target required")
+	}
+	return nil
+}
+
+// Init would connect, it must not be called by the check
+func (ins *checkedInstance) Init() error {
+	panic("Init called")
+}
+
+func TestCheckInputValidates(t *testing.T) {
+	config.Config = &config.ConfigType{}
+	configs := []cfg.ConfigWithFormat{{Format: cfg.TomlFormat, Config: `
+[[instances]]
+target = "a"
+[[instances]]
+labels = { x = "y" }
+`}}
+	problems := checkInput(func() Input { return &checkedInput{} }, configs)
+	if len(problems) != 1 || !strings.Contains(problems[0], "instances[1]: target required") {
+		t.Fatalf("unexpected problems: %v", problems)
+	}
+}
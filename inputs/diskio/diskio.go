@@ -79,11 +79,12 @@ func (d *DiskIO) Gather(slist *types.SampleList) {
 			"write_time":       io.WriteTime,
 			"io_time":          io.IoTime,
 			"weighted_io_time": io.WeightedIO,
-			"iops_in_progress": io.IopsInProgress,
 			"merged_reads":     io.MergedReadCount,
 			"merged_writes":    io.MergedWriteCount,
 		}
 
-		slist.PushSamples("diskio", fields, map[string]string{"name": io.Name})
+		tags := map[string]string{"name": io.Name}
+		slist.PushCounters("diskio", fields, tags)
+		slist.PushSample("diskio", "iops_in_progress", io.IopsInProgress, tags)
 	}
 }
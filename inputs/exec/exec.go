@@ -62,6 +62,14 @@ func (e *Exec) GetInstances() []inputs.Instance {
 	return ret
 }
 
+// Validate checks data_format is supported
+func (ins *Instance) Validate() error {
+	if ins.DataFormat == "" || ins.DataFormat == "influx" || ins.DataFormat == "falcon" || strings.HasPrefix(ins.DataFormat, "prom") {
+		return nil
+	}
+	return fmt.Errorf("data_format(%s) not supported", ins.DataFormat)
+}
+
 func (ins *Instance) Init() error {
 	if len(ins.Commands) == 0 {
 		return types.ErrInstancesEmpty
@@ -0,0 +1,50 @@
+package inputs
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// GatherStats is the outcome of the last gather of an input, Instance is the
+// index of the instance or empty for the input itself
+type GatherStats struct {
+	Instance   string        `json:"instance"`
+	LastGather time.Time     `json:"last_gather"`
+	Duration   time.Duration `json:"duration"`
+	Samples    int           `json:"samples"`
+	Error      string        `json:"error,omitempty"`
+	// panics recovered since the input started
+	Panics uint64 `json:"panics"`
+	// gathers which exceeded the gather timeout
+	Timeouts uint64 `json:"timeouts"`
+	// gathers skipped because the previous one was still running
+	Skipped uint64 `json:"skipped"`
+	// still running past the gather timeout
+	Stuck bool `json:"stuck"`
+}
+
+// InputHealth describes the gathers of one running input
+type InputHealth struct {
+	Name      string        `json:"name"`
+	Instances []GatherStats `json:"instances"`
+	// scheduled runs skipped since the input started, because a gather
+	// lasted longer than the interval
+	Skipped uint64 `json:"skipped"`
+}
+
+var healthFunc atomic.Value
+
+// SetHealthFunc registers the function reporting the health of running
+// inputs, it is set by the metrics agent
+func SetHealthFunc(f func() []InputHealth) {
+	healthFunc.Store(f)
+}
+
+// Health returns the health of all running inputs
+func Health() []InputHealth {
+	f, ok := healthFunc.Load().(func() []InputHealth)
+	if !ok {
+		return nil
+	}
+	return f()
+}
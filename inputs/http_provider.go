@@ -332,7 +332,7 @@ func (hrp *HTTPProvider) caculateDiff(newConfigs map[string]map[string]*cfg.Conf
 	cache := newInnerCache()
 	for inputKey, configs := range newConfigs {
 		for _, inputConfig := range configs {
-			if config.Config.DebugMode {
+			if config.DebugMode() {
 				log.Println("D!: inputKey:", inputKey, "config sum:", inputConfig.CheckSum())
 			}
 			cache.put(inputKey, *inputConfig)
@@ -345,20 +345,20 @@ func (hrp *HTTPProvider) caculateDiff(newConfigs map[string]map[string]*cfg.Conf
 			old := set.NewWithLoad[string, cfg.ConfigWithFormat](oldConfigMap)
 			add, _, del := new.Diff(old)
 			for sum := range add {
-				if config.Config.DebugMode {
+				if config.DebugMode() {
 					log.Println("D!: add config:", inputKey, "config sum:", sum)
 				}
 				hrp.add.put(inputKey, configMap[sum])
 			}
 			for sum := range del {
-				if config.Config.DebugMode {
+				if config.DebugMode() {
 					log.Println("D!: delete config:", inputKey, "config sum:", sum)
 				}
 				hrp.del.put(inputKey, oldConfigMap[sum])
 			}
 		} else {
 			for _, inputConfig := range configMap {
-				if config.Config.DebugMode {
+				if config.DebugMode() {
 					log.Println("D!: add config:", inputKey, "config sum:", inputConfig.CheckSum())
 				}
 				hrp.add.put(inputKey, inputConfig)
@@ -369,7 +369,7 @@ func (hrp *HTTPProvider) caculateDiff(newConfigs map[string]map[string]*cfg.Conf
 	for inputKey, configMap := range hrp.cache.iter() {
 		if _, has := cache.get(inputKey); !has {
 			for _, inputConfig := range configMap {
-				if config.Config.DebugMode {
+				if config.DebugMode() {
 					log.Println("D!: delete config:", inputKey, "config sum:", inputConfig.CheckSum())
 				}
 				hrp.del.put(inputKey, inputConfig)
@@ -391,7 +391,7 @@ func (hrp *HTTPProvider) LoadInputConfig(configs []cfg.ConfigWithFormat, input I
 		err := cfg.LoadSingleConfig(c, nInput)
 		if err != nil {
 			log.Println("E! load http config error:", err)
-			if config.Config.DebugMode {
+			if config.DebugMode() {
 				log.Printf("D! config:%+v load error:%s", c, err)
 			}
 			continue
@@ -60,10 +60,34 @@ type httpClient interface {
 	Do(req *http.Request) (*http.Response, error)
 }
 
+// Validate checks the targets are http urls and the expected response
+// regular expression compiles
+func (ins *Instance) Validate() error {
+	for _, target := range ins.Targets {
+		addr, err := url.Parse(target)
+		if err != nil {
+			return fmt.Errorf("failed to parse http url: %s, error: %v", target, err)
+		}
+
+		if addr.Scheme != "http" && addr.Scheme != "https" {
+			return fmt.Errorf("only http and https are supported, target: %s", target)
+		}
+	}
+	if len(ins.ExpectResponseRegularExpression) > 0 {
+		if _, err := regexp.Compile(ins.ExpectResponseRegularExpression); err != nil {
+			return fmt.Errorf("invalid expect_response_regular_expression: %v", err)
+		}
+	}
+	return nil
+}
+
 func (ins *Instance) Init() error {
 	if len(ins.Targets) == 0 {
 		return types.ErrInstancesEmpty
 	}
+	if err := ins.Validate(); err != nil {
+		return err
+	}
 
 	if ins.ResponseTimeout < config.Duration(time.Second) {
 		ins.ResponseTimeout = config.Duration(time.Second * 3)
@@ -78,16 +102,6 @@ func (ins *Instance) Init() error {
 
 	ins.client = client
 
-	for _, target := range ins.Targets {
-		addr, err := url.Parse(target)
-		if err != nil {
-			return fmt.Errorf("failed to parse http url: %s, error: %v", target, err)
-		}
-
-		if addr.Scheme != "http" && addr.Scheme != "https" {
-			return fmt.Errorf("only http and https are supported, target: %s", target)
-		}
-	}
 	if ins.HTTPCommonConfig.Headers == nil {
 		ins.HTTPCommonConfig.Headers = make(map[string]string)
 	}
@@ -185,7 +199,7 @@ func (ins *Instance) Gather(slist *types.SampleList) {
 }
 
 func (ins *Instance) gather(slist *types.SampleList, target string) {
-	if config.Config.DebugMode {
+	if config.DebugMode() {
 		log.Println("D! http_response... target:", target)
 	}
 
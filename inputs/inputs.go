@@ -1,6 +1,9 @@
 package inputs
 
 import (
+	"context"
+	"time"
+
 	"flashcat.cloud/categraf/config"
 	"flashcat.cloud/categraf/types"
 )
@@ -13,6 +16,12 @@ type SampleGatherer interface {
 	Gather(*types.SampleList)
 }
 
+// ContextGatherer is implemented by inputs which stop gathering when the
+// deadline of the context is exceeded
+type ContextGatherer interface {
+	GatherContext(context.Context, *types.SampleList)
+}
+
 type Dropper interface {
 	Drop()
 }
@@ -21,6 +30,34 @@ type InstancesGetter interface {
 	GetInstances() []Instance
 }
 
+type GatherTimeoutGetter interface {
+	GetGatherTimeout() time.Duration
+}
+
+type ScheduleGetter interface {
+	GetSchedule() (jitter, offset time.Duration, round bool)
+}
+
+// Validator checks the settings of an input or an instance without opening
+// connections or starting anything, it is run by --check-config which does
+// not call Init
+type Validator interface {
+	Validate() error
+}
+
+// ResettingGatherer is implemented by inputs whose gathers consume what they
+// collected, e.g. counters reset on every gather, they are not gathered out
+// of schedule
+type ResettingGatherer interface {
+	GatherResets() bool
+}
+
+// StatelessProcessor processes samples without the processors keeping state
+// between gathers, such as processor_rate
+type StatelessProcessor interface {
+	ProcessStateless(*types.SampleList) *types.SampleList
+}
+
 func MayInit(t interface{}) error {
 	if initializer, ok := t.(Initializer); ok {
 		return initializer.Init()
@@ -34,12 +71,64 @@ func MayGather(t interface{}, slist *types.SampleList) {
 	}
 }
 
+// MayGatherContext gathers with ctx if supported, the deadline of ctx is
+// otherwise enforced by the caller only
+func MayGatherContext(ctx context.Context, t interface{}, slist *types.SampleList) {
+	if gather, ok := t.(ContextGatherer); ok {
+		gather.GatherContext(ctx, slist)
+		return
+	}
+	MayGather(t, slist)
+}
+
+func MayValidate(t interface{}) error {
+	if validator, ok := t.(Validator); ok {
+		return validator.Validate()
+	}
+	return nil
+}
+
+// MayGatherResets reports whether gathers of t reset its state
+func MayGatherResets(t interface{}) bool {
+	if g, ok := t.(ResettingGatherer); ok {
+		return g.GatherResets()
+	}
+	return false
+}
+
+// MayProcessStateless processes slist without stateful processors if
+// supported, samples are left unprocessed otherwise
+func MayProcessStateless(t interface{}, slist *types.SampleList) *types.SampleList {
+	if p, ok := t.(StatelessProcessor); ok {
+		return p.ProcessStateless(slist)
+	}
+	return slist
+}
+
 func MayDrop(t interface{}) {
 	if dropper, ok := t.(Dropper); ok {
 		dropper.Drop()
 	}
 }
 
+// MayGetGatherTimeout returns the gather deadline of the input, 0 if unset
+func MayGetGatherTimeout(t interface{}) time.Duration {
+	if getter, ok := t.(GatherTimeoutGetter); ok {
+		return getter.GetGatherTimeout()
+	}
+	return time.Duration(config.Config.Global.GatherTimeout)
+}
+
+// MayGetSchedule returns the schedule options of the input, those of [global]
+// if it has none
+func MayGetSchedule(t interface{}) (jitter, offset time.Duration, round bool) {
+	if scheduleGetter, ok := t.(ScheduleGetter); ok {
+		return scheduleGetter.GetSchedule()
+	}
+	return time.Duration(config.Config.Global.CollectionJitter), time.Duration(config.Config.Global.CollectionOffset),
+		config.Config.Global.RoundInterval
+}
+
 func MayGetInstances(t interface{}) []Instance {
 	if instancesGetter, ok := t.(InstancesGetter); ok {
 		return instancesGetter.GetInstances()
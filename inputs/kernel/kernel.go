@@ -74,6 +74,7 @@ func (s *KernelStats) Gather(slist *types.SampleList) {
 	}
 
 	fields := make(map[string]interface{})
+	counters := make(map[string]interface{})
 
 	fields["entropy_avail"] = entropyValue
 
@@ -83,19 +84,19 @@ func (s *KernelStats) Gather(slist *types.SampleList) {
 		case bytes.Equal(field, interrupts):
 			m, err := strconv.ParseInt(string(dataFields[i+1]), 10, 64)
 			if err == nil {
-				fields["interrupts"] = m
+				counters["interrupts"] = m
 			}
 
 		case bytes.Equal(field, contextSwitches):
 			m, err := strconv.ParseInt(string(dataFields[i+1]), 10, 64)
 			if err == nil {
-				fields["context_switches"] = m
+				counters["context_switches"] = m
 			}
 
 		case bytes.Equal(field, processesForked):
 			m, err := strconv.ParseInt(string(dataFields[i+1]), 10, 64)
 			if err == nil {
-				fields["processes_forked"] = m
+				counters["processes_forked"] = m
 			}
 
 		case bytes.Equal(field, bootTime):
@@ -107,17 +108,18 @@ func (s *KernelStats) Gather(slist *types.SampleList) {
 		case bytes.Equal(field, diskPages):
 			in, err := strconv.ParseInt(string(dataFields[i+1]), 10, 64)
 			if err == nil {
-				fields["disk_pages_in"] = in
+				counters["disk_pages_in"] = in
 			}
 
 			out, err := strconv.ParseInt(string(dataFields[i+2]), 10, 64)
 			if err == nil {
-				fields["disk_pages_out"] = out
+				counters["disk_pages_out"] = out
 			}
 		}
 	}
 
 	slist.PushSamples(inputName, fields)
+	slist.PushCounters(inputName, counters)
 }
 
 func (s *KernelStats) getProcStat() ([]byte, error) {
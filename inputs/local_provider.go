@@ -1,11 +1,18 @@
 package inputs
 
 import (
+	"crypto/md5"
+	"encoding/hex"
 	"fmt"
+	"log"
 	"path"
+	"path/filepath"
+	"sort"
 	"strings"
 	"sync"
+	"time"
 
+	"github.com/fsnotify/fsnotify"
 	"github.com/toolkits/pkg/file"
 
 	"flashcat.cloud/categraf/config"
@@ -13,16 +20,27 @@ import (
 	"flashcat.cloud/categraf/pkg/choice"
 )
 
+// reloadDelay merges the burst of events an editor produces on save
+const reloadDelay = time.Second
+
 type LocalProvider struct {
 	sync.RWMutex
 
 	configDir  string
 	inputNames []string
+
+	// input name -> file name -> checksum of the file content
+	sums map[string]map[string]string
+
+	op     InputOperation
+	stopCh chan struct{}
 }
 
-func newLocalProvider(c *config.ConfigType) (*LocalProvider, error) {
+func newLocalProvider(c *config.ConfigType, op InputOperation) (*LocalProvider, error) {
 	return &LocalProvider{
 		configDir: c.ConfigDir,
+		op:        op,
+		sums:      make(map[string]map[string]string),
 	}, nil
 }
 
@@ -30,11 +48,140 @@ func (lp *LocalProvider) Name() string {
 	return "local"
 }
 
-// StartReloader 内部可以检查是否有配置的变更,如果有变更,则可以手动执行reloadFunc来重启插件
-func (lp *LocalProvider) StartReloader() {}
+// StartReloader watches input.* dirs, only the inputs whose files changed are
+// registered again, the rest of the agent keeps running
+func (lp *LocalProvider) StartReloader() {
+	if lp.op == nil {
+		return
+	}
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		log.Println("W! local provider: failed to watch configs, hot reload disabled:", err)
+		return
+	}
+	if err = watcher.Add(lp.configDir); err != nil {
+		log.Println("W! local provider: failed to watch", lp.configDir, "hot reload disabled:", err)
+		watcher.Close()
+		return
+	}
+	lp.RLock()
+	for _, name := range lp.inputNames {
+		lp.watchDir(watcher, name)
+	}
+	lp.RUnlock()
+
+	stopCh := make(chan struct{})
+	lp.Lock()
+	lp.stopCh = stopCh
+	lp.Unlock()
+
+	go func() {
+		defer watcher.Close()
+		timer := time.NewTimer(reloadDelay)
+		timer.Stop()
+		for {
+			select {
+			case ev, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				// new input dirs are watched as soon as they show up
+				if ev.Op&fsnotify.Create != 0 && filepath.Dir(ev.Name) == filepath.Clean(lp.configDir) {
+					if base := filepath.Base(ev.Name); strings.HasPrefix(base, inputFilePrefix) && file.IsExist(ev.Name) {
+						lp.watchDir(watcher, base[len(inputFilePrefix):])
+					}
+				}
+				timer.Reset(reloadDelay)
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				log.Println("E! local provider: watch configs error:", err)
+			case <-timer.C:
+				lp.reload()
+			case <-stopCh:
+				timer.Stop()
+				return
+			}
+		}
+	}()
+}
+
+func (lp *LocalProvider) StopReloader() {
+	lp.Lock()
+	defer lp.Unlock()
+	if lp.stopCh != nil {
+		close(lp.stopCh)
+		lp.stopCh = nil
+	}
+}
 
-func (lp *LocalProvider) StopReloader() {}
+func (lp *LocalProvider) watchDir(watcher *fsnotify.Watcher, name string) {
+	dir := path.Join(lp.configDir, inputFilePrefix+name)
+	if err := watcher.Add(dir); err != nil {
+		log.Println("W! local provider: failed to watch", dir, "error:", err)
+	}
+}
 
+// reload registers the added or changed inputs and deregisters the deleted ones
+func (lp *LocalProvider) reload() {
+	lp.RLock()
+	old := lp.sums
+	lp.RUnlock()
+
+	changed, err := lp.LoadConfig()
+	if err != nil {
+		log.Println("E! local provider: reload configs error:", err)
+		return
+	}
+	if !changed {
+		return
+	}
+
+	lp.RLock()
+	cur := lp.sums
+	lp.RUnlock()
+
+	for name := range old {
+		if _, has := cur[name]; !has {
+			log.Println("I! local provider: deleted input:", name)
+			lp.op.DeregisterInput(FormatInputName(lp.Name(), name), "")
+		}
+	}
+	for name, sums := range cur {
+		oldSums, has := old[name]
+		if has && sameSums(oldSums, sums) {
+			continue
+		}
+		configs, err := lp.GetInputConfig(name)
+		if err != nil {
+			log.Println("E! local provider: failed to get configuration of input:", name, "error:", err)
+			continue
+		}
+		if has {
+			log.Println("I! local provider: updated input:", name)
+			lp.op.DeregisterInput(FormatInputName(lp.Name(), name), "")
+		} else {
+			log.Println("I! local provider: new input:", name)
+		}
+		lp.op.RegisterInput(FormatInputName(lp.Name(), name), configs)
+	}
+}
+
+func sameSums(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for f, sum := range a {
+		if b[f] != sum {
+			return false
+		}
+	}
+	return true
+}
+
+// LoadConfig lists input dirs and the checksums of their files, it reports
+// whether anything changed since the last call
 func (lp *LocalProvider) LoadConfig() (bool, error) {
 	dirs, err := file.DirsUnder(lp.configDir)
 	if err != nil {
@@ -42,17 +189,35 @@ func (lp *LocalProvider) LoadConfig() (bool, error) {
 	}
 
 	names := make([]string, 0, len(dirs))
+	sums := make(map[string]map[string]string, len(dirs))
 	for _, dir := range dirs {
-		if strings.HasPrefix(dir, inputFilePrefix) {
-			names = append(names, dir[len(inputFilePrefix):])
+		if !strings.HasPrefix(dir, inputFilePrefix) {
+			continue
+		}
+		name := dir[len(inputFilePrefix):]
+		names = append(names, name)
+		configs, err := lp.readConfigs(name)
+		if err != nil {
+			return false, err
+		}
+		sums[name] = make(map[string]string, len(configs))
+		for f, c := range configs {
+			sums[name][f] = c.CheckSum()
 		}
 	}
 
 	lp.Lock()
+	changed := len(sums) != len(lp.sums)
+	for name, s := range sums {
+		if old, has := lp.sums[name]; !has || !sameSums(old, s) {
+			changed = true
+		}
+	}
 	lp.inputNames = names
+	lp.sums = sums
 	lp.Unlock()
 
-	return false, nil
+	return changed, nil
 }
 
 func (lp *LocalProvider) GetInputs() ([]string, error) {
@@ -73,12 +238,32 @@ func (lp *LocalProvider) GetInputConfig(inputKey string) ([]cfg.ConfigWithFormat
 	}
 	lp.RUnlock()
 
+	configs, err := lp.readConfigs(inputKey)
+	if err != nil {
+		return nil, err
+	}
+	files := make([]string, 0, len(configs))
+	for f := range configs {
+		files = append(files, f)
+	}
+	sort.Strings(files)
+
+	cwf := make([]cfg.ConfigWithFormat, 0, len(files))
+	for _, f := range files {
+		cwf = append(cwf, configs[f])
+	}
+	return cwf, nil
+}
+
+// readConfigs reads the config files of an input, keyed by file name, with
+// the md5 of their content as checksum
+func (lp *LocalProvider) readConfigs(inputKey string) (map[string]cfg.ConfigWithFormat, error) {
 	files, err := file.FilesUnder(path.Join(lp.configDir, inputFilePrefix+inputKey))
 	if err != nil {
 		return nil, fmt.Errorf("failed to list files under: %s : %v", lp.configDir, err)
 	}
 
-	cwf := make([]cfg.ConfigWithFormat, 0, len(files))
+	cwf := make(map[string]cfg.ConfigWithFormat, len(files))
 	for _, f := range files {
 		if !(strings.HasSuffix(f, ".yaml") ||
 			strings.HasSuffix(f, ".yml") ||
@@ -90,10 +275,13 @@ func (lp *LocalProvider) GetInputConfig(inputKey string) ([]cfg.ConfigWithFormat
 		if err != nil {
 			return nil, err
 		}
-		cwf = append(cwf, cfg.ConfigWithFormat{
+		sum := md5.Sum(c)
+		conf := cfg.ConfigWithFormat{
 			Config: string(c),
 			Format: cfg.GuessFormat(f),
-		})
+		}
+		conf.SetCheckSum(hex.EncodeToString(sum[:]))
+		cwf[f] = conf
 	}
 
 	return cwf, nil
@@ -0,0 +1,67 @@
+package inputs
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"flashcat.cloud/categraf/config"
+	"flashcat.cloud/categraf/pkg/cfg"
+)
+
+type recordOp struct {
+	registered   []string
+	deregistered []string
+}
+
+func (o *recordOp) RegisterInput(name string, _ []cfg.ConfigWithFormat) {
+	o.registered = append(o.registered, name)
+}
+
+func (o *recordOp) DeregisterInput(name string, _ string) {
+	o.deregistered = append(o.deregistered, name)
+}
+
+func TestLocalProviderReloadChangedInputs(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) {
+		p := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("input.cpu/cpu.toml", "interval = 15\n")
+	write("input.mem/mem.toml", "interval = 15\n")
+
+	config.Config = &config.ConfigType{ConfigDir: dir}
+	op := &recordOp{}
+	lp, _ := newLocalProvider(config.Config, op)
+	if changed, err := lp.LoadConfig(); err != nil || !changed {
+		t.Fatalf("first load: changed=%v err=%v", changed, err)
+	}
+
+	lp.reload()
+	if len(op.registered)+len(op.deregistered) != 0 {
+		t.Fatalf("unchanged configs reloaded: %+v", op)
+	}
+
+	write("input.cpu/cpu.toml", "interval = 30\n")
+	write("input.disk/disk.toml", "")
+	if err := os.RemoveAll(filepath.Join(dir, "input.mem")); err != nil {
+		t.Fatal(err)
+	}
+	lp.reload()
+
+	sort.Strings(op.registered)
+	sort.Strings(op.deregistered)
+	if len(op.registered) != 2 || op.registered[0] != "local.cpu" || op.registered[1] != "local.disk" {
+		t.Fatalf("unexpected registered inputs: %v", op.registered)
+	}
+	if len(op.deregistered) != 2 || op.deregistered[0] != "local.cpu" || op.deregistered[1] != "local.mem" {
+		t.Fatalf("unexpected deregistered inputs: %v", op.deregistered)
+	}
+}
@@ -117,6 +117,6 @@ func (s *NetIOStats) Gather(slist *types.SampleList) {
 			"drop_out":     io.Dropout,
 		}
 
-		slist.PushSamples(inputName, fields, tags)
+		slist.PushCounters(inputName, fields, tags)
 	}
 }
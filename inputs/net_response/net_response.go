@@ -40,10 +40,27 @@ type Instance struct {
 	Mappings map[string]map[string]string `toml:"mappings"`
 }
 
+// Validate checks every target is host:port
+func (ins *Instance) Validate() error {
+	for _, target := range ins.Targets {
+		_, port, err := net.SplitHostPort(target)
+		if err != nil {
+			return fmt.Errorf("failed to split host port, target: %s, error: %v", target, err)
+		}
+		if port == "" {
+			return errors.New("bad port, target: " + target)
+		}
+	}
+	return nil
+}
+
 func (ins *Instance) Init() error {
 	if len(ins.Targets) == 0 {
 		return types.ErrInstancesEmpty
 	}
+	if err := ins.Validate(); err != nil {
+		return err
+	}
 
 	if ins.Protocol == "" {
 		ins.Protocol = "tcp"
@@ -66,20 +83,10 @@ func (ins *Instance) Init() error {
 	}
 
 	for i := 0; i < len(ins.Targets); i++ {
-		target := ins.Targets[i]
-
-		host, port, err := net.SplitHostPort(target)
-		if err != nil {
-			return fmt.Errorf("failed to split host port, target: %s, error: %v", target, err)
-		}
-
+		host, port, _ := net.SplitHostPort(ins.Targets[i])
 		if host == "" {
 			ins.Targets[i] = "localhost:" + port
 		}
-
-		if port == "" {
-			return errors.New("bad port, target: " + target)
-		}
 	}
 
 	return nil
@@ -147,7 +154,7 @@ func (ins *Instance) Gather(slist *types.SampleList) {
 }
 
 func (ins *Instance) gather(slist *types.SampleList, target string) {
-	if config.Config.DebugMode {
+	if config.DebugMode() {
 		log.Println("D! net_response... target:", target)
 	}
 
@@ -302,7 +309,7 @@ func (ins *Instance) UDPGather(address string) (map[string]string, map[string]in
 		for i := 0; i < int(t); i++ {
 			time.Sleep(1 * time.Second)
 			_, err = conn.Write(msg)
-			if err != nil && config.Config.DebugMode {
+			if err != nil && config.DebugMode() {
 				log.Printf("E! write udp failed, address: %s, error: %s", address, err)
 			}
 			if err != nil && strings.Contains(err.Error(), "refused") {
@@ -164,10 +164,10 @@ func (s *NetStats) gatherExt(slist *types.SampleList) {
 	}
 
 	if s.TcpExt {
-		slist.PushSamples(inputName+"_tcpext", n.TcpExt, tags)
+		slist.PushCounters(inputName+"_tcpext", n.TcpExt, tags)
 	}
 
 	if s.IpExt {
-		slist.PushSamples(inputName+"_ipext", n.IpExt, tags)
+		slist.PushCounters(inputName+"_ipext", n.IpExt, tags)
 	}
 }
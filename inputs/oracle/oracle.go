@@ -108,12 +108,12 @@ func (ins *Instance) Init() error {
 }
 
 func (ins *Instance) Drop() error {
-	if config.Config.DebugMode {
+	if config.DebugMode() {
 		log.Println("D! dropping oracle connection:", ins.Address)
 	}
 
 	if len(ins.Address) == 0 || ins.client == nil {
-		if config.Config.DebugMode {
+		if config.DebugMode() {
 			log.Println("D! oracle address is empty or client is nil, so there is no need to close")
 		}
 		return nil
@@ -127,8 +127,13 @@ func (ins *Instance) Drop() error {
 }
 
 func (ins *Instance) Gather(slist *types.SampleList) {
+	ins.GatherContext(context.Background(), slist)
+}
+
+// GatherContext stops pinging and querying when ctx is done
+func (ins *Instance) GatherContext(ctx context.Context, slist *types.SampleList) {
 	if len(ins.Address) == 0 {
-		if config.Config.DebugMode {
+		if config.DebugMode() {
 			log.Println("D! oracle address is empty")
 		}
 		return
@@ -140,7 +145,7 @@ func (ins *Instance) Gather(slist *types.SampleList) {
 		slist.PushFront(types.NewSample(inputName, "scrape_use_seconds", use, tags))
 	}(time.Now())
 
-	if err := ins.client.Ping(); err != nil {
+	if err := ins.client.PingContext(ctx); err != nil {
 		slist.PushFront(types.NewSample(inputName, "up", 0, tags))
 		log.Println("E! failed to ping oracle:", ins.Address, "error:", err)
 		return
@@ -153,23 +158,23 @@ func (ins *Instance) Gather(slist *types.SampleList) {
 	for i := 0; i < len(ins.Metrics); i++ {
 		m := ins.Metrics[i]
 		waitMetrics.Add(1)
-		go ins.scrapeMetric(waitMetrics, slist, m, tags)
+		go ins.scrapeMetric(ctx, waitMetrics, slist, m, tags)
 	}
 
 	for i := 0; i < len(ins.GlobalMetrics); i++ {
 		m := ins.GlobalMetrics[i]
 		waitMetrics.Add(1)
-		go ins.scrapeMetric(waitMetrics, slist, m, tags)
+		go ins.scrapeMetric(ctx, waitMetrics, slist, m, tags)
 	}
 
 	waitMetrics.Wait()
 }
 
-func (ins *Instance) scrapeMetric(waitMetrics *sync.WaitGroup, slist *types.SampleList, metricConf MetricConfig, tags map[string]string) {
+func (ins *Instance) scrapeMetric(ctx context.Context, waitMetrics *sync.WaitGroup, slist *types.SampleList, metricConf MetricConfig, tags map[string]string) {
 	defer waitMetrics.Done()
 
 	timeout := time.Duration(metricConf.Timeout)
-	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	ctx, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel()
 
 	rows, err := ins.client.QueryContext(ctx, metricConf.Request)
@@ -192,7 +197,7 @@ func (ins *Instance) scrapeMetric(waitMetrics *sync.WaitGroup, slist *types.Samp
 		return
 	}
 
-	if config.Config.DebugMode {
+	if config.DebugMode() {
 		log.Println("D! columns:", cols)
 	}
 
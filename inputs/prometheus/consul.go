@@ -91,7 +91,7 @@ func (ins *Instance) UrlsFromConsul() ([]ScrapeUrl, error) {
 		return []ScrapeUrl{}, nil
 	}
 
-	if config.Config.DebugMode {
+	if config.DebugMode() {
 		log.Println("D! get urls from consul:", ins.ConsulConfig.Agent)
 	}
 
@@ -111,13 +111,13 @@ func (ins *Instance) UrlsFromConsul() ([]ScrapeUrl, error) {
 		}
 
 		if len(consulServices) == 0 {
-			if config.Config.DebugMode {
+			if config.DebugMode() {
 				log.Println("D! query consul did not find any instances, service:", q.ServiceName, " tag:", q.ServiceTag)
 			}
 			continue
 		}
 
-		if config.Config.DebugMode {
+		if config.DebugMode() {
 			log.Println("D! query consul found", len(consulServices), "instances, service:", q.ServiceName, " tag:", q.ServiceTag)
 		}
 
@@ -161,7 +161,7 @@ func (ins *Instance) getConsulServiceURL(q *ConsulQuery, s *api.CatalogService)
 		extraTags[tagName] = buffer.String()
 	}
 
-	if config.Config.DebugMode {
+	if config.DebugMode() {
 		log.Println("D! found consul service:", serviceURL.String())
 	}
 
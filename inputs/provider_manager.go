@@ -81,7 +81,7 @@ func NewProvider(c *config.ConfigType, op InputOperation) ([]Provider, error) {
 			}
 			providers = append(providers, provider)
 		case "local":
-			provider, err := newLocalProvider(c)
+			provider, err := newLocalProvider(c, op)
 			if err != nil {
 				return nil, err
 			}
@@ -54,6 +54,75 @@ func (ins *Categraf) Gather(slist *types.SampleList) {
 	slist.PushSample(defaultPrefix, "metrics_enqueue_failed_count", ss.FailCount, vTag)
 	slist.PushSample(defaultPrefix, "current_queue_size", ss.QueueSize, vTag)
 
+	// writer metrics
+	for _, ws := range writer.WriterMetrics() {
+		wTag := map[string]string{
+			"version": config.Version,
+			"url":     ws.Url,
+		}
+		slist.PushSample(defaultPrefix, "writer_queue_size", ws.QueueSize, wTag)
+		slist.PushSample(defaultPrefix, "writer_retried_sum", ws.RetriedCount, wTag)
+		slist.PushSample(defaultPrefix, "writer_dropped_series_sum", ws.DroppedSeries, wTag)
+		slist.PushSample(defaultPrefix, "writer_dropped_histograms_sum", ws.DroppedHistograms, wTag)
+		slist.PushSample(defaultPrefix, "writer_breaker_open", ws.BreakerOpen, wTag)
+		if !ws.Wal {
+			continue
+		}
+		slist.PushSample(defaultPrefix, "wal_buffered_bytes", ws.BufferedBytes, wTag)
+		slist.PushSample(defaultPrefix, "wal_replayed_bytes_sum", ws.ReplayedBytes, wTag)
+		slist.PushSample(defaultPrefix, "wal_dropped_segments_sum", ws.DroppedSegments, wTag)
+	}
+
+	// gather health of inputs, up is 0 when the last gather panicked or timed out
+	for _, ih := range inputs.Health() {
+		slist.PushSample(defaultPrefix, "input_gather_skipped_sum", ih.Skipped, map[string]string{
+			"version": config.Version,
+			"input":   ih.Name,
+		})
+		for _, st := range ih.Instances {
+			iTag := map[string]string{
+				"version":  config.Version,
+				"input":    ih.Name,
+				"instance": st.Instance,
+			}
+			up := 1
+			if st.Error != "" {
+				up = 0
+			}
+			slist.PushSample(defaultPrefix, "input_up", up, iTag)
+			slist.PushSample(defaultPrefix, "input_gather_duration_seconds", st.Duration.Seconds(), iTag)
+			slist.PushSample(defaultPrefix, "input_gather_samples", st.Samples, iTag)
+			slist.PushSample(defaultPrefix, "input_gather_panics_sum", st.Panics, iTag)
+			slist.PushSample(defaultPrefix, "input_gather_timeouts_sum", st.Timeouts, iTag)
+			slist.PushSample(defaultPrefix, "input_gather_inflight_skipped_sum", st.Skipped, iTag)
+			stuck := 0
+			if st.Stuck {
+				stuck = 1
+			}
+			slist.PushSample(defaultPrefix, "input_gather_stuck", stuck, iTag)
+		}
+	}
+
+	// series tracked by the cardinality guard, per source
+	series := make(map[string]int)
+	for _, cs := range writer.CardinalityStats() {
+		series[cs.Source] += cs.Series
+		if cs.Exceeded == 0 {
+			continue
+		}
+		slist.PushSample(defaultPrefix, "cardinality_exceeded_sum", cs.Exceeded, map[string]string{
+			"version": config.Version,
+			"source":  cs.Source,
+			"metric":  cs.Metric,
+		})
+	}
+	for source, n := range series {
+		slist.PushSample(defaultPrefix, "cardinality_series", n, map[string]string{
+			"version": config.Version,
+			"source":  source,
+		})
+	}
+
 	for _, mf := range mfs {
 		metricName := mf.GetName()
 		for _, m := range mf.Metric {
@@ -36,7 +36,7 @@ var execCommand = exec.Command
 // execCmd executes the specified command, returning the STDOUT content.
 // If command exits with error status, the output is captured into the returned error.
 func execCmd(arg0 string, args ...string) ([]byte, error) {
-	if config.Config.DebugMode {
+	if config.DebugMode() {
 		quoted := make([]string, 0, len(args))
 		for _, arg := range args {
 			quoted = append(quoted, fmt.Sprintf("%q", arg))
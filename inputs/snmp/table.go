@@ -549,7 +549,7 @@ func fieldConvert(conv string, v interface{}) (interface{}, error) {
 		return v, nil
 	}
 
-	if config.Config.DebugMode {
+	if config.DebugMode() {
 		log.Printf("D! %s the value %v", conv, v)
 	}
 
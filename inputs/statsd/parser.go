@@ -0,0 +1,105 @@
+package statsd
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	typeCounter = "c"
+	typeGauge   = "g"
+	typeSet     = "s"
+	typeTimer   = "ms"
+	typeHisto   = "h"
+	typeDistrib = "d"
+)
+
+// line is one parsed statsd metric
+type line struct {
+	name  string
+	typ   string
+	value float64
+	// raw value of sets
+	member string
+	// gauges prefixed with + or - are relative
+	relative bool
+	rate     float64
+	tags     map[string]string
+}
+
+// parseLine parses "name:value|type[|@rate][|#tag1:v1,tag2]", tags are the
+// DogStatsD extension. Events and service checks of DogStatsD are skipped,
+// they return a nil line.
+func parseLine(s string) (*line, error) {
+	if strings.HasPrefix(s, "_e{") || strings.HasPrefix(s, "_sc|") {
+		return nil, nil
+	}
+
+	colon := strings.LastIndex(s[:pipeOrEnd(s)], ":")
+	if colon <= 0 {
+		return nil, fmt.Errorf("missing name or value")
+	}
+	l := &line{name: s[:colon], rate: 1}
+
+	sections := strings.Split(s[colon+1:], "|")
+	if len(sections) < 2 {
+		return nil, fmt.Errorf("missing type")
+	}
+	raw := sections[0]
+	l.typ = sections[1]
+
+	for _, section := range sections[2:] {
+		switch {
+		case strings.HasPrefix(section, "@"):
+			rate, err := strconv.ParseFloat(section[1:], 64)
+			if err != nil || rate <= 0 || rate > 1 {
+				return nil, fmt.Errorf("invalid sample rate %q", section)
+			}
+			l.rate = rate
+		case strings.HasPrefix(section, "#"):
+			l.tags = parseTags(section[1:])
+		}
+	}
+
+	switch l.typ {
+	case typeSet:
+		l.member = raw
+		return l, nil
+	case typeGauge:
+		l.relative = strings.HasPrefix(raw, "+") || strings.HasPrefix(raw, "-")
+	case typeCounter, typeTimer, typeHisto, typeDistrib:
+	default:
+		return nil, fmt.Errorf("unknown type %q", l.typ)
+	}
+
+	v, err := strconv.ParseFloat(raw, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid value %q", raw)
+	}
+	l.value = v
+	return l, nil
+}
+
+func pipeOrEnd(s string) int {
+	if i := strings.Index(s, "|"); i >= 0 {
+		return i
+	}
+	return len(s)
+}
+
+// parseTags parses "k1:v1,k2", tags without value are set to "true"
+func parseTags(s string) map[string]string {
+	tags := make(map[string]string)
+	for _, tag := range strings.Split(s, ",") {
+		if tag == "" {
+			continue
+		}
+		if kv := strings.SplitN(tag, ":", 2); len(kv) == 2 {
+			tags[kv[0]] = kv[1]
+		} else {
+			tags[tag] = "true"
+		}
+	}
+	return tags
+}
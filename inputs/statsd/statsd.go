@@ -0,0 +1,423 @@
+package statsd
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"math"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"flashcat.cloud/categraf/config"
+	"flashcat.cloud/categraf/inputs"
+	"flashcat.cloud/categraf/types"
+)
+
+const inputName = "statsd"
+
+type Statsd struct {
+	config.PluginConfig
+	Instances []*Instance `toml:"instances"`
+}
+
+func init() {
+	inputs.Add(inputName, func() inputs.Input {
+		return &Statsd{}
+	})
+}
+
+func (s *Statsd) Clone() inputs.Input {
+	return &Statsd{}
+}
+
+func (s *Statsd) Name() string {
+	return inputName
+}
+
+func (s *Statsd) GetInstances() []inputs.Instance {
+	ret := make([]inputs.Instance, len(s.Instances))
+	for i := 0; i < len(s.Instances); i++ {
+		ret[i] = s.Instances[i]
+	}
+	return ret
+}
+
+// GatherResets is true, counters, sets and timers are reset by gathers
+func (s *Statsd) GatherResets() bool {
+	return true
+}
+
+func (s *Statsd) Drop() {
+	for _, ins := range s.Instances {
+		ins.Drop()
+	}
+}
+
+type Instance struct {
+	config.InstanceConfig
+
+	// udp://:8125, tcp://:8125 or unix:///run/statsd.sock
+	ServiceAddress string `toml:"service_address"`
+	// percentiles of timers and histograms
+	Percentiles []float64 `toml:"percentiles"`
+	// gauges keep their last value across flushes unless delete_gauges is set
+	DeleteGauges       bool `toml:"delete_gauges"`
+	MaxTCPConnections  int  `toml:"max_tcp_connections"`
+	MaxPendingMessages int  `toml:"max_pending_messages"`
+
+	lock     sync.Mutex
+	counters map[string]*counter
+	gauges   map[string]*gauge
+	sets     map[string]*set
+	timers   map[string]*timer
+
+	lines    chan string
+	done     chan struct{}
+	wg       sync.WaitGroup
+	conn     net.PacketConn
+	listener net.Listener
+	sockPath string
+	dropped  uint64
+}
+
+type series struct {
+	name string
+	tags map[string]string
+}
+
+type counter struct {
+	series
+	value float64
+}
+
+type gauge struct {
+	series
+	value float64
+}
+
+type set struct {
+	series
+	members map[string]struct{}
+}
+
+type timer struct {
+	series
+	values []float64
+	// sum of 1/rate of the values
+	count float64
+}
+
+var _ inputs.SampleGatherer = new(Instance)
+var _ inputs.Input = new(Statsd)
+var _ inputs.InstancesGetter = new(Statsd)
+
+func (ins *Instance) Init() error {
+	if ins.ServiceAddress == "" {
+		return types.ErrInstancesEmpty
+	}
+	if len(ins.Percentiles) == 0 {
+		ins.Percentiles = []float64{90}
+	}
+	for _, p := range ins.Percentiles {
+		if p <= 0 || p > 100 {
+			return fmt.Errorf("percentile %v out of range (0, 100]", p)
+		}
+	}
+	if ins.MaxTCPConnections <= 0 {
+		ins.MaxTCPConnections = 250
+	}
+	if ins.MaxPendingMessages <= 0 {
+		ins.MaxPendingMessages = 10000
+	}
+	ins.counters = make(map[string]*counter)
+	ins.gauges = make(map[string]*gauge)
+	ins.sets = make(map[string]*set)
+	ins.timers = make(map[string]*timer)
+	ins.lines = make(chan string, ins.MaxPendingMessages)
+	ins.done = make(chan struct{})
+
+	if err := ins.listen(); err != nil {
+		return err
+	}
+	ins.wg.Add(1)
+	go ins.aggregate()
+	return nil
+}
+
+func (ins *Instance) listen() error {
+	split := strings.SplitN(ins.ServiceAddress, "://", 2)
+	if len(split) != 2 {
+		return fmt.Errorf("invalid service address: %s", ins.ServiceAddress)
+	}
+	network, addr := split[0], split[1]
+
+	switch network {
+	case "udp", "udp4", "udp6":
+		conn, err := net.ListenPacket(network, addr)
+		if err != nil {
+			return err
+		}
+		ins.conn = conn
+		ins.wg.Add(1)
+		go ins.serveUDP()
+	case "tcp", "tcp4", "tcp6", "unix":
+		if network == "unix" {
+			// a socket left by a previous run
+			os.Remove(addr)
+			ins.sockPath = addr
+		}
+		ln, err := net.Listen(network, addr)
+		if err != nil {
+			return err
+		}
+		ins.listener = ln
+		ins.wg.Add(1)
+		go ins.serveStream()
+	default:
+		return fmt.Errorf("unknown protocol %q in %q", network, ins.ServiceAddress)
+	}
+	log.Println("I! statsd listening on", ins.ServiceAddress)
+	return nil
+}
+
+func (ins *Instance) Drop() {
+	if ins.done == nil {
+		return
+	}
+	close(ins.done)
+	if ins.conn != nil {
+		ins.conn.Close()
+	}
+	if ins.listener != nil {
+		ins.listener.Close()
+	}
+	ins.wg.Wait()
+	if ins.sockPath != "" {
+		os.Remove(ins.sockPath)
+	}
+}
+
+// push queues a packet or a line for aggregation, it is dropped if the
+// queue is full
+func (ins *Instance) push(s string) {
+	select {
+	case ins.lines <- s:
+	default:
+		if n := atomic.AddUint64(&ins.dropped, 1); n%1000 == 1 {
+			log.Printf("W! statsd %s: pending messages full, %d dropped", ins.ServiceAddress, n)
+		}
+	}
+}
+
+func (ins *Instance) serveUDP() {
+	defer ins.wg.Done()
+	buf := make([]byte, 65536)
+	for {
+		n, _, err := ins.conn.ReadFrom(buf)
+		if err != nil {
+			select {
+			case <-ins.done:
+			default:
+				log.Println("E! statsd: read udp error:", err)
+			}
+			return
+		}
+		ins.push(string(buf[:n]))
+	}
+}
+
+func (ins *Instance) serveStream() {
+	defer ins.wg.Done()
+	limiter := make(chan struct{}, ins.MaxTCPConnections)
+	var conns sync.Map
+	defer conns.Range(func(k, _ interface{}) bool {
+		k.(net.Conn).Close()
+		return true
+	})
+
+	for {
+		conn, err := ins.listener.Accept()
+		if err != nil {
+			select {
+			case <-ins.done:
+			default:
+				log.Println("E! statsd: accept error:", err)
+			}
+			return
+		}
+		select {
+		case limiter <- struct{}{}:
+		default:
+			log.Printf("W! statsd %s: max_tcp_connections(%d) reached, connection refused", ins.ServiceAddress, ins.MaxTCPConnections)
+			conn.Close()
+			continue
+		}
+		conns.Store(conn, struct{}{})
+		go func() {
+			defer func() {
+				conns.Delete(conn)
+				conn.Close()
+				<-limiter
+			}()
+			scanner := bufio.NewScanner(conn)
+			for scanner.Scan() {
+				ins.push(scanner.Text())
+			}
+		}()
+	}
+}
+
+func (ins *Instance) aggregate() {
+	defer ins.wg.Done()
+	for {
+		select {
+		case <-ins.done:
+			return
+		case packet := <-ins.lines:
+			for _, s := range strings.Split(packet, "\n") {
+				s = strings.TrimSpace(s)
+				if s == "" {
+					continue
+				}
+				l, err := parseLine(s)
+				if err != nil {
+					if config.DebugMode() {
+						log.Println("D! statsd: failed to parse line:", s, "error:", err)
+					}
+					continue
+				}
+				if l != nil {
+					ins.add(l)
+				}
+			}
+		}
+	}
+}
+
+func seriesKey(name string, tags map[string]string) string {
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var sb strings.Builder
+	sb.WriteString(name)
+	for _, k := range keys {
+		sb.WriteByte(0)
+		sb.WriteString(k)
+		sb.WriteByte(0)
+		sb.WriteString(tags[k])
+	}
+	return sb.String()
+}
+
+func (ins *Instance) add(l *line) {
+	key := seriesKey(l.name, l.tags)
+	sr := series{name: l.name, tags: l.tags}
+
+	ins.lock.Lock()
+	defer ins.lock.Unlock()
+	switch l.typ {
+	case typeCounter:
+		c, ok := ins.counters[key]
+		if !ok {
+			c = &counter{series: sr}
+			ins.counters[key] = c
+		}
+		c.value += l.value / l.rate
+	case typeGauge:
+		g, ok := ins.gauges[key]
+		if !ok {
+			g = &gauge{series: sr}
+			ins.gauges[key] = g
+		}
+		if l.relative {
+			g.value += l.value
+		} else {
+			g.value = l.value
+		}
+	case typeSet:
+		st, ok := ins.sets[key]
+		if !ok {
+			st = &set{series: sr, members: make(map[string]struct{})}
+			ins.sets[key] = st
+		}
+		st.members[l.member] = struct{}{}
+	case typeTimer, typeHisto, typeDistrib:
+		t, ok := ins.timers[key]
+		if !ok {
+			t = &timer{series: sr}
+			ins.timers[key] = t
+		}
+		t.values = append(t.values, l.value)
+		t.count += 1 / l.rate
+	}
+}
+
+// Gather flushes what was aggregated since the last gather, counters, sets
+// and timers are reset
+func (ins *Instance) Gather(slist *types.SampleList) {
+	ins.lock.Lock()
+	counters, sets, timers := ins.counters, ins.sets, ins.timers
+	ins.counters = make(map[string]*counter)
+	ins.sets = make(map[string]*set)
+	ins.timers = make(map[string]*timer)
+	gauges := make([]gauge, 0, len(ins.gauges))
+	for _, g := range ins.gauges {
+		gauges = append(gauges, *g)
+	}
+	if ins.DeleteGauges {
+		ins.gauges = make(map[string]*gauge)
+	}
+	ins.lock.Unlock()
+
+	for _, c := range counters {
+		slist.PushSample("", c.name, c.value, c.tags)
+	}
+	for _, g := range gauges {
+		slist.PushSample("", g.name, g.value, g.tags)
+	}
+	for _, st := range sets {
+		slist.PushSample("", st.name, len(st.members), st.tags)
+	}
+	for _, t := range timers {
+		ins.gatherTimer(slist, t)
+	}
+}
+
+func (ins *Instance) gatherTimer(slist *types.SampleList, t *timer) {
+	values := t.values
+	sort.Float64s(values)
+
+	sum := 0.0
+	for _, v := range values {
+		sum += v
+	}
+	mean := sum / float64(len(values))
+	variance := 0.0
+	for _, v := range values {
+		variance += (v - mean) * (v - mean)
+	}
+
+	fields := map[string]interface{}{
+		"count":  t.count,
+		"lower":  values[0],
+		"upper":  values[len(values)-1],
+		"mean":   mean,
+		"sum":    sum,
+		"stddev": math.Sqrt(variance / float64(len(values))),
+	}
+	for _, p := range ins.Percentiles {
+		rank := int(math.Ceil(p / 100 * float64(len(values))))
+		if rank < 1 {
+			rank = 1
+		}
+		fields["p"+strings.ReplaceAll(strconv.FormatFloat(p, 'f', -1, 64), ".", "_")] = values[rank-1]
+	}
+	slist.PushSamples(t.name, fields, t.tags)
+}
@@ -0,0 +1,88 @@
+package statsd
+
+import (
+	"testing"
+
+	"flashcat.cloud/categraf/types"
+)
+
+func TestParseLine(t *testing.T) {
+	l, err := parseLine("api.hits:2|c|@0.5|#env:prod,canary")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l.name != "api.hits" || l.typ != typeCounter || l.value != 2 || l.rate != 0.5 {
+		t.Fatalf("unexpected line: %+v", l)
+	}
+	if l.tags["env"] != "prod" || l.tags["canary"] != "true" {
+		t.Fatalf("unexpected tags: %v", l.tags)
+	}
+
+	l, err = parseLine("temp:-3|g")
+	if err != nil || !l.relative || l.value != -3 {
+		t.Fatalf("unexpected relative gauge: %+v %v", l, err)
+	}
+
+	if l, err = parseLine("_e{5,4}:title|text"); l != nil || err != nil {
+		t.Fatalf("events should be skipped: %+v %v", l, err)
+	}
+
+	for _, s := range []string{"novalue", "a:1", "a:1|x", "a:x|c", "a:1|c|@2"} {
+		if _, err := parseLine(s); err == nil {
+			t.Errorf("expected error for %q", s)
+		}
+	}
+}
+
+func TestGather(t *testing.T) {
+	ins := &Instance{Percentiles: []float64{50, 99.9}}
+	ins.counters = make(map[string]*counter)
+	ins.gauges = make(map[string]*gauge)
+	ins.sets = make(map[string]*set)
+	ins.timers = make(map[string]*timer)
+
+	for _, s := range []string{
+		"hits:1|c", "hits:1|c|@0.1",
+		"temp:10|g", "temp:+5|g",
+		"users:a|s", "users:b|s", "users:a|s",
+		"latency:10|ms", "latency:20|ms", "latency:30|ms|@0.5",
+	} {
+		l, err := parseLine(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ins.add(l)
+	}
+
+	slist := types.NewSampleList()
+	ins.Gather(slist)
+	got := make(map[string]interface{})
+	for _, s := range slist.PopBackAll() {
+		got[s.Metric] = s.Value
+	}
+	want := map[string]interface{}{
+		"hits":          11.0,
+		"temp":          15.0,
+		"users":         2,
+		"latency_count": 4.0,
+		"latency_sum":   60.0,
+		"latency_mean":  20.0,
+		"latency_lower": 10.0,
+		"latency_upper": 30.0,
+		"latency_p50":   20.0,
+		"latency_p99_9": 30.0,
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("%s: got %v, want %v", k, got[k], v)
+		}
+	}
+
+	// counters, sets and timers are reset, gauges are kept
+	slist = types.NewSampleList()
+	ins.Gather(slist)
+	samples := slist.PopBackAll()
+	if len(samples) != 1 || samples[0].Metric != "temp" {
+		t.Fatalf("unexpected samples after flush: %d", len(samples))
+	}
+}
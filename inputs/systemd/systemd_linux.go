@@ -82,13 +82,13 @@ func (s *Systemd) Gather(slist *types.SampleList) {
 	begin = time.Now()
 	summary := summarizeUnits(allUnits)
 	s.collectSummaryMetrics(slist, summary)
-	if config.Config.DebugMode {
+	if config.DebugMode() {
 		log.Println("D!", "collectSummaryMetrics took", "duration_seconds", time.Since(begin).Seconds())
 	}
 
 	begin = time.Now()
 	units := filterUnits(allUnits, s.unitIncludePattern, s.unitExcludePattern)
-	if config.Config.DebugMode {
+	if config.DebugMode() {
 		log.Println("D!", "filterUnits took", "duration_seconds", time.Since(begin).Seconds())
 	}
 
@@ -123,7 +123,7 @@ func NewClient(ctx context.Context, vSphereURL *url.URL, vs *Instance) (*Client,
 	if vs.Username != "" {
 		vSphereURL.User = url.UserPassword(vs.Username, vs.Password)
 	}
-	if config.Config.DebugMode {
+	if config.DebugMode() {
 		log.Println("D! Creating client: ", vSphereURL.Host)
 	}
 	soapClient := soap.NewClient(vSphereURL, tlsCfg.InsecureSkipVerify)
@@ -196,7 +196,7 @@ func NewClient(ctx context.Context, vSphereURL *url.URL, vs *Instance) (*Client,
 	if err != nil {
 		return nil, err
 	}
-	if config.Config.DebugMode {
+	if config.DebugMode() {
 		log.Println("D! vCenter says max_query_metrics should be ", n)
 	}
 	if n < vs.MaxQueryMetrics {
@@ -252,7 +252,7 @@ func (c *Client) GetMaxQueryMetrics(ctx context.Context) (int, error) {
 			if s, ok := res[0].GetOptionValue().Value.(string); ok {
 				v, err := strconv.Atoi(s)
 				if err == nil {
-					if config.Config.DebugMode {
+					if config.DebugMode() {
 						log.Printf("D! vCenter maxQueryMetrics is defined: %d", v)
 					}
 					if v == -1 {
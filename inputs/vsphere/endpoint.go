@@ -397,7 +397,7 @@ func (e *Endpoint) getAncestorName(ctx context.Context, client *Client, resource
 				return true
 			}
 			if result.Parent == nil {
-				if config.Config.DebugMode {
+				if config.DebugMode() {
 					log.Printf("D! No parent found for %s (ascending from %s)", here.Reference(), r.Reference())
 				}
 
@@ -429,7 +429,7 @@ func (e *Endpoint) discover(ctx context.Context) error {
 	if err != nil {
 		return err
 	}
-	if config.Config.DebugMode {
+	if config.DebugMode() {
 		log.Printf("D! Discover new objects for %s", e.URL.Host)
 	}
 	dcNameCache := make(map[string]string)
@@ -439,7 +439,7 @@ func (e *Endpoint) discover(ctx context.Context) error {
 	// Populate resource objects, and endpoint instance info.
 	newObjects := make(map[string]objectMap)
 	for k, res := range e.resourceKinds {
-		if config.Config.DebugMode {
+		if config.DebugMode() {
 			log.Printf("D! Discovering resources for %s", res.name)
 		}
 		// Need to do this for all resource types even if they are not enabled
@@ -476,7 +476,7 @@ func (e *Endpoint) discover(ctx context.Context) error {
 				}
 			}
 			newObjects[k] = objects
-			if config.Config.DebugMode {
+			if config.DebugMode() {
 				log.Printf("D! discovered_objects  type is : %s   and number is : %d ", res.name, int64(len(objects)))
 			}
 			numRes += int64(len(objects))
@@ -516,14 +516,14 @@ func (e *Endpoint) discover(ctx context.Context) error {
 	if fields != nil {
 		e.customFields = fields
 	}
-	if config.Config.DebugMode {
+	if config.DebugMode() {
 		log.Printf("D! discovered_objects  type is : %s   and number is : %d ", "instance-total", numRes)
 	}
 	return nil
 }
 
 func (e *Endpoint) simpleMetadataSelect(ctx context.Context, client *Client, res *resourceKind) {
-	if config.Config.DebugMode {
+	if config.DebugMode() {
 		log.Printf("D! Using fast metric metadata selection for %s", res.name)
 	}
 	m, err := client.CounterInfoByName(ctx)
@@ -594,7 +594,7 @@ func (e *Endpoint) complexMetadataSelect(ctx context.Context, res *resourceKind,
 						mMap[strconv.Itoa(int(m.CounterId))+"|"+m.Instance] = m
 					}
 				}
-				if config.Config.DebugMode {
+				if config.DebugMode() {
 					log.Printf("D!Found %d metrics for %s", len(mMap), obj.name)
 				}
 				instInfoMux.Lock()
@@ -979,7 +979,7 @@ func (e *Endpoint) chunkify(ctx context.Context, res *resourceKind, now time.Tim
 			// Determine time of last successful collection
 			metricName := e.getMetricNameForID(metric.CounterId)
 			if metricName == "" {
-				if config.Config.DebugMode {
+				if config.DebugMode() {
 					log.Printf("D! Unable to find metric name for id %d. Skipping!", metric.CounterId)
 				}
 				continue
@@ -1011,7 +1011,7 @@ func (e *Endpoint) chunkify(ctx context.Context, res *resourceKind, now time.Tim
 			// Bucket filled to capacity?
 			// OR if we're past the absolute maximum limit
 			if (!res.realTime && len(bucket.MetricId) >= maxMetrics) || len(bucket.MetricId) > maxRealtimeMetrics {
-				if config.Config.DebugMode {
+				if config.DebugMode() {
 					log.Printf("D! Submitting partial query: %d metrics (%d remaining) of type %s for %s. Total objects %d",
 						len(bucket.MetricId), len(res.metrics)-metricIdx, res.name, e.URL.Host, len(res.objects))
 				}
@@ -1031,7 +1031,7 @@ func (e *Endpoint) chunkify(ctx context.Context, res *resourceKind, now time.Tim
 			pqs = append(pqs, *bucket)
 			numQs += len(bucket.MetricId)
 			if (!res.realTime && numQs > e.Parent.MaxQueryObjects) || numQs > maxRealtimeMetrics {
-				if config.Config.DebugMode {
+				if config.DebugMode() {
 					log.Printf("D! Submitting final bucket job for %s: %d metrics", res.name, numQs)
 				}
 				submitChunkJob(ctx, te, job, pqs)
@@ -1042,7 +1042,7 @@ func (e *Endpoint) chunkify(ctx context.Context, res *resourceKind, now time.Tim
 	}
 	// Submit any jobs left in the queue
 	if len(pqs) > 0 {
-		if config.Config.DebugMode {
+		if config.DebugMode() {
 			log.Printf("D! Submitting job for %s: %d objects, %d metrics", res.name, len(pqs), numQs)
 		}
 		submitChunkJob(ctx, te, job, pqs)
@@ -1055,7 +1055,7 @@ func (e *Endpoint) chunkify(ctx context.Context, res *resourceKind, now time.Tim
 func (e *Endpoint) collectResource(ctx context.Context, resourceType string, slist *types.SampleList) error {
 	res := e.resourceKinds[resourceType]
 	client, err := e.clientFactory.GetClient(ctx)
-	if config.Config.DebugMode {
+	if config.DebugMode() {
 		log.Printf("D! collectResource  %s ", resourceType)
 	}
 	if err != nil {
@@ -1080,11 +1080,11 @@ func (e *Endpoint) collectResource(ctx context.Context, resourceType string, sli
 		if estInterval < s {
 			estInterval = s
 		}
-		if config.Config.DebugMode {
+		if config.DebugMode() {
 			log.Printf("D! resourceType %s Raw interval %s, padded: %s, estimated: %s", resourceType, rawInterval, paddedInterval, estInterval)
 		}
 	}
-	if config.Config.DebugMode {
+	if config.DebugMode() {
 		log.Printf("D! resourceType %s Interval estimated to %s", resourceType, estInterval)
 	}
 	res.lastColl = localNow
@@ -1092,12 +1092,12 @@ func (e *Endpoint) collectResource(ctx context.Context, resourceType string, sli
 	latest := res.latestSample
 	if !latest.IsZero() {
 		elapsed := now.Sub(latest).Seconds() + 5.0 // Allow 5 second jitter.
-		if config.Config.DebugMode {
+		if config.DebugMode() {
 			log.Printf("D! Latest: %s, elapsed: %f, resource: %s", latest, elapsed, resourceType)
 		}
 		if !res.realTime && elapsed < float64(res.sampling) {
 			// No new data would be available. We're outta here!
-			if config.Config.DebugMode {
+			if config.DebugMode() {
 				log.Printf("D! Sampling period for %s of %d has not elapsed on %s",
 					resourceType, res.sampling, e.URL.Host)
 			}
@@ -1106,7 +1106,7 @@ func (e *Endpoint) collectResource(ctx context.Context, resourceType string, sli
 	} else {
 		latest = now.Add(time.Duration(-res.sampling) * time.Second)
 	}
-	if config.Config.DebugMode {
+	if config.DebugMode() {
 		log.Printf("D! Collecting metrics for %d objects of type %s for %s",
 			len(res.objects), resourceType, e.URL.Host)
 	}
@@ -1121,12 +1121,12 @@ func (e *Endpoint) collectResource(ctx context.Context, resourceType string, sli
 		func(chunk queryChunk) {
 			n, localLatest, err := e.collectChunk(ctx, chunk, res, slist, estInterval)
 			if err != nil {
-				if config.Config.DebugMode {
+				if config.DebugMode() {
 					log.Printf("D! CollectChunk for %s returned %d metrics   err: %s ", resourceType, n, err)
 				}
 				return
 			}
-			if config.Config.DebugMode {
+			if config.DebugMode() {
 				log.Printf("D! CollectChunk for %s returned %d metrics", resourceType, n)
 			}
 			atomic.AddInt64(&count, int64(n))
@@ -1136,13 +1136,13 @@ func (e *Endpoint) collectResource(ctx context.Context, resourceType string, sli
 				latestSample = localLatest
 			}
 		})
-	if config.Config.DebugMode {
+	if config.DebugMode() {
 		log.Printf("D! Latest sample for %s set to %s", resourceType, latestSample)
 	}
 	if !latestSample.IsZero() {
 		res.latestSample = latestSample
 	}
-	if config.Config.DebugMode {
+	if config.DebugMode() {
 		log.Printf("discovered_objects  type is : %s   and number is : %d ", resourceType, count)
 	}
 
@@ -1158,7 +1158,7 @@ func (e *Endpoint) alignSamples(info []gtypes.PerfSampleInfo, values []int64, in
 		// According to the docs, SampleInfo and Value should have the same length, but we've seen corrupted
 		// data coming back with missing values. Take care of that gracefully!
 		if idx >= len(values) {
-			if config.Config.DebugMode {
+			if config.DebugMode() {
 				log.Printf("D! len(SampleInfo)>len(Value) %d > %d during alignment", len(info), len(values))
 			}
 			break
@@ -1190,14 +1190,14 @@ func (e *Endpoint) alignSamples(info []gtypes.PerfSampleInfo, values []int64, in
 }
 
 func (e *Endpoint) collectChunk(ctx context.Context, pqs queryChunk, res *resourceKind, slist *types.SampleList, interval time.Duration) (int, time.Time, error) {
-	if config.Config.DebugMode {
+	if config.DebugMode() {
 		log.Printf("D! Query for %s has %d QuerySpecs", res.name, len(pqs))
 	}
 	latestSample := time.Time{}
 	count := 0
 	resourceType := res.name
 	prefix := resourceType
-	if config.Config.DebugMode {
+	if config.DebugMode() {
 		log.Printf("D! collectChunk for %s", resourceType)
 	}
 	client, err := e.clientFactory.GetClient(ctx)
@@ -1215,7 +1215,7 @@ func (e *Endpoint) collectChunk(ctx context.Context, pqs queryChunk, res *resour
 		log.Printf("W! client.QueryMetrics for %s  error is %s", resourceType, err.Error())
 		return count, latestSample, err
 	}
-	if config.Config.DebugMode {
+	if config.DebugMode() {
 		log.Printf("D! Query for %s returned metrics for %d objects\r\n", resourceType, len(ems))
 	}
 
@@ -1228,7 +1228,7 @@ func (e *Endpoint) collectChunk(ctx context.Context, pqs queryChunk, res *resour
 			continue
 		}
 		buckets := make(map[string]metricEntry)
-		if config.Config.DebugMode {
+		if config.DebugMode() {
 			log.Printf("D! Query for %s  em.Value len is %d \r\n", resourceType, len(em.Value))
 		}
 		for _, v := range em.Value {
@@ -1249,14 +1249,14 @@ func (e *Endpoint) collectChunk(ctx context.Context, pqs queryChunk, res *resour
 
 			nValues := 0
 			alignedInfo, alignedValues := e.alignSamples(em.SampleInfo, v.Value, interval)
-			if config.Config.DebugMode {
+			if config.DebugMode() {
 				log.Printf("D! Query for %s  alignedInfo len is %d \r\n", resourceType, len(alignedInfo))
 			}
 			for idx, sample := range alignedInfo {
 				// According to the docs, SampleInfo and Value should have the same length, but we've seen corrupted
 				// data coming back with missing values. Take care of that gracefully!
 				if idx >= len(alignedValues) {
-					if config.Config.DebugMode {
+					if config.DebugMode() {
 						log.Printf("D! Len(SampleInfo)>len(Value) %d > %d\r\n", len(alignedInfo), len(alignedValues))
 					}
 					break
@@ -1269,7 +1269,7 @@ func (e *Endpoint) collectChunk(ctx context.Context, pqs queryChunk, res *resour
 
 				// Organize the metrics into a bucket per measurement.
 				mn, fn := e.makeMetricIdentifier(prefix, name)
-				if config.Config.DebugMode {
+				if config.DebugMode() {
 					log.Printf("D! makeMetricIdentifier: %s   %s\r\n", prefix, name)
 				}
 				bKey := mn + " " + v.Instance + " " + strconv.FormatInt(ts.UnixNano(), 10)
@@ -1300,7 +1300,7 @@ func (e *Endpoint) collectChunk(ctx context.Context, pqs queryChunk, res *resour
 				e.hwMarks.Put(moid, name, ts)
 			}
 			if nValues == 0 {
-				if config.Config.DebugMode {
+				if config.DebugMode() {
 					log.Printf("D! Missing value for: %s, %s", name, objectRef.name)
 				}
 				continue
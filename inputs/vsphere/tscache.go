@@ -35,7 +35,7 @@ func (t *TSCache) Purge() {
 			n++
 		}
 	}
-	if config.Config.DebugMode {
+	if config.DebugMode() {
 		log.Println(fmt.Sprintf("D! purged timestamp cache. %d deleted with %d remaining", n, len(t.table)))
 	}
 }
@@ -194,7 +194,7 @@ func (v *Instance) Drop() {
 	// after the last Gather() has finished. We do, however, need to
 	// wait for any discovery to complete by trying to grab the
 	// "busy" mutex.
-	if config.Config.DebugMode {
+	if config.DebugMode() {
 		log.Printf("D! Waiting for endpoint %q to finish", v.endpoints.URL.Host)
 	}
 	func() {
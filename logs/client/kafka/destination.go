@@ -117,7 +117,7 @@ func newDestination(endpoint logsconfig.Endpoint, contentType string, destinatio
 			}
 		}
 	}
-	if coreconfig.Config.DebugMode {
+	if coreconfig.DebugMode() {
 		log.Printf("D! saram config: %+v", coreconfig.Config.Logs.Config)
 	}
 
@@ -263,7 +263,7 @@ func (s *Scanner) startNewTailer(file *File, m logsconfig.TailingMode) bool {
 		log.Println("W! Could not recover offset for file with path", file.Path, err)
 	}
 
-	if coreconfig.Config.DebugMode {
+	if coreconfig.DebugMode() {
 		log.Printf("Starting a new tailer for: %s (offset: %d, whence: %d) for tailer key %s\n", file.Path, offset, whence, file.GetScanKey())
 	}
 	err = tailer.Start(offset, whence)
@@ -28,7 +28,7 @@ func (t *Tailer) setup(offset int64, whence int) error {
 	// adds metadata to enable users to filter logs by filename
 	t.tags = t.buildTailerTags()
 
-	if coreconfig.Config.DebugMode {
+	if coreconfig.DebugMode() {
 		log.Println("I! Opening", t.file.Path, "for tailer key", t.file.GetScanKey())
 	}
 	f, err := openFile(fullpath)
@@ -95,7 +95,7 @@ func (p *Processor) processMessage(msg *message.Message) {
 			log.Println("unable to encode msg ", err)
 			return
 		}
-		if coreconfig.Config.DebugMode {
+		if coreconfig.DebugMode() {
 			log.Println("D! log item:", string(content))
 		}
 		msg.Content = content
@@ -274,7 +274,7 @@ func (cf Filter) IsExcluded(containerName, containerImage, podNamespace string)
 	// Check if excludeListed
 	for _, r := range cf.ImageExcludeList {
 		match := r.MatchString(containerImage)
-		if coreconfig.Config.DebugMode {
+		if coreconfig.DebugMode() {
 			log.Printf("D!, exclude item :%+v, container image:%s, %t\n", r, containerImage, match)
 		}
 		if match {
@@ -1,8 +1,10 @@
 package main
 
 import (
+	"bytes"
 	"flag"
 	"fmt"
+	"io"
 	"log"
 	_ "net/http/pprof"
 	"os"
@@ -23,7 +25,10 @@ import (
 	"flashcat.cloud/categraf/api"
 	"flashcat.cloud/categraf/config"
 	"flashcat.cloud/categraf/heartbeat"
+	"flashcat.cloud/categraf/inputs"
+	"flashcat.cloud/categraf/pipeline"
 	"flashcat.cloud/categraf/pkg/osx"
+	"flashcat.cloud/categraf/upgrade"
 	"flashcat.cloud/categraf/writer"
 )
 
@@ -42,6 +47,8 @@ var (
 	status       = flag.Bool("status", false, "Show categraf service status")
 	update       = flag.Bool("update", false, "Update categraf binary")
 	updateFile   = flag.String("update_url", "", "new version for categraf to download")
+	secretSet    = flag.String("secret-set", "", "Store the secret read from stdin in an encrypted secret store, e.g. mystore:key")
+	checkConfig  = flag.Bool("check-config", false, "Validate config.toml and all input configs without connecting anywhere, then exit; inputs are checked by their Validate if any, not by Init")
 )
 
 func init() {
@@ -58,20 +65,20 @@ func init() {
 func initLog(output string) {
 	switch {
 	case output == "stdout":
-		log.SetOutput(os.Stdout)
+		log.SetOutput(config.LevelWriter{Writer: os.Stdout})
 	case output == "stderr":
-		log.SetOutput(os.Stderr)
+		log.SetOutput(config.LevelWriter{Writer: os.Stderr})
 	case len(output) != 0:
-		log.SetOutput(&lumberjack.Logger{
+		log.SetOutput(config.LevelWriter{Writer: &lumberjack.Logger{
 			Filename:   output,
 			MaxSize:    config.Config.Log.MaxSize,
 			MaxAge:     config.Config.Log.MaxAge,
 			MaxBackups: config.Config.Log.MaxBackups,
 			LocalTime:  config.Config.Log.LocalTime,
 			Compress:   config.Config.Log.Compress,
-		})
+		}})
 	default:
-		log.SetOutput(os.Stdout)
+		log.SetOutput(config.LevelWriter{Writer: os.Stdout})
 	}
 }
 
@@ -90,17 +97,33 @@ func main() {
 		return
 	}
 
+	if *secretSet != "" {
+		if err := setSecret(*secretSet); err != nil {
+			log.Fatalln("F! failed to set secret:", err)
+		}
+		return
+	}
+
+	if !*checkConfig {
+		upgrade.Startup()
+	}
+
 	// init configs
 	if err := config.InitConfig(*configDir, *debugMode, *testMode, *interval, *inputFilters); err != nil {
 		log.Fatalln("F! failed to init config:", err)
 	}
 
+	if *checkConfig {
+		os.Exit(checkConfigs())
+	}
+
 	doOSsvc()
 	printEnv()
 
 	initWriters()
 
 	go api.Start()
+	go api.StartGraphite()
 	go heartbeat.Work()
 
 	tcpx.WaitHosts()
@@ -109,13 +132,56 @@ func main() {
 		fmt.Println("F! failed to init agent:", err)
 		os.Exit(-1)
 	}
+	api.SetAgent(ag)
+	heartbeat.SetAgent(ag)
+	go upgrade.Work(func() {
+		ag.Stop()
+		writer.CloseWriters()
+	})
 	runAgent(ag)
 }
 
+// setSecret stores stdin, without the trailing newline, as secret id:key
+func setSecret(ref string) error {
+	parts := strings.SplitN(ref, ":", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return fmt.Errorf("invalid secret reference %q, expected store:key", ref)
+	}
+	value, err := io.ReadAll(os.Stdin)
+	if err != nil {
+		return err
+	}
+	value = bytes.TrimRight(value, "\r\n")
+	return config.SetSecret(*configDir, parts[0], parts[1], value)
+}
+
+// checkConfigs prints every problem of the configs, the exit code is 1 if any,
+// warnings alone do not fail the check
+func checkConfigs() int {
+	problems := writer.CheckWriters()
+	inputProblems, warnings := inputs.CheckConfig(config.Config)
+	problems = append(problems, inputProblems...)
+	for _, w := range warnings {
+		fmt.Println("W!", w)
+	}
+	for _, p := range problems {
+		fmt.Println("E!", p)
+	}
+	if len(problems) > 0 {
+		fmt.Printf("%d problems found in %s\n", len(problems), *configDir)
+		return 1
+	}
+	fmt.Println("configuration ok")
+	return 0
+}
+
 func initWriters() {
 	if err := writer.InitWriters(); err != nil {
 		log.Fatalln("F! failed to init writer:", err)
 	}
+	if err := pipeline.Init(); err != nil {
+		log.Fatalln("F! failed to init processors and aggregators:", err)
+	}
 }
 
 func handleSignal(ag *agent.Agent) {
@@ -140,6 +206,7 @@ EXIT:
 	}
 
 	ag.Stop()
+	writer.CloseWriters()
 	log.Println("I! exited")
 }
 
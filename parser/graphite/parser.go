@@ -0,0 +1,208 @@
+package graphite
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gobwas/glob"
+
+	"flashcat.cloud/categraf/types"
+)
+
+// Parser parses the graphite plaintext protocol, "path value [timestamp]"
+// per line. Templates turn the dotted path into a metric name and labels,
+// e.g. "servers.* .host.measurement*" maps servers.web01.cpu.idle to
+// cpu_idle{host="web01"}.
+type Parser struct {
+	separator string
+	templates []*template
+	// used when no template matches
+	fallback *template
+}
+
+type template struct {
+	filter      glob.Glob
+	filterParts int
+	parts       []string
+	tags        map[string]string
+}
+
+// NewParser compiles templates formatted as "[filter] template [tag1=v1,tag2=v2]",
+// template parts are measurement, measurement*(the remaining parts), field,
+// field*, a label name, or empty to skip the part
+func NewParser(separator string, templates []string) (*Parser, error) {
+	if separator == "" {
+		separator = "_"
+	}
+	p := &Parser{separator: separator}
+	for _, t := range templates {
+		tmpl, err := newTemplate(t)
+		if err != nil {
+			return nil, fmt.Errorf("template %q: %v", t, err)
+		}
+		if tmpl.filter == nil {
+			p.fallback = tmpl
+			continue
+		}
+		p.templates = append(p.templates, tmpl)
+	}
+	// the most specific filter wins
+	sort.SliceStable(p.templates, func(i, j int) bool {
+		return p.templates[i].filterParts > p.templates[j].filterParts
+	})
+	return p, nil
+}
+
+func newTemplate(s string) (*template, error) {
+	fields := strings.Fields(s)
+	var filter, tmpl, tags string
+	switch len(fields) {
+	case 1:
+		tmpl = fields[0]
+	case 2:
+		if strings.Contains(fields[1], "=") {
+			tmpl, tags = fields[0], fields[1]
+		} else {
+			filter, tmpl = fields[0], fields[1]
+		}
+	case 3:
+		filter, tmpl, tags = fields[0], fields[1], fields[2]
+	default:
+		return nil, fmt.Errorf("expected [filter] template [tags]")
+	}
+
+	t := &template{
+		parts: strings.Split(tmpl, "."),
+		tags:  make(map[string]string),
+	}
+	if filter != "" {
+		g, err := glob.Compile(filter, '.')
+		if err != nil {
+			return nil, err
+		}
+		t.filter = g
+		t.filterParts = len(strings.Split(filter, "."))
+	}
+	if tags != "" {
+		for _, kv := range strings.Split(tags, ",") {
+			pair := strings.SplitN(kv, "=", 2)
+			if len(pair) != 2 || pair[0] == "" {
+				return nil, fmt.Errorf("invalid tag %q", kv)
+			}
+			t.tags[pair[0]] = pair[1]
+		}
+	}
+	return t, nil
+}
+
+func (t *template) match(parts []string) bool {
+	if len(parts) < t.filterParts {
+		return false
+	}
+	return t.filter.Match(strings.Join(parts[:t.filterParts], "."))
+}
+
+// apply returns the metric name and labels of the path parts
+func (t *template) apply(parts []string, separator string) (string, map[string]string) {
+	var (
+		names  []string
+		fields []string
+		labels = make(map[string]string, len(t.tags))
+	)
+	for k, v := range t.tags {
+		labels[k] = v
+	}
+	for i, tp := range t.parts {
+		if i >= len(parts) {
+			break
+		}
+		switch tp {
+		case "":
+		case "measurement":
+			names = append(names, parts[i])
+		case "measurement*":
+			names = append(names, parts[i:]...)
+		case "field":
+			fields = append(fields, parts[i])
+		case "field*":
+			fields = append(fields, parts[i:]...)
+		default:
+			if v, ok := labels[tp]; ok {
+				labels[tp] = v + separator + parts[i]
+			} else {
+				labels[tp] = parts[i]
+			}
+		}
+		if strings.HasSuffix(tp, "*") {
+			break
+		}
+	}
+	return strings.Join(append(names, fields...), separator), labels
+}
+
+func (p *Parser) Parse(input []byte, slist *types.SampleList) error {
+	scanner := bufio.NewScanner(bytes.NewReader(input))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		s, err := p.ParseLine(line)
+		if err != nil {
+			log.Println("E! failed to parse graphite line:", line, "error:", err)
+			continue
+		}
+		slist.PushFront(s)
+	}
+	return scanner.Err()
+}
+
+// ParseLine parses one "path value [timestamp]" line
+func (p *Parser) ParseLine(line string) (*types.Sample, error) {
+	fields := strings.Fields(line)
+	if len(fields) != 2 && len(fields) != 3 {
+		return nil, fmt.Errorf("expected path value [timestamp]")
+	}
+	value, err := strconv.ParseFloat(fields[1], 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid value: %v", err)
+	}
+
+	var ts time.Time
+	if len(fields) == 3 {
+		sec, err := strconv.ParseFloat(fields[2], 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid timestamp: %v", err)
+		}
+		// -1 asks for the time of arrival
+		if sec > 0 {
+			ts = time.Unix(0, int64(sec*float64(time.Second)))
+		}
+	}
+
+	parts := strings.Split(fields[0], ".")
+	name, labels := fields[0], map[string]string{}
+	tmpl := p.fallback
+	for _, t := range p.templates {
+		if t.match(parts) {
+			tmpl = t
+			break
+		}
+	}
+	if tmpl != nil {
+		name, labels = tmpl.apply(parts, p.separator)
+	}
+	if name == "" {
+		return nil, fmt.Errorf("no measurement in template for %s", fields[0])
+	}
+
+	s := types.NewSample("", name, value, labels)
+	s.Timestamp = ts
+	return s, nil
+}
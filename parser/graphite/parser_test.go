@@ -0,0 +1,48 @@
+package graphite
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseLineTemplates(t *testing.T) {
+	p, err := NewParser("_", []string{
+		"servers.* .host.measurement* env=prod",
+		"servers.*.disk .host..field",
+		"measurement.measurement",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		line   string
+		metric string
+		labels map[string]string
+	}{
+		{"servers.web01.cpu.idle 98.5 1700000000", "cpu_idle", map[string]string{"host": "web01", "env": "prod"}},
+		{"servers.web01.disk.used 42 1700000000", "used", map[string]string{"host": "web01"}},
+		{"app.requests.total 7 1700000000", "app_requests", map[string]string{}},
+	}
+	for _, c := range cases {
+		s, err := p.ParseLine(c.line)
+		if err != nil {
+			t.Fatalf("%s: %v", c.line, err)
+		}
+		if s.Metric != c.metric || len(s.Labels) != len(c.labels) {
+			t.Fatalf("%s: got %s %v, want %s %v", c.line, s.Metric, s.Labels, c.metric, c.labels)
+		}
+		for k, v := range c.labels {
+			if s.Labels[k] != v {
+				t.Fatalf("%s: label %s=%q, want %q", c.line, k, s.Labels[k], v)
+			}
+		}
+		if !s.Timestamp.Equal(time.Unix(1700000000, 0)) {
+			t.Fatalf("%s: timestamp %s", c.line, s.Timestamp)
+		}
+	}
+
+	if _, err := p.ParseLine("servers.web01.cpu.idle notanumber"); err == nil {
+		t.Fatal("invalid value accepted")
+	}
+}
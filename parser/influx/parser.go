@@ -1,6 +1,7 @@
 package influx
 
 import (
+	"fmt"
 	"log"
 	"strings"
 	"time"
@@ -27,6 +28,25 @@ func NewParser() *Parser {
 	}
 }
 
+// NewParserWithPrecision returns a Parser for timestamps in precision, both
+// the v1(n, u, ms, s) and v2(ns, us, ms, s) names are accepted
+func NewParserWithPrecision(precision string) (*Parser, error) {
+	p := NewParser()
+	switch precision {
+	case "", "n", "ns":
+		p.precision = lineprotocol.Nanosecond
+	case "u", "us":
+		p.precision = lineprotocol.Microsecond
+	case "ms":
+		p.precision = lineprotocol.Millisecond
+	case "s":
+		p.precision = lineprotocol.Second
+	default:
+		return nil, fmt.Errorf("unsupported precision %q", precision)
+	}
+	return p, nil
+}
+
 func (p *Parser) Parse(input []byte, slist *types.SampleList) error {
 	metrics := make([]types.Metric, 0)
 	decoder := lineprotocol.NewDecoderWithBytes(input)
@@ -45,7 +65,9 @@ func (p *Parser) Parse(input []byte, slist *types.SampleList) error {
 		tags := m.Tags()
 		fields := m.Fields()
 		for k, v := range fields {
-			slist.PushSample(name, k, v, tags)
+			s := types.NewSample(name, k, v, tags)
+			s.Timestamp = m.Time()
+			slist.PushFront(s)
 		}
 	}
 
@@ -53,18 +53,27 @@ func (p *Parser) parse(buf []byte, slist *types.SampleList) error {
 		if p.IgnoreMetricsFilter != nil && p.IgnoreMetricsFilter.Match(metricName) {
 			continue
 		}
+		// collect the family apart, so its samples can be tagged with metadata
+		flist := types.NewSampleList()
 		for _, m := range mf.Metric {
 			// reading tags
 			tags := p.makeLabels(m)
 
 			if mf.GetType() == dto.MetricType_SUMMARY {
-				util.HandleSummary(p.NamePrefix, m, tags, metricName, nil, slist)
+				util.HandleSummary(p.NamePrefix, m, tags, metricName, nil, flist)
 			} else if mf.GetType() == dto.MetricType_HISTOGRAM {
-				util.HandleHistogram(p.NamePrefix, m, tags, metricName, nil, slist)
+				util.HandleHistogram(p.NamePrefix, m, tags, metricName, nil, flist)
 			} else {
-				util.HandleGaugeCounter(p.NamePrefix, m, tags, metricName, nil, slist)
+				util.HandleGaugeCounter(p.NamePrefix, m, tags, metricName, nil, flist)
 			}
 		}
+
+		md := util.NewMetadata(mf)
+		samples := flist.PopBackAll()
+		for i := range samples {
+			samples[i].Meta = md
+		}
+		slist.PushFrontN(samples)
 	}
 
 	return nil
@@ -0,0 +1,228 @@
+package pipeline
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"flashcat.cloud/categraf/config"
+	"flashcat.cloud/categraf/pkg/conv"
+	"flashcat.cloud/categraf/types"
+)
+
+var aggregatorStats = map[string]struct{}{
+	"min": {}, "max": {}, "mean": {}, "sum": {}, "count": {}, "last": {}, "rate": {},
+}
+
+// aggregator collects the values of matching series over a window, and emits
+// one summarized series per stat when the window closes
+type aggregator struct {
+	matcher
+	period       time.Duration
+	stats        []string
+	percentiles  []float64
+	dropOriginal bool
+
+	sync.Mutex
+	windows map[string]*window
+}
+
+type window struct {
+	metric string
+	labels map[string]string
+	values []float64
+
+	firstTs, lastTs time.Time
+}
+
+func newAggregator(ac config.AggregatorConfig) (*aggregator, error) {
+	m, err := newMatcher(ac.MetricsPass, ac.MetricsDrop)
+	if err != nil {
+		return nil, err
+	}
+	a := &aggregator{
+		matcher:      m,
+		period:       time.Duration(ac.Period),
+		stats:        ac.Stats,
+		percentiles:  ac.Percentiles,
+		dropOriginal: ac.DropOriginal,
+		windows:      make(map[string]*window),
+	}
+	if a.period <= 0 {
+		a.period = 30 * time.Second
+	}
+	if len(a.stats) == 0 && len(a.percentiles) == 0 {
+		a.stats = []string{"min", "max", "mean"}
+	}
+	for _, s := range a.stats {
+		if _, ok := aggregatorStats[s]; !ok {
+			return nil, fmt.Errorf("unknown stat %q", s)
+		}
+	}
+	for _, p := range a.percentiles {
+		if p <= 0 || p > 100 {
+			return nil, fmt.Errorf("percentile %v out of range (0, 100]", p)
+		}
+	}
+	return a, nil
+}
+
+// add records the matching samples, they are removed from the returned
+// samples if drop_original is set
+func (a *aggregator) add(samples []*types.Sample, now time.Time) []*types.Sample {
+	ret := samples
+	if a.dropOriginal {
+		ret = samples[:0]
+	}
+
+	a.Lock()
+	defer a.Unlock()
+	for _, s := range samples {
+		if s.Histogram != nil || !a.match(s.Metric) {
+			if a.dropOriginal {
+				ret = append(ret, s)
+			}
+			continue
+		}
+		v, err := conv.ToFloat64(s.Value)
+		if err != nil || math.IsNaN(v) {
+			if a.dropOriginal {
+				ret = append(ret, s)
+			}
+			continue
+		}
+		ts := s.Timestamp
+		if ts.IsZero() {
+			ts = now
+		}
+
+		key := seriesKey(s)
+		w, ok := a.windows[key]
+		if !ok {
+			labels := make(map[string]string, len(s.Labels))
+			for k, v := range s.Labels {
+				labels[k] = v
+			}
+			w = &window{metric: s.Metric, labels: labels, firstTs: ts}
+			a.windows[key] = w
+		}
+		w.values = append(w.values, v)
+		w.lastTs = ts
+	}
+	return ret
+}
+
+func (a *aggregator) run(emit func([]*types.Sample), stop <-chan struct{}) {
+	ticker := time.NewTicker(a.period)
+	defer ticker.Stop()
+	for {
+		select {
+		case now := <-ticker.C:
+			emit(a.flush(now))
+		case <-stop:
+			return
+		}
+	}
+}
+
+// flush summarizes and resets all windows
+func (a *aggregator) flush(now time.Time) []*types.Sample {
+	a.Lock()
+	windows := a.windows
+	a.windows = make(map[string]*window, len(windows))
+	a.Unlock()
+
+	ret := make([]*types.Sample, 0, len(windows)*(len(a.stats)+len(a.percentiles)))
+	for _, w := range windows {
+		if len(w.values) == 0 {
+			continue
+		}
+		for _, stat := range a.stats {
+			v, ok := w.stat(stat)
+			if !ok {
+				continue
+			}
+			ret = append(ret, w.sample(stat, v, now))
+		}
+		if len(a.percentiles) > 0 {
+			sorted := make([]float64, len(w.values))
+			copy(sorted, w.values)
+			sort.Float64s(sorted)
+			for _, p := range a.percentiles {
+				ret = append(ret, w.sample(percentileSuffix(p), percentile(sorted, p), now))
+			}
+		}
+	}
+	return ret
+}
+
+func (w *window) sample(suffix string, v float64, ts time.Time) *types.Sample {
+	labels := make(map[string]string, len(w.labels))
+	for k, v := range w.labels {
+		labels[k] = v
+	}
+	return &types.Sample{
+		Metric:    w.metric + "_" + suffix,
+		Timestamp: ts,
+		Value:     v,
+		Labels:    labels,
+		Meta:      &types.Metadata{Type: types.Gauge},
+	}
+}
+
+func (w *window) stat(stat string) (float64, bool) {
+	switch stat {
+	case "min":
+		min := w.values[0]
+		for _, v := range w.values[1:] {
+			min = math.Min(min, v)
+		}
+		return min, true
+	case "max":
+		max := w.values[0]
+		for _, v := range w.values[1:] {
+			max = math.Max(max, v)
+		}
+		return max, true
+	case "sum", "mean":
+		sum := 0.0
+		for _, v := range w.values {
+			sum += v
+		}
+		if stat == "mean" {
+			return sum / float64(len(w.values)), true
+		}
+		return sum, true
+	case "count":
+		return float64(len(w.values)), true
+	case "last":
+		return w.values[len(w.values)-1], true
+	case "rate":
+		// per second increase of a counter, skipped on reset
+		elapsed := w.lastTs.Sub(w.firstTs).Seconds()
+		first, last := w.values[0], w.values[len(w.values)-1]
+		if len(w.values) < 2 || elapsed <= 0 || last < first {
+			return 0, false
+		}
+		return (last - first) / elapsed, true
+	}
+	return 0, false
+}
+
+// percentile uses the nearest rank method on sorted values
+func percentile(sorted []float64, p float64) float64 {
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+// percentileSuffix formats 99 as p99 and 99.9 as p99_9
+func percentileSuffix(p float64) string {
+	return "p" + strings.ReplaceAll(strconv.FormatFloat(p, 'f', -1, 64), ".", "_")
+}
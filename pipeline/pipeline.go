@@ -0,0 +1,162 @@
+package pipeline
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"flashcat.cloud/categraf/config"
+	"flashcat.cloud/categraf/pkg/filter"
+	"flashcat.cloud/categraf/types"
+	"flashcat.cloud/categraf/writer"
+)
+
+// processor transforms the samples of one forward, it may drop samples
+type processor interface {
+	process(samples []*types.Sample) []*types.Sample
+}
+
+type pipeline struct {
+	processors  []processor
+	aggregators []*aggregator
+
+	// closed when the chain is replaced, stops the aggregators
+	stop chan struct{}
+}
+
+// the summaries of aggregators are a source of series of their own
+const aggregatorSource = "aggregator"
+
+var (
+	lock  sync.RWMutex
+	chain *pipeline
+
+	// emit writes the summaries flushed by aggregators
+	emit = func(samples []*types.Sample) {
+		writer.WriteSamples(writer.GuardSamples(aggregatorSource, samples))
+	}
+)
+
+// Init builds the global processors and aggregators, aggregators flush their
+// summaries to the writers every period. The aggregators of a previous chain
+// are stopped.
+func Init() error {
+	p, err := newPipeline(config.Config.Processors, config.Config.Aggregators)
+	if err != nil {
+		return err
+	}
+
+	lock.Lock()
+	old := chain
+	chain = p
+	lock.Unlock()
+
+	if old != nil {
+		close(old.stop)
+	}
+	if p != nil {
+		for _, a := range p.aggregators {
+			go a.run(emit, p.stop)
+		}
+	}
+	return nil
+}
+
+func newPipeline(pcs []config.ProcessorConfig, acs []config.AggregatorConfig) (*pipeline, error) {
+	if len(pcs) == 0 && len(acs) == 0 {
+		return nil, nil
+	}
+	p := &pipeline{stop: make(chan struct{})}
+	for i, pc := range pcs {
+		proc, err := newProcessor(pc)
+		if err != nil {
+			return nil, fmt.Errorf("processors[%d]: %v", i, err)
+		}
+		p.processors = append(p.processors, proc)
+	}
+	for i, ac := range acs {
+		agg, err := newAggregator(ac)
+		if err != nil {
+			return nil, fmt.Errorf("aggregators[%d]: %v", i, err)
+		}
+		p.aggregators = append(p.aggregators, agg)
+	}
+	return p, nil
+}
+
+// Apply runs the samples through the processors and aggregators, the
+// samples left for the writers are returned
+func Apply(samples []*types.Sample) []*types.Sample {
+	lock.RLock()
+	p := chain
+	lock.RUnlock()
+	if p == nil {
+		return samples
+	}
+	return p.apply(samples, time.Now())
+}
+
+func (p *pipeline) apply(samples []*types.Sample, now time.Time) []*types.Sample {
+	for _, proc := range p.processors {
+		samples = proc.process(samples)
+	}
+	for _, agg := range p.aggregators {
+		samples = agg.add(samples, now)
+	}
+	return samples
+}
+
+// matcher selects samples by metrics_pass and metrics_drop
+type matcher struct {
+	pass filter.Filter
+	drop filter.Filter
+}
+
+func newMatcher(pass, drop []string) (matcher, error) {
+	var (
+		m   matcher
+		err error
+	)
+	if len(pass) > 0 {
+		if m.pass, err = filter.Compile(pass); err != nil {
+			return m, err
+		}
+	}
+	if len(drop) > 0 {
+		if m.drop, err = filter.Compile(drop); err != nil {
+			return m, err
+		}
+	}
+	return m, nil
+}
+
+func (m matcher) match(metric string) bool {
+	if m.drop != nil && m.drop.Match(metric) {
+		return false
+	}
+	if m.pass != nil && !m.pass.Match(metric) {
+		return false
+	}
+	return true
+}
+
+// seriesKey identifies a series by its name and labels
+func seriesKey(s *types.Sample) string {
+	names := make([]string, 0, len(s.Labels))
+	for k := range s.Labels {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	var sb strings.Builder
+	sb.WriteString(s.Metric)
+	for _, k := range names {
+		sb.WriteByte(0)
+		sb.WriteString(k)
+		sb.WriteByte(0)
+		sb.WriteString(s.Labels[k])
+	}
+	return sb.String()
+}
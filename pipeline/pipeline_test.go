@@ -0,0 +1,105 @@
+package pipeline
+
+import (
+	"testing"
+	"time"
+
+	"flashcat.cloud/categraf/config"
+	"flashcat.cloud/categraf/types"
+)
+
+func TestPipelineProcessAndAggregate(t *testing.T) {
+	p, err := newPipeline([]config.ProcessorConfig{
+		{Type: config.ProcessorRename, MetricRenames: map[string]string{"cpu_usage": "cpu_usage_percent"}},
+		{Type: config.ProcessorConvert, MetricsPass: []string{"cpu_*"}, Scale: 100},
+		{Type: config.ProcessorLabelAllow, Labels: []string{"cpu"}},
+	}, []config.AggregatorConfig{
+		{MetricsPass: []string{"cpu_usage_percent"}, Stats: []string{"min", "max", "rate"}, Percentiles: []float64{50}, DropOriginal: true},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Unix(1700000000, 0)
+	for i, v := range []float64{0.1, 0.3, 0.2} {
+		ss := []*types.Sample{
+			{Metric: "cpu_usage", Value: v, Timestamp: start.Add(time.Duration(i) * 10 * time.Second),
+				Labels: map[string]string{"cpu": "cpu0", "pid": "1"}},
+			{Metric: "mem_used", Value: 1, Labels: map[string]string{"pid": "1"}},
+		}
+		left := p.apply(ss, start)
+		if len(left) != 1 || left[0].Metric != "mem_used" {
+			t.Fatalf("unexpected samples left for writers: %+v", left)
+		}
+	}
+
+	got := map[string]float64{}
+	for _, s := range p.aggregators[0].flush(start.Add(time.Minute)) {
+		if _, ok := s.Labels["pid"]; ok || s.Labels["cpu"] != "cpu0" {
+			t.Fatalf("unexpected labels: %v", s.Labels)
+		}
+		got[s.Metric] = s.Value.(float64)
+	}
+	want := map[string]float64{
+		"cpu_usage_percent_min":  10,
+		"cpu_usage_percent_max":  30,
+		"cpu_usage_percent_rate": 0.5,
+		"cpu_usage_percent_p50":  20,
+	}
+	for k, v := range want {
+		if d := got[k] - v; d > 1e-9 || d < -1e-9 {
+			t.Fatalf("%s = %v, want %v (all: %v)", k, got[k], v, got)
+		}
+	}
+	if len(p.aggregators[0].flush(start.Add(2*time.Minute))) != 0 {
+		t.Fatal("windows are not reset after flush")
+	}
+}
+
+func TestDedupUnchangedValues(t *testing.T) {
+	proc, err := newProcessor(config.ProcessorConfig{Type: config.ProcessorDedup, DedupInterval: config.Duration(time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := 0
+	for _, v := range []float64{1, 1, 2, 2, 1} {
+		n += len(proc.process([]*types.Sample{{Metric: "up", Value: v, Labels: map[string]string{}}}))
+	}
+	if n != 3 {
+		t.Fatalf("%d samples emitted, want 3", n)
+	}
+}
+
+func TestInitRestartsAggregators(t *testing.T) {
+	config.Config = &config.ConfigType{}
+	flushed := make(chan string, 16)
+	defer func(old func([]*types.Sample)) { emit = old }(emit)
+	emit = func(samples []*types.Sample) {
+		for _, s := range samples {
+			flushed <- s.Metric
+		}
+	}
+
+	for _, metric := range []string{"first", "second"} {
+		config.Config.Aggregators = []config.AggregatorConfig{
+			{MetricsPass: []string{metric}, Stats: []string{"last"}, Period: config.Duration(10 * time.Millisecond)},
+		}
+		if err := Init(); err != nil {
+			t.Fatal(err)
+		}
+		Apply([]*types.Sample{{Metric: metric, Value: 1, Labels: map[string]string{}}})
+		select {
+		case got := <-flushed:
+			if got != metric+"_last" {
+				t.Fatalf("flushed %s, want %s_last", got, metric)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("aggregators of chain %s never flushed", metric)
+		}
+	}
+
+	config.Config.Aggregators = nil
+	if err := Init(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,160 @@
+package pipeline
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"flashcat.cloud/categraf/config"
+	"flashcat.cloud/categraf/pkg/conv"
+	"flashcat.cloud/categraf/types"
+)
+
+func newProcessor(pc config.ProcessorConfig) (processor, error) {
+	m, err := newMatcher(pc.MetricsPass, pc.MetricsDrop)
+	if err != nil {
+		return nil, err
+	}
+	switch pc.Type {
+	case config.ProcessorRename:
+		if len(pc.MetricRenames) == 0 && len(pc.LabelRenames) == 0 {
+			return nil, fmt.Errorf("rename: metric_renames or label_renames required")
+		}
+		return &rename{matcher: m, metrics: pc.MetricRenames, labels: pc.LabelRenames}, nil
+	case config.ProcessorConvert:
+		scale := pc.Scale
+		if scale == 0 {
+			scale = 1
+		}
+		return &convert{matcher: m, scale: scale, offset: pc.Offset}, nil
+	case config.ProcessorLabelAllow:
+		allow := make(map[string]struct{}, len(pc.Labels))
+		for _, l := range pc.Labels {
+			allow[l] = struct{}{}
+		}
+		return &labelAllow{matcher: m, allow: allow}, nil
+	case config.ProcessorDedup:
+		interval := time.Duration(pc.DedupInterval)
+		if interval <= 0 {
+			interval = 10 * time.Minute
+		}
+		return &dedup{matcher: m, interval: interval, seen: make(map[string]dedupEntry)}, nil
+	default:
+		return nil, fmt.Errorf("unknown processor type %q", pc.Type)
+	}
+}
+
+type rename struct {
+	matcher
+	metrics map[string]string
+	labels  map[string]string
+}
+
+func (r *rename) process(samples []*types.Sample) []*types.Sample {
+	for _, s := range samples {
+		if !r.match(s.Metric) {
+			continue
+		}
+		if name, ok := r.metrics[s.Metric]; ok {
+			s.Metric = name
+		}
+		for from, to := range r.labels {
+			if v, ok := s.Labels[from]; ok {
+				delete(s.Labels, from)
+				s.Labels[to] = v
+			}
+		}
+	}
+	return samples
+}
+
+type convert struct {
+	matcher
+	scale  float64
+	offset float64
+}
+
+func (c *convert) process(samples []*types.Sample) []*types.Sample {
+	for _, s := range samples {
+		if s.Histogram != nil || !c.match(s.Metric) {
+			continue
+		}
+		v, err := conv.ToFloat64(s.Value)
+		if err != nil {
+			continue
+		}
+		s.Value = v*c.scale + c.offset
+	}
+	return samples
+}
+
+type labelAllow struct {
+	matcher
+	allow map[string]struct{}
+}
+
+func (l *labelAllow) process(samples []*types.Sample) []*types.Sample {
+	for _, s := range samples {
+		if !l.match(s.Metric) {
+			continue
+		}
+		for k := range s.Labels {
+			if _, ok := l.allow[k]; !ok {
+				delete(s.Labels, k)
+			}
+		}
+	}
+	return samples
+}
+
+type dedupEntry struct {
+	value   float64
+	emitted time.Time
+}
+
+// dedup drops samples whose value did not change since the last one emitted,
+// a sample is emitted at least once per interval
+type dedup struct {
+	matcher
+	interval time.Duration
+
+	sync.Mutex
+	seen      map[string]dedupEntry
+	lastSweep time.Time
+}
+
+func (d *dedup) process(samples []*types.Sample) []*types.Sample {
+	now := time.Now()
+	ret := samples[:0]
+
+	d.Lock()
+	defer d.Unlock()
+	for _, s := range samples {
+		if s.Histogram != nil || !d.match(s.Metric) {
+			ret = append(ret, s)
+			continue
+		}
+		v, err := conv.ToFloat64(s.Value)
+		if err != nil {
+			ret = append(ret, s)
+			continue
+		}
+		key := seriesKey(s)
+		if e, ok := d.seen[key]; ok && e.value == v && now.Sub(e.emitted) < d.interval {
+			continue
+		}
+		d.seen[key] = dedupEntry{value: v, emitted: now}
+		ret = append(ret, s)
+	}
+
+	// forget series gone for a while
+	if now.Sub(d.lastSweep) > d.interval {
+		for key, e := range d.seen {
+			if now.Sub(e.emitted) > 2*d.interval {
+				delete(d.seen, key)
+			}
+		}
+		d.lastSweep = now
+	}
+	return ret
+}
@@ -6,6 +6,7 @@ import (
 	"path"
 	"strings"
 
+	"github.com/BurntSushi/toml"
 	"github.com/koding/multiconfig"
 	"github.com/toolkits/pkg/file"
 )
@@ -143,3 +144,28 @@ func LoadSingleConfig(c ConfigWithFormat, configPtr interface{}) error {
 	}
 	return m.Load(configPtr)
 }
+
+// UndecodedKeys returns the keys of the toml configs that do not match any
+// field of configPtr, they are usually typos. Other formats are not checked.
+func UndecodedKeys(configs []ConfigWithFormat, configPtr interface{}) ([]string, error) {
+	var tBuf []byte
+	for _, c := range configs {
+		if c.Format == TomlFormat {
+			tBuf = append(tBuf, []byte("\n\n")...)
+			tBuf = append(tBuf, []byte(c.Config)...)
+		}
+	}
+	if len(tBuf) == 0 {
+		return nil, nil
+	}
+
+	md, err := toml.Decode(string(tBuf), configPtr)
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]string, 0)
+	for _, k := range md.Undecoded() {
+		keys = append(keys, k.String())
+	}
+	return keys, nil
+}
@@ -16,6 +16,7 @@ import (
 	"github.com/prometheus/common/expfmt"
 
 	"flashcat.cloud/categraf/pkg/prom"
+	"flashcat.cloud/categraf/pkg/prom/writev2"
 	"flashcat.cloud/categraf/types"
 )
 
@@ -82,6 +83,34 @@ func HandleHistogram(defaultPrefix string, m *dto.Metric, tags map[string]string
 		value := float64(b.GetCumulativeCount())
 		slist.PushFront(types.NewSample("", prom.BuildMetric(namePrefix, metricName, "bucket"), value, tags, map[string]string{"le": le}).SetTime(fn(m.GetTimestampMs())))
 	}
+
+	// native buckets are kept as one histogram sample, writers that do not speak
+	// native histograms still get the series above
+	if writev2.IsNative(m.GetHistogram()) {
+		s := types.NewSample("", prom.BuildMetric(namePrefix, metricName), nil, tags).SetTime(fn(m.GetTimestampMs()))
+		s.Histogram = m.GetHistogram()
+		slist.PushFront(s)
+	}
+}
+
+// NewMetadata returns the type and help of a metric family
+func NewMetadata(mf *dto.MetricFamily) *types.Metadata {
+	md := &types.Metadata{
+		Help: mf.GetHelp(),
+	}
+	switch mf.GetType() {
+	case dto.MetricType_COUNTER:
+		md.Type = types.Counter
+	case dto.MetricType_GAUGE:
+		md.Type = types.Gauge
+	case dto.MetricType_SUMMARY:
+		md.Type = types.Summary
+	case dto.MetricType_HISTOGRAM, dto.MetricType_GAUGE_HISTOGRAM:
+		md.Type = types.Histogram
+	default:
+		md.Type = types.Untyped
+	}
+	return md
 }
 
 func HandleGaugeCounter(defaultPrefix string, m *dto.Metric, tags map[string]string, metricName string, tf timeFn, slist *types.SampleList) {
@@ -0,0 +1,437 @@
+// Package writev2 encodes Prometheus remote write 2.0 requests
+// (io.prometheus.write.v2.Request) and native histograms.
+//
+// The prompb package pinned by this module predates native histograms, so the
+// messages are encoded by hand. A native histogram has the same wire format in
+// remote write 1.0 (prometheus.TimeSeries field 4) and 2.0 (field 3), which lets
+// histograms travel inside prompb.TimeSeries as unrecognized fields.
+package writev2
+
+import (
+	"errors"
+	"math"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/prometheus/prompb"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+const (
+	ContentType = "application/x-protobuf;proto=io.prometheus.write.v2.Request"
+	Version     = "2.0.0"
+
+	// field number of histograms in prometheus.TimeSeries of remote write 1.0
+	V1HistogramsField protowire.Number = 4
+)
+
+// MetricType is io.prometheus.write.v2.Metadata.MetricType
+type MetricType int32
+
+const (
+	MetricTypeUnspecified MetricType = iota
+	MetricTypeCounter
+	MetricTypeGauge
+	MetricTypeHistogram
+	MetricTypeGaugeHistogram
+	MetricTypeSummary
+	MetricTypeInfo
+	MetricTypeStateset
+)
+
+type Metadata struct {
+	Type MetricType
+	Help string
+	Unit string
+}
+
+type BucketSpan struct {
+	Offset int32
+	Length uint32
+}
+
+// Histogram is a native histogram with integer counts
+type Histogram struct {
+	Count          uint64
+	Sum            float64
+	Schema         int32
+	ZeroThreshold  float64
+	ZeroCount      uint64
+	NegativeSpans  []BucketSpan
+	NegativeDeltas []int64
+	PositiveSpans  []BucketSpan
+	PositiveDeltas []int64
+	Timestamp      int64
+}
+
+// IsNative reports whether a client_model histogram carries native buckets
+func IsNative(h *dto.Histogram) bool {
+	if h == nil {
+		return false
+	}
+	return h.Schema != nil || h.ZeroThreshold != nil || len(h.PositiveSpan) > 0 || len(h.NegativeSpan) > 0
+}
+
+// FromDTO converts a client_model native histogram observed at timestamp(ms)
+func FromDTO(h *dto.Histogram, timestamp int64) *Histogram {
+	ret := &Histogram{
+		Count:          h.GetSampleCount(),
+		Sum:            h.GetSampleSum(),
+		Schema:         h.GetSchema(),
+		ZeroThreshold:  h.GetZeroThreshold(),
+		ZeroCount:      h.GetZeroCount(),
+		NegativeDeltas: h.GetNegativeDelta(),
+		PositiveDeltas: h.GetPositiveDelta(),
+		Timestamp:      timestamp,
+	}
+	for _, s := range h.GetNegativeSpan() {
+		ret.NegativeSpans = append(ret.NegativeSpans, BucketSpan{Offset: s.GetOffset(), Length: s.GetLength()})
+	}
+	for _, s := range h.GetPositiveSpan() {
+		ret.PositiveSpans = append(ret.PositiveSpans, BucketSpan{Offset: s.GetOffset(), Length: s.GetLength()})
+	}
+	return ret
+}
+
+// Marshal encodes the histogram message body
+func (h *Histogram) Marshal() []byte {
+	var b []byte
+	b = protowire.AppendTag(b, 1, protowire.VarintType)
+	b = protowire.AppendVarint(b, h.Count)
+	b = appendDouble(b, 3, h.Sum)
+	b = protowire.AppendTag(b, 4, protowire.VarintType)
+	b = protowire.AppendVarint(b, protowire.EncodeZigZag(int64(h.Schema)))
+	b = appendDouble(b, 5, h.ZeroThreshold)
+	b = protowire.AppendTag(b, 6, protowire.VarintType)
+	b = protowire.AppendVarint(b, h.ZeroCount)
+	b = appendSpans(b, 8, h.NegativeSpans)
+	b = appendSint64s(b, 9, h.NegativeDeltas)
+	b = appendSpans(b, 11, h.PositiveSpans)
+	b = appendSint64s(b, 12, h.PositiveDeltas)
+	b = protowire.AppendTag(b, 15, protowire.VarintType)
+	b = protowire.AppendVarint(b, uint64(h.Timestamp))
+	return b
+}
+
+// AppendV1 appends the histogram as field 4 of a remote write 1.0 TimeSeries,
+// the result is meant for prompb.TimeSeries.XXX_unrecognized
+func (h *Histogram) AppendV1(b []byte) []byte {
+	b = protowire.AppendTag(b, V1HistogramsField, protowire.BytesType)
+	return protowire.AppendBytes(b, h.Marshal())
+}
+
+var errInvalidHistogram = errors.New("invalid native histogram")
+
+// ParseV1 returns the histograms appended by AppendV1 to the unrecognized
+// fields of a remote write 1.0 TimeSeries
+func ParseV1(unknown []byte) ([]*Histogram, error) {
+	var ret []*Histogram
+	for len(unknown) > 0 {
+		num, typ, n := protowire.ConsumeTag(unknown)
+		if n < 0 {
+			return nil, errInvalidHistogram
+		}
+		m := protowire.ConsumeFieldValue(num, typ, unknown[n:])
+		if m < 0 {
+			return nil, errInvalidHistogram
+		}
+		if num == V1HistogramsField && typ == protowire.BytesType {
+			v, _ := protowire.ConsumeBytes(unknown[n:])
+			h := &Histogram{}
+			if err := h.Unmarshal(v); err != nil {
+				return nil, err
+			}
+			ret = append(ret, h)
+		}
+		unknown = unknown[n+m:]
+	}
+	return ret, nil
+}
+
+// Unmarshal decodes a histogram message body with integer counts
+func (h *Histogram) Unmarshal(b []byte) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return errInvalidHistogram
+		}
+		b = b[n:]
+		var (
+			v uint64
+			m int
+		)
+		switch typ {
+		case protowire.VarintType:
+			v, m = protowire.ConsumeVarint(b)
+		case protowire.Fixed64Type:
+			v, m = protowire.ConsumeFixed64(b)
+		case protowire.BytesType:
+			var bs []byte
+			bs, m = protowire.ConsumeBytes(b)
+			if m >= 0 {
+				switch num {
+				case 8, 11:
+					span, err := parseSpan(bs)
+					if err != nil {
+						return err
+					}
+					if num == 8 {
+						h.NegativeSpans = append(h.NegativeSpans, span)
+					} else {
+						h.PositiveSpans = append(h.PositiveSpans, span)
+					}
+				case 9, 12:
+					deltas, err := parseSint64s(bs)
+					if err != nil {
+						return err
+					}
+					if num == 9 {
+						h.NegativeDeltas = append(h.NegativeDeltas, deltas...)
+					} else {
+						h.PositiveDeltas = append(h.PositiveDeltas, deltas...)
+					}
+				}
+			}
+		default:
+			m = protowire.ConsumeFieldValue(num, typ, b)
+		}
+		if m < 0 {
+			return errInvalidHistogram
+		}
+		b = b[m:]
+
+		switch {
+		case num == 1 && typ == protowire.VarintType:
+			h.Count = v
+		case num == 3 && typ == protowire.Fixed64Type:
+			h.Sum = math.Float64frombits(v)
+		case num == 4 && typ == protowire.VarintType:
+			h.Schema = int32(protowire.DecodeZigZag(v))
+		case num == 5 && typ == protowire.Fixed64Type:
+			h.ZeroThreshold = math.Float64frombits(v)
+		case num == 6 && typ == protowire.VarintType:
+			h.ZeroCount = v
+		case num == 15 && typ == protowire.VarintType:
+			h.Timestamp = int64(v)
+		}
+	}
+	return nil
+}
+
+func parseSpan(b []byte) (BucketSpan, error) {
+	var span BucketSpan
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return span, errInvalidHistogram
+		}
+		if typ != protowire.VarintType {
+			m := protowire.ConsumeFieldValue(num, typ, b[n:])
+			if m < 0 {
+				return span, errInvalidHistogram
+			}
+			b = b[n+m:]
+			continue
+		}
+		v, m := protowire.ConsumeVarint(b[n:])
+		if m < 0 {
+			return span, errInvalidHistogram
+		}
+		switch num {
+		case 1:
+			span.Offset = int32(protowire.DecodeZigZag(v))
+		case 2:
+			span.Length = uint32(v)
+		}
+		b = b[n+m:]
+	}
+	return span, nil
+}
+
+func parseSint64s(b []byte) ([]int64, error) {
+	var ret []int64
+	for len(b) > 0 {
+		v, n := protowire.ConsumeVarint(b)
+		if n < 0 {
+			return nil, errInvalidHistogram
+		}
+		ret = append(ret, protowire.DecodeZigZag(v))
+		b = b[n:]
+	}
+	return ret, nil
+}
+
+// BucketCounts expands spans and delta encoded counts into the absolute
+// counts of consecutive buckets, the first one of index first
+func BucketCounts(spans []BucketSpan, deltas []int64) (first int32, counts []uint64) {
+	var (
+		index int32
+		count int64
+		d     int
+	)
+	for i, span := range spans {
+		index += span.Offset
+		if i == 0 {
+			first = index
+		}
+		for j := uint32(0); j < span.Length && d < len(deltas); j++ {
+			// gaps between spans are empty buckets
+			for int32(len(counts)) < index-first {
+				counts = append(counts, 0)
+			}
+			count += deltas[d]
+			d++
+			counts = append(counts, uint64(count))
+			index++
+		}
+	}
+	return first, counts
+}
+
+// Request builds a remote write 2.0 request, interning strings into its symbol table
+type Request struct {
+	symbols []string
+	refs    map[string]uint32
+	series  []byte
+}
+
+func NewRequest() *Request {
+	return &Request{
+		// the first symbol must be the empty string
+		symbols: []string{""},
+		refs:    map[string]uint32{"": 0},
+	}
+}
+
+func (r *Request) ref(s string) uint32 {
+	if ref, ok := r.refs[s]; ok {
+		return ref
+	}
+	ref := uint32(len(r.symbols))
+	r.symbols = append(r.symbols, s)
+	r.refs[s] = ref
+	return ref
+}
+
+// AddTimeSeries converts a remote write 1.0 series, including the native
+// histograms kept in its unrecognized fields, md may be nil
+func (r *Request) AddTimeSeries(ts *prompb.TimeSeries, md *Metadata) {
+	var b []byte
+
+	refs := make([]uint64, 0, len(ts.Labels)*2)
+	for _, l := range ts.Labels {
+		refs = append(refs, uint64(r.ref(l.Name)), uint64(r.ref(l.Value)))
+	}
+	b = appendPackedVarints(b, 1, refs)
+
+	for _, s := range ts.Samples {
+		var sb []byte
+		sb = appendDouble(sb, 1, s.Value)
+		sb = protowire.AppendTag(sb, 2, protowire.VarintType)
+		sb = protowire.AppendVarint(sb, uint64(s.Timestamp))
+		b = protowire.AppendTag(b, 2, protowire.BytesType)
+		b = protowire.AppendBytes(b, sb)
+	}
+
+	// re-tag histograms of remote write 1.0 as field 3
+	unknown := ts.XXX_unrecognized
+	for len(unknown) > 0 {
+		num, typ, n := protowire.ConsumeTag(unknown)
+		if n < 0 {
+			break
+		}
+		m := protowire.ConsumeFieldValue(num, typ, unknown[n:])
+		if m < 0 {
+			break
+		}
+		if num == V1HistogramsField && typ == protowire.BytesType {
+			v, _ := protowire.ConsumeBytes(unknown[n:])
+			b = protowire.AppendTag(b, 3, protowire.BytesType)
+			b = protowire.AppendBytes(b, v)
+		}
+		unknown = unknown[n+m:]
+	}
+
+	for _, e := range ts.Exemplars {
+		var eb []byte
+		erefs := make([]uint64, 0, len(e.Labels)*2)
+		for _, l := range e.Labels {
+			erefs = append(erefs, uint64(r.ref(l.Name)), uint64(r.ref(l.Value)))
+		}
+		eb = appendPackedVarints(eb, 1, erefs)
+		eb = appendDouble(eb, 2, e.Value)
+		eb = protowire.AppendTag(eb, 3, protowire.VarintType)
+		eb = protowire.AppendVarint(eb, uint64(e.Timestamp))
+		b = protowire.AppendTag(b, 4, protowire.BytesType)
+		b = protowire.AppendBytes(b, eb)
+	}
+
+	if md != nil {
+		var mb []byte
+		mb = protowire.AppendTag(mb, 1, protowire.VarintType)
+		mb = protowire.AppendVarint(mb, uint64(md.Type))
+		if md.Help != "" {
+			mb = protowire.AppendTag(mb, 3, protowire.VarintType)
+			mb = protowire.AppendVarint(mb, uint64(r.ref(md.Help)))
+		}
+		if md.Unit != "" {
+			mb = protowire.AppendTag(mb, 4, protowire.VarintType)
+			mb = protowire.AppendVarint(mb, uint64(r.ref(md.Unit)))
+		}
+		b = protowire.AppendTag(b, 5, protowire.BytesType)
+		b = protowire.AppendBytes(b, mb)
+	}
+
+	r.series = protowire.AppendTag(r.series, 5, protowire.BytesType)
+	r.series = protowire.AppendBytes(r.series, b)
+}
+
+// Marshal encodes the request, it is not snappy compressed
+func (r *Request) Marshal() []byte {
+	var b []byte
+	for _, s := range r.symbols {
+		b = protowire.AppendTag(b, 4, protowire.BytesType)
+		b = protowire.AppendString(b, s)
+	}
+	return append(b, r.series...)
+}
+
+func appendDouble(b []byte, num protowire.Number, v float64) []byte {
+	b = protowire.AppendTag(b, num, protowire.Fixed64Type)
+	return protowire.AppendFixed64(b, math.Float64bits(v))
+}
+
+func appendPackedVarints(b []byte, num protowire.Number, vs []uint64) []byte {
+	if len(vs) == 0 {
+		return b
+	}
+	var pb []byte
+	for _, v := range vs {
+		pb = protowire.AppendVarint(pb, v)
+	}
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, pb)
+}
+
+func appendSint64s(b []byte, num protowire.Number, vs []int64) []byte {
+	if len(vs) == 0 {
+		return b
+	}
+	us := make([]uint64, 0, len(vs))
+	for _, v := range vs {
+		us = append(us, protowire.EncodeZigZag(v))
+	}
+	return appendPackedVarints(b, num, us)
+}
+
+func appendSpans(b []byte, num protowire.Number, spans []BucketSpan) []byte {
+	for _, s := range spans {
+		var sb []byte
+		sb = protowire.AppendTag(sb, 1, protowire.VarintType)
+		sb = protowire.AppendVarint(sb, protowire.EncodeZigZag(int64(s.Offset)))
+		sb = protowire.AppendTag(sb, 2, protowire.VarintType)
+		sb = protowire.AppendVarint(sb, uint64(s.Length))
+		b = protowire.AppendTag(b, num, protowire.BytesType)
+		b = protowire.AppendBytes(b, sb)
+	}
+	return b
+}
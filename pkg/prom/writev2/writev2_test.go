@@ -0,0 +1,93 @@
+package writev2
+
+import (
+	"testing"
+
+	"github.com/prometheus/prometheus/prompb"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+func TestRequestSymbolsAndHistograms(t *testing.T) {
+	h := &Histogram{Count: 3, Sum: 1.5, Schema: 1, PositiveSpans: []BucketSpan{{Offset: 0, Length: 2}}, PositiveDeltas: []int64{1, 1}}
+	ts := prompb.TimeSeries{
+		Labels:           []prompb.Label{{Name: "__name__", Value: "latency"}, {Name: "job", Value: "latency"}},
+		XXX_unrecognized: h.AppendV1(nil),
+	}
+
+	req := NewRequest()
+	req.AddTimeSeries(&ts, &Metadata{Type: MetricTypeHistogram, Help: "request latency"})
+	b := req.Marshal()
+
+	var symbols []string
+	var series []byte
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 || typ != protowire.BytesType {
+			t.Fatalf("unexpected field %d type %d", num, typ)
+		}
+		v, m := protowire.ConsumeBytes(b[n:])
+		switch num {
+		case 4:
+			symbols = append(symbols, string(v))
+		case 5:
+			series = v
+		}
+		b = b[n+m:]
+	}
+
+	// "latency" is interned once
+	want := []string{"", "__name__", "latency", "job", "request latency"}
+	if len(symbols) != len(want) {
+		t.Fatalf("got symbols %q, want %q", symbols, want)
+	}
+	for i := range want {
+		if symbols[i] != want[i] {
+			t.Fatalf("got symbols %q, want %q", symbols, want)
+		}
+	}
+
+	histograms := 0
+	for len(series) > 0 {
+		num, typ, n := protowire.ConsumeTag(series)
+		m := protowire.ConsumeFieldValue(num, typ, series[n:])
+		if num == 3 {
+			v, _ := protowire.ConsumeBytes(series[n:])
+			if string(v) != string(h.Marshal()) {
+				t.Fatal("histogram was not carried over verbatim")
+			}
+			histograms++
+		}
+		series = series[n+m:]
+	}
+	if histograms != 1 {
+		t.Fatalf("got %d histograms, want 1", histograms)
+	}
+}
+
+func TestParseV1(t *testing.T) {
+	h := &Histogram{
+		Count: 7, Sum: 4.5, Schema: -1, ZeroThreshold: 0.001, ZeroCount: 1, Timestamp: 1000,
+		PositiveSpans:  []BucketSpan{{Offset: 1, Length: 2}, {Offset: 2, Length: 1}},
+		PositiveDeltas: []int64{1, 2, -1},
+		NegativeSpans:  []BucketSpan{{Offset: -2, Length: 1}},
+		NegativeDeltas: []int64{1},
+	}
+	got, err := ParseV1(h.AppendV1(nil))
+	if err != nil || len(got) != 1 {
+		t.Fatalf("got %v %v", got, err)
+	}
+	if string(got[0].Marshal()) != string(h.Marshal()) {
+		t.Fatalf("got %+v, want %+v", got[0], h)
+	}
+
+	first, counts := BucketCounts(h.PositiveSpans, h.PositiveDeltas)
+	want := []uint64{1, 3, 0, 0, 2}
+	if first != 1 || len(counts) != len(want) {
+		t.Fatalf("got first %d counts %v", first, counts)
+	}
+	for i := range want {
+		if counts[i] != want[i] {
+			t.Fatalf("got counts %v, want %v", counts, want)
+		}
+	}
+}
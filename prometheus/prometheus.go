@@ -485,7 +485,7 @@ func Start() {
 		},
 	}
 
-	if coreconfig.Config.DebugMode || coreconfig.Config.TestMode {
+	if coreconfig.DebugMode() || coreconfig.Config.TestMode {
 		cfg.promlogConfig.Level.Set("debug")
 	} else {
 		cfg.promlogConfig.Level.Set(coreconfig.Config.Prometheus.LogLevel)
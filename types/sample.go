@@ -4,10 +4,12 @@ import (
 	"strings"
 	"time"
 
+	dto "github.com/prometheus/client_model/go"
 	"github.com/prometheus/common/model"
 	"github.com/prometheus/prometheus/prompb"
 
 	"flashcat.cloud/categraf/pkg/conv"
+	"flashcat.cloud/categraf/pkg/prom/writev2"
 )
 
 type Sample struct {
@@ -15,6 +17,18 @@ type Sample struct {
 	Timestamp time.Time         `json:"timestamp"`
 	Value     interface{}       `json:"value"`
 	Labels    map[string]string `json:"labels"`
+
+	// Histogram is set for native histograms, Value is ignored then
+	Histogram *dto.Histogram `json:"-"`
+	// Meta describes the metric family, it may be nil
+	Meta *Metadata `json:"-"`
+}
+
+// Metadata is the type, help and unit of a metric family
+type Metadata struct {
+	Type ValueType
+	Help string
+	Unit string
 }
 
 var (
@@ -46,12 +60,6 @@ func NewSample(prefix, metric string, value interface{}, labels ...map[string]st
 }
 
 func (item *Sample) ConvertTimeSeries(precision string) *prompb.TimeSeries {
-	value, err := conv.ToFloat64(item.Value)
-	if err != nil {
-		// If the Labels is empty, it means it is abnormal data
-		return nil
-	}
-
 	pt := prompb.TimeSeries{}
 
 	timestamp := item.Timestamp.UnixMilli()
@@ -63,10 +71,21 @@ func (item *Sample) ConvertTimeSeries(precision string) *prompb.TimeSeries {
 		timestamp = ts - ts%60000
 	}
 
-	pt.Samples = append(pt.Samples, prompb.Sample{
-		Timestamp: timestamp,
-		Value:     value,
-	})
+	if item.Histogram != nil {
+		// native histograms travel as remote write 1.0 field 4
+		pt.XXX_unrecognized = writev2.FromDTO(item.Histogram, timestamp).AppendV1(nil)
+	} else {
+		value, err := conv.ToFloat64(item.Value)
+		if err != nil {
+			// If the Labels is empty, it means it is abnormal data
+			return nil
+		}
+
+		pt.Samples = append(pt.Samples, prompb.Sample{
+			Timestamp: timestamp,
+			Value:     value,
+		})
+	}
 
 	// add label: metric
 	pt.Labels = append(pt.Labels, prompb.Label{
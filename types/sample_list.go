@@ -28,6 +28,21 @@ func (l *SampleList) PushSamples(prefix string, fields map[string]interface{}, l
 	l.PushFrontN(vs)
 }
 
+// CounterMetadata describes the cumulative counters pushed by inputs
+var CounterMetadata = &Metadata{Type: Counter}
+
+// PushCounters pushes fields declared as cumulative counters, writers
+// typing series such as otlp send them as monotonic sums
+func (l *SampleList) PushCounters(prefix string, fields map[string]interface{}, labels ...map[string]string) {
+	vs := make([]*Sample, 0, len(fields))
+	for metric, value := range fields {
+		v := NewSample(prefix, metric, convertPtrToValue(value), labels...)
+		v.Meta = CounterMetadata
+		vs = append(vs, v)
+	}
+	l.PushFrontN(vs)
+}
+
 func convertPtrToValue(value interface{}) interface{} {
 	if value == nil {
 		return value
@@ -5,28 +5,38 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"strconv"
 	"time"
 )
 
-// HTTP fetcher uses HEAD requests to poll the status of a given
-// file. If it detects this file has been updated, it will fetch
-// and return its io.Reader stream.
+// response headers describing the release
+const (
+	HeaderVersion       = "client-version"
+	HeaderSHA256        = "client-sha256"
+	HeaderSignature     = "client-signature"
+	HeaderCanaryPercent = "client-canary-percent"
+)
+
+// HTTP fetcher uses HEAD requests to poll the release published at URL,
+// and GET requests to download its binary
 type HTTP struct {
 	//URL to poll for new binaries
 	URL           string
 	Interval      time.Duration
-	CheckHeaders  []string
 	BasicAuthUser string
 	BasicAuthPass string
-	//internal state
-	delay bool
-	lasts map[string]string
-	hmac  string
+
+	client *http.Client
 }
 
-// if any of these change, the binary has been updated
-// var defaultHTTPCheckHeaders = []string{"ETag", "If-Modified-Since", "Last-Modified", "Content-Length"}
-var defaultHTTPCheckHeaders = []string{"client-version"}
+// Release is the binary advertised by the HEAD response
+type Release struct {
+	Version   string
+	SHA256    string
+	Signature string
+	// -1 if the server does not set it
+	CanaryPercent int
+}
 
 // Init validates the provided config
 func (h *HTTP) Init() error {
@@ -34,35 +44,31 @@ func (h *HTTP) Init() error {
 	if h.URL == "" {
 		return fmt.Errorf("URL required")
 	}
-	h.lasts = map[string]string{}
 	if h.Interval == 0 {
 		h.Interval = 5 * time.Minute
 	}
-	if h.CheckHeaders == nil {
-		h.CheckHeaders = defaultHTTPCheckHeaders
-	}
+	h.client = &http.Client{Timeout: 10 * time.Minute}
 	return nil
 }
 
-// Fetch the binary from the provided URL
-func (h *HTTP) Fetch() (io.Reader, error) {
-	//delay fetches after first
-	if h.delay {
-		time.Sleep(h.Interval)
-	}
-	h.delay = true
-
-	//status check using HEAD
-	req, err := http.NewRequest("HEAD", h.URL, nil)
+func (h *HTTP) newRequest(method string) (*http.Request, error) {
+	req, err := http.NewRequest(method, h.URL, nil)
 	if err != nil {
-		return nil, fmt.Errorf("E! failed to new upgrade request: (%s)", err)
+		return nil, fmt.Errorf("failed to new upgrade request: (%s)", err)
 	}
-
 	if h.BasicAuthPass != "" {
 		req.SetBasicAuth(h.BasicAuthUser, h.BasicAuthPass)
 	}
+	return req, nil
+}
 
-	resp, err := http.DefaultClient.Do(req)
+// Check returns the release currently published
+func (h *HTTP) Check() (*Release, error) {
+	req, err := h.newRequest("HEAD")
+	if err != nil {
+		return nil, err
+	}
+	resp, err := h.client.Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("HEAD request failed (%s)", err)
 	}
@@ -70,41 +76,50 @@ func (h *HTTP) Fetch() (io.Reader, error) {
 	if resp.StatusCode != http.StatusOK {
 		return nil, fmt.Errorf("HEAD request failed (status code %d)", resp.StatusCode)
 	}
-	//if all headers match, skip update
-	matches, total := 0, 0
-	for _, header := range h.CheckHeaders {
-		if curr := resp.Header.Get(header); curr != "" {
-			if last, ok := h.lasts[header]; ok && last == curr {
-				matches++
-			}
-			h.lasts[header] = curr
-			total++
-		}
+
+	rel := &Release{
+		Version:       resp.Header.Get(HeaderVersion),
+		SHA256:        resp.Header.Get(HeaderSHA256),
+		Signature:     resp.Header.Get(HeaderSignature),
+		CanaryPercent: -1,
 	}
-	if matches == total {
-		return nil, nil //skip, file match
+	if rel.Version == "" {
+		return nil, fmt.Errorf("no %s header in response", HeaderVersion)
 	}
-	//binary fetch using GET
-	req, err = http.NewRequest("GET", h.URL, nil)
-	if err != nil {
-		return nil, fmt.Errorf("E! failed to new upgrade request: (%s)", err)
+	if v := resp.Header.Get(HeaderCanaryPercent); v != "" {
+		p, err := strconv.Atoi(v)
+		if err != nil || p < 0 || p > 100 {
+			return nil, fmt.Errorf("invalid %s header %q", HeaderCanaryPercent, v)
+		}
+		rel.CanaryPercent = p
 	}
+	return rel, nil
+}
 
-	if h.BasicAuthPass != "" {
-		req.SetBasicAuth(h.BasicAuthUser, h.BasicAuthPass)
+// Download writes the binary to w, gzip responses are decompressed
+func (h *HTTP) Download(w io.Writer) error {
+	req, err := h.newRequest("GET")
+	if err != nil {
+		return err
 	}
-
-	resp, err = http.DefaultClient.Do(req)
+	resp, err := h.client.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("GET request failed (%s)", err)
+		return fmt.Errorf("GET request failed (%s)", err)
 	}
+	defer resp.Body.Close()
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("GET request failed (status code %d)", resp.StatusCode)
+		return fmt.Errorf("GET request failed (status code %d)", resp.StatusCode)
 	}
 
+	var r io.Reader = resp.Body
 	if resp.Header.Get("Content-Type") == "application/gzip" {
-		return gzip.NewReader(resp.Body)
+		gr, err := gzip.NewReader(resp.Body)
+		if err != nil {
+			return err
+		}
+		defer gr.Close()
+		r = gr
 	}
-	//success!
-	return resp.Body, nil
+	_, err = io.Copy(w, r)
+	return err
 }
@@ -0,0 +1,12 @@
+package upgrade
+
+import (
+	"os"
+	"syscall"
+)
+
+// restart replaces the process with exe, the pid is kept so service
+// managers do not notice
+func restart(exe string) error {
+	return syscall.Exec(exe, os.Args, os.Environ())
+}
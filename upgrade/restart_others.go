@@ -0,0 +1,12 @@
+//go:build !linux
+// +build !linux
+
+package upgrade
+
+import (
+	"fmt"
+)
+
+func restart(exe string) error {
+	return fmt.Errorf("linux support only")
+}
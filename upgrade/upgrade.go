@@ -0,0 +1,403 @@
+package upgrade
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"flashcat.cloud/categraf/config"
+	"flashcat.cloud/categraf/heartbeat"
+	"flashcat.cloud/categraf/pkg/cmdx"
+)
+
+const (
+	statusPending    = "pending"
+	statusDone       = "done"
+	statusRolledBack = "rolled_back"
+
+	// starts of a new binary which did not get healthy before it is rolled back
+	maxStartAttempts     = 3
+	defaultHealthTimeout = 120 * time.Second
+	smokeTestTimeout     = 10 * time.Second
+)
+
+// state of the last upgrade, stored next to the binary, it survives the
+// restarts of the agent
+type state struct {
+	Status string `json:"status"`
+	From   string `json:"from"`
+	To     string `json:"to"`
+	// sha256 of the installed binary
+	SHA256 string `json:"sha256"`
+	// previous binary
+	Backup        string `json:"backup"`
+	HealthTimeout int64  `json:"health_timeout"`
+	Attempts      int    `json:"attempts"`
+	// binaries which were rolled back are not installed again
+	FailedSHA256 []string `json:"failed_sha256,omitempty"`
+	Reason       string   `json:"reason,omitempty"`
+	Unixtime     int64    `json:"unixtime"`
+}
+
+func statePath(exe string) string {
+	return exe + ".upgrade.json"
+}
+
+func loadState(exe string) (*state, error) {
+	bs, err := os.ReadFile(statePath(exe))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return &state{}, nil
+		}
+		return nil, err
+	}
+	st := &state{}
+	if err := json.Unmarshal(bs, st); err != nil {
+		return nil, fmt.Errorf("invalid upgrade state %s: %v", statePath(exe), err)
+	}
+	return st, nil
+}
+
+func saveState(exe string, st *state) error {
+	st.Unixtime = time.Now().Unix()
+	bs, err := json.MarshalIndent(st, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := statePath(exe) + ".tmp"
+	if err := os.WriteFile(tmp, bs, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, statePath(exe))
+}
+
+func (st *state) failed(sum string) bool {
+	for _, s := range st.FailedSHA256 {
+		if strings.EqualFold(s, sum) {
+			return true
+		}
+	}
+	return false
+}
+
+func executable() (string, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return "", err
+	}
+	return filepath.EvalSymlinks(exe)
+}
+
+func fileSHA256(file string) (string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// pending returns the state if the running binary was just installed and is
+// not confirmed healthy yet
+func pending(exe string) (*state, error) {
+	st, err := loadState(exe)
+	if err != nil || st.Status != statusPending {
+		return nil, err
+	}
+	sum, err := fileSHA256(exe)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.EqualFold(sum, st.SHA256) {
+		return nil, nil
+	}
+	return st, nil
+}
+
+// Startup counts the starts of a binary just installed, and restores the
+// previous one when it keeps exiting before being healthy. It runs before
+// the configs are loaded, so a binary failing on them is rolled back too.
+func Startup() {
+	exe, err := executable()
+	if err != nil {
+		return
+	}
+	st, err := pending(exe)
+	if err != nil {
+		log.Println("E! failed to read upgrade state:", err)
+		return
+	}
+	if st == nil {
+		return
+	}
+	st.Attempts++
+	if st.Attempts > maxStartAttempts {
+		rollback(exe, st, fmt.Sprintf("exited %d times before being healthy", maxStartAttempts), nil)
+		return
+	}
+	if err := saveState(exe, st); err != nil {
+		log.Println("E! failed to save upgrade state:", err)
+	}
+}
+
+// rollback restores the previous binary and restarts it, stop shuts the
+// agent down before
+func rollback(exe string, st *state, reason string, stop func()) {
+	log.Printf("E! upgrade from %s to %s failed: %s, rolling back", st.From, st.To, reason)
+	if err := os.Rename(st.Backup, exe); err != nil {
+		log.Println("E! failed to restore", st.Backup, "error:", err)
+		return
+	}
+	st.Status = statusRolledBack
+	st.Reason = reason
+	st.FailedSHA256 = append(st.FailedSHA256, st.SHA256)
+	if err := saveState(exe, st); err != nil {
+		log.Println("E! failed to save upgrade state:", err)
+	}
+	if stop != nil {
+		stop()
+	}
+	if err := restart(exe); err != nil {
+		log.Fatalln("F! failed to restart", exe, "error:", err)
+	}
+}
+
+type updater struct {
+	conf    *config.UpdateConfig
+	fetcher *HTTP
+	key     ed25519.PublicKey
+	exe     string
+	// sha256 of the running binary
+	sum  string
+	stop func()
+}
+
+// Work confirms or rolls back the binary just installed, then polls for new
+// releases. stop shuts the agent down before it restarts.
+func Work(stop func()) {
+	conf := config.Config.Update
+	if conf == nil || !conf.Enable {
+		return
+	}
+
+	u, err := newUpdater(conf, stop)
+	if err != nil {
+		log.Println("E! upgrade disabled:", err)
+		return
+	}
+
+	if st, err := pending(u.exe); err != nil {
+		log.Println("E! failed to read upgrade state:", err)
+	} else if st != nil {
+		if !u.waitHealthy(st) {
+			return
+		}
+	}
+
+	for {
+		time.Sleep(u.fetcher.Interval)
+		if err := u.check(); err != nil {
+			log.Println("E! upgrade:", err)
+		}
+	}
+}
+
+func newUpdater(conf *config.UpdateConfig, stop func()) (*updater, error) {
+	if runtime.GOOS != "linux" {
+		return nil, fmt.Errorf("linux support only")
+	}
+	if conf.PublicKey == "" {
+		return nil, fmt.Errorf("public_key is required to verify new binaries")
+	}
+	key, err := ParsePublicKey(conf.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	fetcher := &HTTP{
+		URL:           conf.Url,
+		Interval:      time.Duration(conf.Interval) * time.Second,
+		BasicAuthUser: conf.BasicAuthUser,
+		BasicAuthPass: conf.BasicAuthPass,
+	}
+	if err := fetcher.Init(); err != nil {
+		return nil, err
+	}
+	exe, err := executable()
+	if err != nil {
+		return nil, err
+	}
+	sum, err := fileSHA256(exe)
+	if err != nil {
+		return nil, err
+	}
+	return &updater{conf: conf, fetcher: fetcher, key: key, exe: exe, sum: sum, stop: stop}, nil
+}
+
+// waitHealthy confirms the binary once the server accepts a heartbeat, or
+// once it ran for the health timeout if heartbeat is disabled, it is rolled
+// back otherwise
+func (u *updater) waitHealthy(st *state) bool {
+	timeout := time.Duration(st.HealthTimeout) * time.Second
+	if timeout <= 0 {
+		timeout = defaultHealthTimeout
+	}
+	started := time.Now()
+	log.Printf("I! upgraded from %s to %s, waiting %s for it to be healthy", st.From, st.To, timeout)
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		healthy := now.Sub(started) >= timeout
+		if heartbeat.Enabled() {
+			healthy = heartbeat.LastSuccess().After(started)
+		}
+		if healthy {
+			st.Status = statusDone
+			if err := saveState(u.exe, st); err != nil {
+				log.Println("E! failed to save upgrade state:", err)
+			}
+			log.Printf("I! upgrade from %s to %s done", st.From, st.To)
+			return true
+		}
+		if now.Sub(started) >= timeout {
+			rollback(u.exe, st, fmt.Sprintf("no heartbeat accepted within %s", timeout), u.stop)
+			return false
+		}
+	}
+	return false
+}
+
+func (u *updater) check() error {
+	rel, err := u.fetcher.Check()
+	if err != nil {
+		return err
+	}
+	if strings.EqualFold(rel.SHA256, u.sum) {
+		return nil
+	}
+
+	st, err := loadState(u.exe)
+	if err != nil {
+		return err
+	}
+	if st.failed(rel.SHA256) {
+		if config.DebugMode() {
+			log.Println("D! upgrade: skip release", rel.Version, "which was rolled back")
+		}
+		return nil
+	}
+
+	percent := rel.CanaryPercent
+	if percent < 0 {
+		percent = u.conf.CanaryPercent
+		if percent <= 0 {
+			percent = 100
+		}
+	}
+	if !InCanary(config.Config.GetHostname(), percent) {
+		if config.DebugMode() {
+			log.Printf("D! upgrade: release %s is rolled out to %d%% of hosts, not this one", rel.Version, percent)
+		}
+		return nil
+	}
+
+	return u.install(rel, st)
+}
+
+// install downloads and verifies rel, runs it once with --version, then
+// swaps it with the running binary and restarts
+func (u *updater) install(rel *Release, st *state) error {
+	log.Println("I! upgrade: installing release", rel.Version)
+	staged := u.exe + ".new"
+	f, err := os.OpenFile(staged, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0755)
+	if err != nil {
+		return err
+	}
+	err = u.fetcher.Download(f)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = Verify(staged, rel, u.key)
+	}
+	if err == nil {
+		err = smokeTest(staged)
+	}
+	if err != nil {
+		os.Remove(staged)
+		return fmt.Errorf("release %s: %v", rel.Version, err)
+	}
+
+	fi, err := os.Stat(u.exe)
+	if err != nil {
+		return err
+	}
+	if err := os.Chmod(staged, fi.Mode().Perm()); err != nil {
+		return err
+	}
+
+	backup := u.exe + ".old"
+	if err := os.Rename(u.exe, backup); err != nil {
+		return err
+	}
+	if err := os.Rename(staged, u.exe); err != nil {
+		os.Rename(backup, u.exe)
+		return err
+	}
+
+	*st = state{
+		Status:        statusPending,
+		From:          config.Version,
+		To:            rel.Version,
+		SHA256:        strings.ToLower(rel.SHA256),
+		Backup:        backup,
+		HealthTimeout: u.conf.HealthTimeout,
+		FailedSHA256:  st.FailedSHA256,
+	}
+	if err := saveState(u.exe, st); err != nil {
+		// without state there is no rollback, keep the running binary
+		os.Rename(backup, u.exe)
+		return err
+	}
+
+	log.Printf("I! upgrade: restarting from %s to %s", config.Version, rel.Version)
+	if u.stop != nil {
+		u.stop()
+	}
+	if err := restart(u.exe); err != nil {
+		log.Fatalln("F! failed to restart", u.exe, "error:", err)
+	}
+	return nil
+}
+
+// smokeTest runs the binary with --version, a binary which does not run on
+// this host is not installed
+func smokeTest(file string) error {
+	cmd := exec.Command(file, "--version")
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	err, timeout := cmdx.RunTimeout(cmd, smokeTestTimeout)
+	if timeout {
+		return fmt.Errorf("%s --version timeout", file)
+	}
+	if err != nil {
+		return fmt.Errorf("%s --version: %v %s", file, err, bytes.TrimSpace(out.Bytes()))
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package upgrade
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"os"
+	"strings"
+)
+
+// ParsePublicKey decodes a base64 ed25519 public key
+func ParsePublicKey(s string) (ed25519.PublicKey, error) {
+	bs, err := base64.StdEncoding.DecodeString(strings.TrimSpace(s))
+	if err != nil {
+		return nil, fmt.Errorf("invalid public key: %v", err)
+	}
+	if len(bs) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("invalid public key: %d bytes, expected %d", len(bs), ed25519.PublicKeySize)
+	}
+	return ed25519.PublicKey(bs), nil
+}
+
+// Verify checks the sha256 of file against rel, and the signature of the
+// digest against key
+func Verify(file string, rel *Release, key ed25519.PublicKey) error {
+	if rel.SHA256 == "" || rel.Signature == "" {
+		return fmt.Errorf("release %s is not signed, %s and %s are required", rel.Version, HeaderSHA256, HeaderSignature)
+	}
+	want, err := hex.DecodeString(rel.SHA256)
+	if err != nil || len(want) != sha256.Size {
+		return fmt.Errorf("invalid %s %q", HeaderSHA256, rel.SHA256)
+	}
+	sig, err := base64.StdEncoding.DecodeString(rel.Signature)
+	if err != nil {
+		return fmt.Errorf("invalid %s: %v", HeaderSignature, err)
+	}
+
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return err
+	}
+	got := h.Sum(nil)
+
+	if !strings.EqualFold(hex.EncodeToString(got), rel.SHA256) {
+		return fmt.Errorf("sha256 mismatch, got %x, expected %s", got, rel.SHA256)
+	}
+	if !ed25519.Verify(key, got, sig) {
+		return fmt.Errorf("signature verification failed")
+	}
+	return nil
+}
+
+// InCanary reports whether hostname is among the percent hosts upgraded,
+// a host stays in the canary group while the percentage grows
+func InCanary(hostname string, percent int) bool {
+	if percent >= 100 {
+		return true
+	}
+	if percent <= 0 {
+		return false
+	}
+	h := fnv.New32a()
+	h.Write([]byte(hostname))
+	return int(h.Sum32()%100) < percent
+}
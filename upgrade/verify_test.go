@@ -0,0 +1,78 @@
+package upgrade
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestVerify(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := ParsePublicKey(base64.StdEncoding.EncodeToString(pub))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	file := filepath.Join(t.TempDir(), "categraf")
+	content := []byte("new binary")
+	if err := os.WriteFile(file, content, 0755); err != nil {
+		t.Fatal(err)
+	}
+	digest := sha256.Sum256(content)
+	rel := &Release{
+		Version:   "v0.4.0",
+		SHA256:    hex.EncodeToString(digest[:]),
+		Signature: base64.StdEncoding.EncodeToString(ed25519.Sign(priv, digest[:])),
+	}
+	if err := Verify(file, rel, key); err != nil {
+		t.Fatalf("valid release rejected: %v", err)
+	}
+
+	other := sha256.Sum256([]byte("other binary"))
+	tampered := *rel
+	tampered.SHA256 = hex.EncodeToString(other[:])
+	if err := Verify(file, &tampered, key); err == nil {
+		t.Error("sha256 mismatch accepted")
+	}
+
+	_, otherPriv, _ := ed25519.GenerateKey(nil)
+	forged := *rel
+	forged.Signature = base64.StdEncoding.EncodeToString(ed25519.Sign(otherPriv, digest[:]))
+	if err := Verify(file, &forged, key); err == nil {
+		t.Error("signature of another key accepted")
+	}
+
+	unsigned := *rel
+	unsigned.Signature = ""
+	if err := Verify(file, &unsigned, key); err == nil {
+		t.Error("unsigned release accepted")
+	}
+}
+
+func TestInCanary(t *testing.T) {
+	in := 0
+	for i := 0; i < 1000; i++ {
+		host := fmt.Sprintf("host-%d", i)
+		if InCanary(host, 10) {
+			in++
+			// hosts stay in the canary group as it grows
+			if !InCanary(host, 50) {
+				t.Fatalf("%s left the canary group", host)
+			}
+		}
+	}
+	if in < 50 || in > 150 {
+		t.Errorf("%d of 1000 hosts in a 10%% canary", in)
+	}
+	if InCanary("host", 0) || !InCanary("host", 100) {
+		t.Error("0% and 100% should exclude and include every host")
+	}
+}
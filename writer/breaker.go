@@ -0,0 +1,105 @@
+package writer
+
+import (
+	"sync"
+	"time"
+)
+
+type breakerState int
+
+const (
+	breakerClosed breakerState = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+func (s breakerState) String() string {
+	switch s {
+	case breakerOpen:
+		return "open"
+	case breakerHalfOpen:
+		return "half-open"
+	default:
+		return "closed"
+	}
+}
+
+// breaker isolates a dead endpoint: after threshold consecutive failures
+// it rejects requests for cooldown, then lets a single probe through.
+type breaker struct {
+	sync.Mutex
+	threshold int
+	cooldown  time.Duration
+
+	state    breakerState
+	failures int
+	openedAt time.Time
+}
+
+func newBreaker(threshold int, cooldown time.Duration) *breaker {
+	return &breaker{
+		threshold: threshold,
+		cooldown:  cooldown,
+	}
+}
+
+// Allow reports whether a request may be sent now
+func (b *breaker) Allow() bool {
+	b.Lock()
+	defer b.Unlock()
+
+	switch b.state {
+	case breakerOpen:
+		if time.Since(b.openedAt) < b.cooldown {
+			return false
+		}
+		b.state = breakerHalfOpen
+		return true
+	case breakerHalfOpen:
+		// the probe is still in flight
+		return false
+	default:
+		return true
+	}
+}
+
+func (b *breaker) Success() {
+	b.Lock()
+	defer b.Unlock()
+	b.state = breakerClosed
+	b.failures = 0
+}
+
+// Failure records a failed request and reports whether the breaker opened
+func (b *breaker) Failure() bool {
+	b.Lock()
+	defer b.Unlock()
+
+	b.failures++
+	if b.state == breakerHalfOpen || (b.state == breakerClosed && b.failures >= b.threshold) {
+		b.state = breakerOpen
+		b.openedAt = time.Now()
+		return true
+	}
+	return false
+}
+
+func (b *breaker) State() breakerState {
+	b.Lock()
+	defer b.Unlock()
+	return b.state
+}
+
+// Remaining returns how long an open breaker keeps rejecting requests, 0 if
+// a request would be let through, a probe included
+func (b *breaker) Remaining() time.Duration {
+	b.Lock()
+	defer b.Unlock()
+	if b.state != breakerOpen {
+		return 0
+	}
+	if d := b.cooldown - time.Since(b.openedAt); d > 0 {
+		return d
+	}
+	return 0
+}
@@ -0,0 +1,323 @@
+package writer
+
+import (
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/prometheus/prompb"
+
+	"flashcat.cloud/categraf/config"
+	"flashcat.cloud/categraf/pkg/choice"
+	"flashcat.cloud/categraf/types"
+)
+
+// cardinalityGuard tracks the series of every source(an input or a push
+// endpoint) over a sliding window, new series beyond the limits are handled
+// by the configured action
+type cardinalityGuard struct {
+	opt config.Cardinality
+
+	lock    sync.RWMutex
+	sources map[string]*sourceSeries
+}
+
+type sourceSeries struct {
+	sync.Mutex
+	series    map[string]*guardedSeries
+	metrics   map[string]int
+	exceeded  map[string]uint64
+	warned    map[string]struct{}
+	lastSweep time.Time
+}
+
+type guardedSeries struct {
+	metric string
+	seen   time.Time
+}
+
+// CardinalityStat is the number of live series of a metric of a source, and
+// how many new series went over the limits
+type CardinalityStat struct {
+	Source   string `json:"source"`
+	Metric   string `json:"metric"`
+	Series   int    `json:"series"`
+	Exceeded uint64 `json:"exceeded"`
+}
+
+var (
+	guard     *cardinalityGuard
+	guardOnce sync.Once
+)
+
+func cardinality() *cardinalityGuard {
+	guardOnce.Do(func() {
+		if config.Config != nil && config.Config.Cardinality.Enable {
+			guard = newCardinalityGuard(config.Config.Cardinality)
+		}
+	})
+	return guard
+}
+
+// CardinalityEnabled reports whether series are limited
+func CardinalityEnabled() bool {
+	return cardinality() != nil
+}
+
+func newCardinalityGuard(opt config.Cardinality) *cardinalityGuard {
+	return &cardinalityGuard{
+		opt:     opt,
+		sources: make(map[string]*sourceSeries),
+	}
+}
+
+func (g *cardinalityGuard) source(name string) *sourceSeries {
+	g.lock.RLock()
+	s, ok := g.sources[name]
+	g.lock.RUnlock()
+	if ok {
+		return s
+	}
+
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	if s, ok = g.sources[name]; !ok {
+		s = &sourceSeries{
+			series:    make(map[string]*guardedSeries),
+			metrics:   make(map[string]int),
+			exceeded:  make(map[string]uint64),
+			warned:    make(map[string]struct{}),
+			lastSweep: time.Now(),
+		}
+		g.sources[name] = s
+	}
+	return s
+}
+
+func (g *cardinalityGuard) maxSeries(source string) int {
+	if limit, ok := g.opt.InputLimits[source]; ok {
+		return limit
+	}
+	return g.opt.MaxSeriesPerInput
+}
+
+// admit reports whether a series may be sent, strip removes strip_labels from
+// the series and returns its new key. The caller holds the lock of s.
+func (g *cardinalityGuard) admit(source string, s *sourceSeries, key, metric string, now time.Time, strip func() string) bool {
+	if gs, ok := s.series[key]; ok {
+		gs.seen = now
+		return true
+	}
+
+	maxSeries, maxMetric := g.maxSeries(source), g.opt.MaxSeriesPerMetric
+	over := (maxSeries > 0 && len(s.series) >= maxSeries) || (maxMetric > 0 && s.metrics[metric] >= maxMetric)
+	if over {
+		s.exceeded[metric]++
+		if _, ok := s.warned[metric]; !ok {
+			s.warned[metric] = struct{}{}
+			log.Printf("W! cardinality of %s exceeded by metric %s, action: %s", source, metric, g.opt.Action)
+		}
+
+		switch g.opt.Action {
+		case config.CardinalityAlert:
+		case config.CardinalityStripLabel:
+			if key = strip(); key == "" {
+				return false
+			}
+			// the stripped series collapse, they are admitted over the limits
+			if gs, ok := s.series[key]; ok {
+				gs.seen = now
+				return true
+			}
+		default:
+			return false
+		}
+	}
+
+	s.series[key] = &guardedSeries{metric: metric, seen: now}
+	s.metrics[metric]++
+	return true
+}
+
+// sweep forgets series not seen within the window, the caller holds the lock of s
+func (g *cardinalityGuard) sweep(s *sourceSeries, now time.Time) {
+	window := time.Duration(g.opt.Window)
+	if now.Sub(s.lastSweep) < window/4 {
+		return
+	}
+	for key, gs := range s.series {
+		if now.Sub(gs.seen) > window {
+			delete(s.series, key)
+			if s.metrics[gs.metric]--; s.metrics[gs.metric] <= 0 {
+				delete(s.metrics, gs.metric)
+			}
+		}
+	}
+	s.warned = make(map[string]struct{})
+	s.lastSweep = now
+}
+
+func (g *cardinalityGuard) guardSamples(source string, samples []*types.Sample) []*types.Sample {
+	now := time.Now()
+	s := g.source(source)
+	s.Lock()
+	defer s.Unlock()
+	g.sweep(s, now)
+
+	ret := samples[:0]
+	for _, sample := range samples {
+		if sample == nil {
+			continue
+		}
+		strip := func() string {
+			stripped := false
+			for _, l := range g.opt.StripLabels {
+				if _, ok := sample.Labels[l]; ok {
+					delete(sample.Labels, l)
+					stripped = true
+				}
+			}
+			if !stripped {
+				return ""
+			}
+			return sampleKey(sample)
+		}
+		if g.admit(source, s, sampleKey(sample), sample.Metric, now, strip) {
+			ret = append(ret, sample)
+		}
+	}
+	return ret
+}
+
+func (g *cardinalityGuard) guardTimeSeries(source string, series []prompb.TimeSeries) []prompb.TimeSeries {
+	now := time.Now()
+	s := g.source(source)
+	s.Lock()
+	defer s.Unlock()
+	g.sweep(s, now)
+
+	ret := series[:0]
+	for i := range series {
+		ts := series[i]
+		strip := func() string {
+			labels := make([]prompb.Label, 0, len(ts.Labels))
+			for _, l := range ts.Labels {
+				if !choice.Contains(l.Name, g.opt.StripLabels) {
+					labels = append(labels, l)
+				}
+			}
+			if len(labels) == len(ts.Labels) {
+				return ""
+			}
+			ts.Labels = labels
+			return labelsKey(labels)
+		}
+		if g.admit(source, s, labelsKey(ts.Labels), metricName(ts.Labels), now, strip) {
+			ret = append(ret, ts)
+		}
+	}
+	return ret
+}
+
+func (g *cardinalityGuard) stats() []CardinalityStat {
+	g.lock.RLock()
+	names := make([]string, 0, len(g.sources))
+	for name := range g.sources {
+		names = append(names, name)
+	}
+	g.lock.RUnlock()
+
+	var ret []CardinalityStat
+	for _, name := range names {
+		s := g.source(name)
+		s.Lock()
+		for metric, n := range s.metrics {
+			ret = append(ret, CardinalityStat{Source: name, Metric: metric, Series: n, Exceeded: s.exceeded[metric]})
+		}
+		for metric, n := range s.exceeded {
+			if _, ok := s.metrics[metric]; !ok {
+				ret = append(ret, CardinalityStat{Source: name, Metric: metric, Exceeded: n})
+			}
+		}
+		s.Unlock()
+	}
+	return ret
+}
+
+// GuardSamples drops or strips the new series of source beyond the limits
+func GuardSamples(source string, samples []*types.Sample) []*types.Sample {
+	g := cardinality()
+	if g == nil {
+		return samples
+	}
+	return g.guardSamples(source, samples)
+}
+
+// GuardTimeSeries is GuardSamples for series pushed in the remote write format
+func GuardTimeSeries(source string, series []prompb.TimeSeries) []prompb.TimeSeries {
+	g := cardinality()
+	if g == nil {
+		return series
+	}
+	return g.guardTimeSeries(source, series)
+}
+
+// CardinalityTop returns the n metrics with the most series, those which
+// went over the limits come first
+func CardinalityTop(n int) []CardinalityStat {
+	g := cardinality()
+	if g == nil {
+		return nil
+	}
+	ret := g.stats()
+	sort.Slice(ret, func(i, j int) bool {
+		if (ret[i].Exceeded > 0) != (ret[j].Exceeded > 0) {
+			return ret[i].Exceeded > 0
+		}
+		if ret[i].Series != ret[j].Series {
+			return ret[i].Series > ret[j].Series
+		}
+		return ret[i].Exceeded > ret[j].Exceeded
+	})
+	if n > 0 && len(ret) > n {
+		ret = ret[:n]
+	}
+	return ret
+}
+
+// CardinalityStats returns the series of every metric of every source
+func CardinalityStats() []CardinalityStat {
+	g := cardinality()
+	if g == nil {
+		return nil
+	}
+	return g.stats()
+}
+
+func sampleKey(s *types.Sample) string {
+	names := make([]string, 0, len(s.Labels))
+	for k := range s.Labels {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	var sb strings.Builder
+	sb.WriteString(s.Metric)
+	for _, k := range names {
+		sb.WriteByte(0)
+		sb.WriteString(k)
+		sb.WriteByte(0)
+		sb.WriteString(s.Labels[k])
+	}
+	return sb.String()
+}
+
+// labelsKey is the signature of labels regardless of their order
+func labelsKey(labels []prompb.Label) string {
+	sorted := make([]prompb.Label, len(labels))
+	copy(sorted, labels)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Name < sorted[j].Name })
+	return seriesSignature(sorted)
+}
@@ -0,0 +1,66 @@
+package writer
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/prometheus/prometheus/prompb"
+
+	"flashcat.cloud/categraf/config"
+	"flashcat.cloud/categraf/types"
+)
+
+func TestCardinalityGuardActions(t *testing.T) {
+	opt := config.Cardinality{
+		Enable:             true,
+		Window:             config.Duration(60e9),
+		MaxSeriesPerMetric: 2,
+		Action:             config.CardinalityDrop,
+		StripLabels:        []string{"path"},
+	}
+	samples := func() []*types.Sample {
+		var ss []*types.Sample
+		for i := 0; i < 4; i++ {
+			ss = append(ss, types.NewSample("", "http_requests", 1, map[string]string{"path": fmt.Sprint("/", i), "code": "200"}))
+		}
+		return ss
+	}
+
+	g := newCardinalityGuard(opt)
+	if n := len(g.guardSamples("prometheus", samples())); n != 2 {
+		t.Fatalf("drop: %d samples kept, want 2", n)
+	}
+	// known series keep passing
+	if n := len(g.guardSamples("prometheus", samples())); n != 2 {
+		t.Fatalf("drop: %d samples kept on the second run, want 2", n)
+	}
+
+	opt.Action = config.CardinalityStripLabel
+	opt.MaxSeriesPerMetric = 1
+	g = newCardinalityGuard(opt)
+	kept := g.guardSamples("prometheus", samples())
+	if len(kept) != 4 {
+		t.Fatalf("strip_label: %d samples kept, want 4", len(kept))
+	}
+	for _, s := range kept[1:] {
+		if _, ok := s.Labels["path"]; ok {
+			t.Fatalf("strip_label: path not stripped from %v", s.Labels)
+		}
+	}
+
+	opt.Action = config.CardinalityAlert
+	g = newCardinalityGuard(opt)
+	series := make([]prompb.TimeSeries, 0, 3)
+	for i := 0; i < 3; i++ {
+		series = append(series, prompb.TimeSeries{Labels: []prompb.Label{
+			{Name: "__name__", Value: "up"}, {Name: "instance", Value: fmt.Sprint(i)},
+		}})
+	}
+	if n := len(g.guardTimeSeries("push.remotewrite", series)); n != 3 {
+		t.Fatalf("alert: %d series kept, want 3", n)
+	}
+	stats := g.stats()
+	if len(stats) != 1 || stats[0].Series != 3 || stats[0].Exceeded != 2 {
+		t.Fatalf("alert: unexpected stats %+v", stats)
+	}
+}
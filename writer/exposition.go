@@ -0,0 +1,201 @@
+package writer
+
+import (
+	"bufio"
+	"io"
+	"log"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/prompb"
+
+	"flashcat.cloud/categraf/config"
+	"flashcat.cloud/categraf/types"
+)
+
+// exposition keeps the latest sample of every gathered series for the
+// /metrics endpoint, series not updated for staleness are forgotten
+type exposition struct {
+	sync.RWMutex
+	series    map[string]*exposedSeries
+	lastSweep time.Time
+
+	// native histograms have no text format representation
+	droppedHistograms uint64
+}
+
+type exposedSeries struct {
+	name      string
+	labels    []prompb.Label
+	value     float64
+	timestamp int64
+	seen      time.Time
+}
+
+var exposed = &exposition{series: make(map[string]*exposedSeries)}
+
+// ExposeEnabled reports whether gathered series are served at /metrics
+func ExposeEnabled() bool {
+	return config.Config.HTTP != nil && config.Config.HTTP.Enable && config.Config.HTTP.ExposeMetrics
+}
+
+func exposeStaleness() time.Duration {
+	return time.Duration(config.Config.HTTP.MetricsStaleness) * config.GetInterval()
+}
+
+func seriesSignature(labels []prompb.Label) string {
+	var sb strings.Builder
+	for _, l := range labels {
+		sb.WriteString(l.Name)
+		sb.WriteByte(0)
+		sb.WriteString(l.Value)
+		sb.WriteByte(0)
+	}
+	return sb.String()
+}
+
+func (e *exposition) store(items []*prompb.TimeSeries) {
+	now := time.Now()
+	e.Lock()
+	defer e.Unlock()
+	for _, item := range items {
+		if len(item.Samples) == 0 {
+			if len(item.XXX_unrecognized) > 0 {
+				e.droppedHistograms++
+				if e.droppedHistograms%1000 == 1 {
+					log.Println("W! native histograms can not be exposed at /metrics,", e.droppedHistograms, "series dropped")
+				}
+			}
+			continue
+		}
+		labels := make([]prompb.Label, len(item.Labels))
+		copy(labels, item.Labels)
+		sort.Slice(labels, func(i, j int) bool { return labels[i].Name < labels[j].Name })
+
+		last := item.Samples[len(item.Samples)-1]
+		e.series[seriesSignature(labels)] = &exposedSeries{
+			name:      metricName(labels),
+			labels:    labels,
+			value:     last.Value,
+			timestamp: last.Timestamp,
+			seen:      now,
+		}
+	}
+	if now.Sub(e.lastSweep) > config.GetInterval() {
+		e.sweep(now)
+	}
+}
+
+// sweep drops stale series, the caller holds the lock
+func (e *exposition) sweep(now time.Time) {
+	staleness := exposeStaleness()
+	for key, s := range e.series {
+		if now.Sub(s.seen) > staleness {
+			delete(e.series, key)
+		}
+	}
+	e.lastSweep = now
+}
+
+// WriteExposition writes the latest value of every fresh series in the
+// Prometheus text format
+func WriteExposition(out io.Writer) error {
+	now := time.Now()
+	staleness := exposeStaleness()
+
+	exposed.RLock()
+	list := make([]*exposedSeries, 0, len(exposed.series))
+	for _, s := range exposed.series {
+		if now.Sub(s.seen) <= staleness {
+			list = append(list, s)
+		}
+	}
+	exposed.RUnlock()
+
+	// series of a family must be contiguous
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].name != list[j].name {
+			return list[i].name < list[j].name
+		}
+		return seriesSignature(list[i].labels) < seriesSignature(list[j].labels)
+	})
+
+	w := bufio.NewWriter(out)
+	var family string
+	for _, s := range list {
+		if s.name != family {
+			family = s.name
+			writeFamilyHeader(w, s.name)
+		}
+		w.WriteString(s.name)
+		sep := byte('{')
+		for _, l := range s.labels {
+			if l.Name == model.MetricNameLabel {
+				continue
+			}
+			w.WriteByte(sep)
+			sep = ','
+			w.WriteString(l.Name)
+			w.WriteString(`="`)
+			w.WriteString(escapeLabelValue(l.Value))
+			w.WriteByte('"')
+		}
+		if sep == ',' {
+			w.WriteByte('}')
+		}
+		w.WriteByte(' ')
+		w.WriteString(formatFloat(s.value))
+		w.WriteByte(' ')
+		w.WriteString(strconv.FormatInt(s.timestamp, 10))
+		w.WriteByte('\n')
+	}
+	return w.Flush()
+}
+
+func writeFamilyHeader(w *bufio.Writer, name string) {
+	// series of histograms and summaries are named after their family with
+	// a suffix, and are exposed untyped
+	md := lookupMetadata(name)
+	if md == nil || (md.Type != types.Counter && md.Type != types.Gauge) {
+		return
+	}
+	if md.Help != "" {
+		w.WriteString("# HELP " + name + " " + escapeHelp(md.Help) + "\n")
+	}
+	if md.Type == types.Counter {
+		w.WriteString("# TYPE " + name + " counter\n")
+	} else {
+		w.WriteString("# TYPE " + name + " gauge\n")
+	}
+}
+
+var (
+	labelValueReplacer = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+	helpReplacer       = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+)
+
+func escapeLabelValue(v string) string {
+	return labelValueReplacer.Replace(v)
+}
+
+func escapeHelp(v string) string {
+	return helpReplacer.Replace(v)
+}
+
+func formatFloat(f float64) string {
+	switch {
+	case math.IsNaN(f):
+		return "NaN"
+	case math.IsInf(f, 1):
+		return "+Inf"
+	case math.IsInf(f, -1):
+		return "-Inf"
+	default:
+		return strconv.FormatFloat(f, 'g', -1, 64)
+	}
+}
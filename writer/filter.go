@@ -0,0 +1,93 @@
+package writer
+
+import (
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/prompb"
+
+	"flashcat.cloud/categraf/config"
+	"flashcat.cloud/categraf/pkg/filter"
+	modelLabel "flashcat.cloud/categraf/pkg/prom/labels"
+	"flashcat.cloud/categraf/pkg/relabel"
+)
+
+// seriesFilter applies metrics_pass, metrics_drop and relabel_configs of a writer
+type seriesFilter struct {
+	drop    filter.Filter
+	pass    filter.Filter
+	relabel []*relabel.Config
+}
+
+func newSeriesFilter(opt config.WriterOption) (*seriesFilter, error) {
+	if len(opt.MetricsDrop) == 0 && len(opt.MetricsPass) == 0 && len(opt.RelabelConfigs) == 0 {
+		return nil, nil
+	}
+
+	f := &seriesFilter{}
+	var err error
+	if len(opt.MetricsDrop) > 0 {
+		if f.drop, err = filter.Compile(opt.MetricsDrop); err != nil {
+			return nil, err
+		}
+	}
+	if len(opt.MetricsPass) > 0 {
+		if f.pass, err = filter.Compile(opt.MetricsPass); err != nil {
+			return nil, err
+		}
+	}
+	if len(opt.RelabelConfigs) > 0 {
+		if f.relabel, err = config.CompileRelabelConfigs(opt.RelabelConfigs); err != nil {
+			return nil, err
+		}
+	}
+	return f, nil
+}
+
+// Apply returns the series kept by the filter, the input is shared with
+// other writers so relabeled series get new label slices
+func (f *seriesFilter) Apply(timeSeries []prompb.TimeSeries) []prompb.TimeSeries {
+	ret := make([]prompb.TimeSeries, 0, len(timeSeries))
+	for i := range timeSeries {
+		name := metricName(timeSeries[i].Labels)
+		if f.drop != nil && f.drop.Match(name) {
+			continue
+		}
+		if f.pass != nil && !f.pass.Match(name) {
+			continue
+		}
+
+		if len(f.relabel) == 0 {
+			ret = append(ret, timeSeries[i])
+			continue
+		}
+
+		all := make(modelLabel.Labels, 0, len(timeSeries[i].Labels))
+		for _, l := range timeSeries[i].Labels {
+			all = append(all, modelLabel.Label{Name: l.Name, Value: l.Value})
+		}
+		newAll, keep := relabel.Process(all, f.relabel...)
+		if !keep || len(newAll) == 0 {
+			continue
+		}
+		labels := make([]prompb.Label, 0, len(newAll))
+		for _, l := range newAll {
+			labels = append(labels, prompb.Label{Name: l.Name, Value: l.Value})
+		}
+		ret = append(ret, prompb.TimeSeries{
+			Labels:    labels,
+			Samples:   timeSeries[i].Samples,
+			Exemplars: timeSeries[i].Exemplars,
+			// native histograms
+			XXX_unrecognized: timeSeries[i].XXX_unrecognized,
+		})
+	}
+	return ret
+}
+
+func metricName(labels []prompb.Label) string {
+	for _, l := range labels {
+		if l.Name == model.MetricNameLabel {
+			return l.Value
+		}
+	}
+	return ""
+}
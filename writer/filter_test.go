@@ -0,0 +1,156 @@
+package writer
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/prompb"
+
+	"flashcat.cloud/categraf/config"
+	"flashcat.cloud/categraf/pkg/relabel"
+)
+
+// filterSeries builds a series from "name label=value ..."
+func filterSeries(spec string) prompb.TimeSeries {
+	fields := strings.Fields(spec)
+	labels := []prompb.Label{{Name: model.MetricNameLabel, Value: fields[0]}}
+	for _, f := range fields[1:] {
+		kv := strings.SplitN(f, "=", 2)
+		labels = append(labels, prompb.Label{Name: kv[0], Value: kv[1]})
+	}
+	return prompb.TimeSeries{Labels: labels, Samples: []prompb.Sample{{Value: 1, Timestamp: 1000}}}
+}
+
+// filterSpec is the reverse of filterSeries, labels sorted by name
+func filterSpec(ts prompb.TimeSeries) string {
+	name := metricName(ts.Labels)
+	var labels []string
+	for _, l := range ts.Labels {
+		if l.Name != model.MetricNameLabel {
+			labels = append(labels, l.Name+"="+l.Value)
+		}
+	}
+	sort.Strings(labels)
+	return strings.Join(append([]string{name}, labels...), " ")
+}
+
+func TestSeriesFilter(t *testing.T) {
+	input := []string{
+		"cpu_usage_idle cpu=cpu0",
+		"cpu_usage_user cpu=cpu0",
+		"mem_used env=prod",
+		"disk_used env=test path=/",
+		"net_bytes_recv interface=lo",
+	}
+
+	tests := []struct {
+		name string
+		opt  config.WriterOption
+		want []string
+	}{
+		{
+			name: "no filter",
+			opt:  config.WriterOption{},
+			want: input,
+		},
+		{
+			name: "pass glob",
+			opt:  config.WriterOption{MetricsPass: []string{"cpu_*", "mem_used"}},
+			want: []string{"cpu_usage_idle cpu=cpu0", "cpu_usage_user cpu=cpu0", "mem_used env=prod"},
+		},
+		{
+			name: "drop glob",
+			opt:  config.WriterOption{MetricsDrop: []string{"*_used"}},
+			want: []string{"cpu_usage_idle cpu=cpu0", "cpu_usage_user cpu=cpu0", "net_bytes_recv interface=lo"},
+		},
+		{
+			name: "drop wins over pass",
+			opt:  config.WriterOption{MetricsPass: []string{"cpu_*"}, MetricsDrop: []string{"cpu_usage_user"}},
+			want: []string{"cpu_usage_idle cpu=cpu0"},
+		},
+		{
+			name: "relabel keep",
+			opt: config.WriterOption{RelabelConfigs: []*config.RelabelConfig{
+				{SourceLabels: model.LabelNames{"env"}, Regex: "prod", Action: relabel.Keep},
+			}},
+			want: []string{"mem_used env=prod"},
+		},
+		{
+			name: "relabel drop by name",
+			opt: config.WriterOption{RelabelConfigs: []*config.RelabelConfig{
+				{SourceLabels: model.LabelNames{"__name__"}, Regex: "cpu_.*|net_.*", Action: relabel.Drop},
+			}},
+			want: []string{"mem_used env=prod", "disk_used env=test path=/"},
+		},
+		{
+			name: "relabel replace",
+			opt: config.WriterOption{
+				MetricsPass: []string{"disk_used", "mem_used"},
+				RelabelConfigs: []*config.RelabelConfig{
+					{SourceLabels: model.LabelNames{"env"}, Regex: "(.+)", TargetLabel: "stage", Replacement: "stage-$1"},
+					{Regex: "env", Action: relabel.LabelDrop},
+				},
+			},
+			want: []string{"mem_used stage=stage-prod", "disk_used path=/ stage=stage-test"},
+		},
+		{
+			name: "relabel drops every label",
+			opt: config.WriterOption{
+				MetricsPass: []string{"net_*"},
+				RelabelConfigs: []*config.RelabelConfig{
+					{Regex: "__name__|interface", Action: relabel.LabelDrop},
+				},
+			},
+			want: []string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			items := make([]prompb.TimeSeries, 0, len(input))
+			for _, spec := range input {
+				items = append(items, filterSeries(spec))
+			}
+			f, err := newSeriesFilter(tt.opt)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if f == nil {
+				if len(tt.opt.MetricsPass)+len(tt.opt.MetricsDrop)+len(tt.opt.RelabelConfigs) > 0 {
+					t.Fatal("no filter built")
+				}
+			} else {
+				items = f.Apply(items)
+			}
+
+			got := make([]string, 0, len(items))
+			for _, ts := range items {
+				got = append(got, filterSpec(ts))
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSeriesFilterKeepsInput(t *testing.T) {
+	f, err := newSeriesFilter(config.WriterOption{RelabelConfigs: []*config.RelabelConfig{
+		{SourceLabels: model.LabelNames{"cpu"}, TargetLabel: "core"},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	items := []prompb.TimeSeries{filterSeries("cpu_usage_idle cpu=cpu0")}
+	got := f.Apply(items)
+	if filterSpec(got[0]) != "cpu_usage_idle core=cpu0 cpu=cpu0" {
+		t.Fatalf("unexpected relabeled series %s", filterSpec(got[0]))
+	}
+	// the series are shared with other writers
+	if filterSpec(items[0]) != "cpu_usage_idle cpu=cpu0" {
+		t.Fatalf("input series modified: %s", filterSpec(items[0]))
+	}
+}
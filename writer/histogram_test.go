@@ -0,0 +1,120 @@
+package writer
+
+import (
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/golang/snappy"
+	"github.com/prometheus/prometheus/prompb"
+	"go.opentelemetry.io/collector/pdata/pmetric"
+
+	"flashcat.cloud/categraf/config"
+	"flashcat.cloud/categraf/pkg/prom/writev2"
+)
+
+func histogramSeries() prompb.TimeSeries {
+	h := &writev2.Histogram{
+		Count: 4, Sum: 2.5, Schema: 0, ZeroCount: 1, Timestamp: 1000,
+		PositiveSpans:  []writev2.BucketSpan{{Offset: 1, Length: 2}},
+		PositiveDeltas: []int64{1, 1},
+	}
+	return prompb.TimeSeries{
+		Labels:           []prompb.Label{{Name: "__name__", Value: "rpc_latency_seconds"}, {Name: "ident", Value: "host-a"}},
+		XXX_unrecognized: h.AppendV1(nil),
+	}
+}
+
+func TestHistogramsThroughWriters(t *testing.T) {
+	config.Config = &config.ConfigType{}
+	config.HostInfo = &config.HostInfoCache{}
+
+	t.Run("otlp", func(t *testing.T) {
+		md := toMetrics([]prompb.TimeSeries{histogramSeries()}, newStartTimes())
+		m := md.ResourceMetrics().At(0).ScopeMetrics().At(0).Metrics().At(0)
+		if m.DataType() != pmetric.MetricDataTypeExponentialHistogram {
+			t.Fatalf("got data type %s", m.DataType())
+		}
+		dp := m.ExponentialHistogram().DataPoints().At(0)
+		counts := dp.Positive().MBucketCounts()
+		if dp.StartTimestamp() == 0 || dp.Count() != 4 || dp.Sum() != 2.5 || dp.ZeroCount() != 1 || dp.Positive().Offset() != 0 ||
+			len(counts) != 2 || counts[0] != 1 || counts[1] != 2 {
+			t.Fatalf("unexpected data point count=%d sum=%v offset=%d counts=%v", dp.Count(), dp.Sum(), dp.Positive().Offset(), counts)
+		}
+	})
+
+	t.Run("kafka prometheus", func(t *testing.T) {
+		k := &kafka{opt: config.WriterOption{Encoding: config.WriterEncodingPrometheus}}
+		w := newTestWriter(k, config.WriterOption{})
+		w.Enqueue([]prompb.TimeSeries{histogramSeries()})
+		items := <-w.batches
+		payload, _, err := k.encode(items)
+		if err != nil {
+			t.Fatal(err)
+		}
+		msgs, err := decodeKafkaPayload(payload)
+		if err != nil {
+			t.Fatal(err)
+		}
+		value, _ := msgs[0].Value.Encode()
+		data, err := snappy.Decode(nil, value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var req prompb.WriteRequest
+		if err := req.Unmarshal(data); err != nil {
+			t.Fatal(err)
+		}
+		if hs, err := writev2.ParseV1(req.Timeseries[0].XXX_unrecognized); err != nil || len(hs) != 1 || hs[0].Count != 4 {
+			t.Fatalf("histogram was not carried, got %v %v", hs, err)
+		}
+	})
+
+	t.Run("kafka json", func(t *testing.T) {
+		w := newTestWriter(&kafka{opt: config.WriterOption{Encoding: config.WriterEncodingJSON}}, config.WriterOption{})
+		w.Enqueue([]prompb.TimeSeries{histogramSeries()})
+		if len(w.batches) != 0 || atomic.LoadUint64(&w.droppedHistograms) != 1 {
+			t.Fatalf("expected the histogram to be dropped and counted, queued %d", len(w.batches))
+		}
+	})
+
+	t.Run("influx", func(t *testing.T) {
+		var requests int32
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&requests, 1)
+			w.WriteHeader(http.StatusNoContent)
+		}))
+		defer srv.Close()
+		opt := config.WriterOption{Url: srv.URL, Timeout: 5000, DialTimeout: 1000}
+		i, err := newInflux(opt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w := newTestWriter(i, opt)
+
+		w.Enqueue([]prompb.TimeSeries{histogramSeries()})
+		if len(w.batches) != 0 || atomic.LoadUint64(&w.droppedHistograms) != 1 {
+			t.Fatalf("expected the histogram to be dropped and counted, queued %d", len(w.batches))
+		}
+
+		// nothing left to send is not an error
+		if err := w.deliver(testSeries(math.NaN())); err != nil {
+			t.Fatalf("got %v", err)
+		}
+		if atomic.LoadInt32(&requests) != 0 {
+			t.Fatal("an empty payload was sent")
+		}
+	})
+
+	t.Run("exposition", func(t *testing.T) {
+		config.Config.HTTP = &config.HTTP{}
+		e := &exposition{series: make(map[string]*exposedSeries)}
+		h := histogramSeries()
+		e.store([]*prompb.TimeSeries{&h})
+		if len(e.series) != 0 || e.droppedHistograms != 1 {
+			t.Fatalf("expected the histogram to be dropped and counted, got %d series", len(e.series))
+		}
+	})
+}
@@ -0,0 +1,105 @@
+package writer
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"time"
+
+	"github.com/influxdata/line-protocol/v2/lineprotocol"
+	"github.com/prometheus/client_golang/api"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/prompb"
+
+	"flashcat.cloud/categraf/config"
+)
+
+// influx sends batches as line protocol to the /write endpoint of InfluxDB v1,
+// or /api/v2/write of v2. Every series becomes a line of measurement __name__
+// with field value, and the other labels as tags.
+type influx struct {
+	opt    config.WriterOption
+	client api.Client
+	url    string
+}
+
+func newInflux(opt config.WriterOption) (*influx, error) {
+	u, err := url.Parse(opt.Url)
+	if err != nil {
+		return nil, err
+	}
+	// timestamps of series are in milliseconds
+	q := u.Query()
+	if q.Get("precision") == "" {
+		q.Set("precision", "ms")
+		u.RawQuery = q.Encode()
+	}
+
+	cli, err := newHTTPClient(opt)
+	if err != nil {
+		return nil, err
+	}
+	return &influx{
+		opt:    opt,
+		client: cli,
+		url:    u.String(),
+	}, nil
+}
+
+func (i *influx) encode(items []prompb.TimeSeries) ([]byte, byte, error) {
+	var enc lineprotocol.Encoder
+	enc.SetPrecision(lineprotocol.Millisecond)
+
+	labels := make([]prompb.Label, 0, 16)
+	for n := range items {
+		labels = append(labels[:0], items[n].Labels...)
+		sort.Slice(labels, func(a, b int) bool { return labels[a].Name < labels[b].Name })
+		name := metricName(labels)
+
+		for _, s := range items[n].Samples {
+			value, ok := lineprotocol.FloatValue(s.Value)
+			if !ok {
+				// NaN and Inf are not allowed
+				continue
+			}
+			enc.StartLine(name)
+			for _, l := range labels {
+				if l.Name == model.MetricNameLabel || l.Value == "" {
+					continue
+				}
+				enc.AddTag(l.Name, l.Value)
+			}
+			enc.AddField("value", value)
+			enc.EndLine(time.UnixMilli(s.Timestamp))
+		}
+	}
+
+	// invalid lines are left out of the buffer
+	if err := enc.Err(); err != nil {
+		log.Println("W! encode line protocol for", i.opt.Url, "got error:", err)
+	}
+	// an empty payload is not sent
+	return enc.Bytes(), formatInflux, nil
+}
+
+// native histograms have no line protocol representation
+func (i *influx) sendsHistograms() bool {
+	return false
+}
+
+func (i *influx) send(payload []byte, format byte) error {
+	if format != formatInflux {
+		return &postError{StatusCode: http.StatusBadRequest, Err: fmt.Errorf("payload format %d is not line protocol", format)}
+	}
+
+	req, err := http.NewRequest("POST", i.url, bytes.NewReader(payload))
+	if err != nil {
+		return &postError{StatusCode: http.StatusBadRequest, Err: err}
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	req.Header.Set("User-Agent", "categraf")
+	return doHTTP(i.client, i.opt, req)
+}
@@ -0,0 +1,236 @@
+package writer
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/snappy"
+	"github.com/prometheus/prometheus/prompb"
+
+	"flashcat.cloud/categraf/config"
+)
+
+// kafka publishes batches to a topic, with one message per ident so that
+// the series of a host land in the same partition
+type kafka struct {
+	opt     config.WriterOption
+	brokers []string
+	cfg     *sarama.Config
+
+	sync.Mutex
+	// created on first send, the brokers may be down when the agent starts
+	producer sarama.SyncProducer
+}
+
+// kafkaSeries is a series of the json encoding
+type kafkaSeries struct {
+	Metric    string            `json:"metric"`
+	Labels    map[string]string `json:"labels"`
+	Value     float64           `json:"value"`
+	Timestamp int64             `json:"timestamp"`
+}
+
+func newKafka(opt config.WriterOption) (*kafka, error) {
+	if opt.Topic == "" {
+		return nil, errors.New("topic is required")
+	}
+	if opt.Encoding != config.WriterEncodingJSON && opt.Encoding != config.WriterEncodingPrometheus {
+		return nil, fmt.Errorf("unknown encoding %q", opt.Encoding)
+	}
+
+	cfg := sarama.NewConfig()
+	cfg.ClientID = "categraf"
+	cfg.Producer.Return.Successes = true
+	cfg.Producer.Partitioner = sarama.NewHashPartitioner
+	// retries are done by the writer
+	cfg.Producer.Retry.Max = 0
+	if opt.Timeout > 0 {
+		cfg.Producer.Timeout = time.Duration(opt.Timeout) * time.Millisecond
+	}
+	if opt.DialTimeout > 0 {
+		cfg.Net.DialTimeout = time.Duration(opt.DialTimeout) * time.Millisecond
+	}
+	if opt.KafkaVersion != "" {
+		v, err := sarama.ParseKafkaVersion(opt.KafkaVersion)
+		if err != nil {
+			return nil, err
+		}
+		cfg.Version = v
+	}
+	if opt.UseTLS {
+		tlsConfig, err := opt.TLSConfig()
+		if err != nil {
+			return nil, err
+		}
+		cfg.Net.TLS.Enable = true
+		cfg.Net.TLS.Config = tlsConfig
+	}
+	if opt.SaslUser != "" {
+		cfg.Net.SASL.Enable = true
+		cfg.Net.SASL.User = opt.SaslUser
+		cfg.Net.SASL.Password = opt.SaslPassword
+		if opt.SaslMechanism != "" {
+			cfg.Net.SASL.Mechanism = sarama.SASLMechanism(opt.SaslMechanism)
+		}
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	return &kafka{
+		opt:     opt,
+		brokers: strings.Split(opt.Url, ","),
+		cfg:     cfg,
+	}, nil
+}
+
+// seriesIdent returns the key of a series: label ident, or agent_hostname
+func seriesIdent(labels []prompb.Label) string {
+	var host string
+	for _, l := range labels {
+		switch l.Name {
+		case "ident":
+			return l.Value
+		case "agent_hostname":
+			host = l.Value
+		}
+	}
+	if host == "" {
+		host = config.Config.GetHostname()
+	}
+	return host
+}
+
+// encode groups items by ident and encodes every group as one message,
+// the payload is a sequence of uvarint length prefixed keys and values
+func (k *kafka) encode(items []prompb.TimeSeries) ([]byte, byte, error) {
+	groups := make(map[string][]prompb.TimeSeries)
+	var keys []string
+	for i := range items {
+		key := seriesIdent(items[i].Labels)
+		if _, has := groups[key]; !has {
+			keys = append(keys, key)
+		}
+		groups[key] = append(groups[key], items[i])
+	}
+
+	var payload []byte
+	for _, key := range keys {
+		value, err := k.encodeGroup(groups[key])
+		if err != nil {
+			return nil, formatKafka, err
+		}
+		if value == nil {
+			continue
+		}
+		payload = binary.AppendUvarint(payload, uint64(len(key)))
+		payload = append(payload, key...)
+		payload = binary.AppendUvarint(payload, uint64(len(value)))
+		payload = append(payload, value...)
+	}
+	return payload, formatKafka, nil
+}
+
+// native histograms are carried by the prometheus encoding only
+func (k *kafka) sendsHistograms() bool {
+	return k.opt.Encoding == config.WriterEncodingPrometheus
+}
+
+func (k *kafka) encodeGroup(items []prompb.TimeSeries) ([]byte, error) {
+	if k.opt.Encoding == config.WriterEncodingPrometheus {
+		data, err := proto.Marshal(&prompb.WriteRequest{Timeseries: items})
+		if err != nil {
+			return nil, err
+		}
+		return snappy.Encode(nil, data), nil
+	}
+
+	series := make([]kafkaSeries, 0, len(items))
+	for i := range items {
+		labels := make(map[string]string, len(items[i].Labels))
+		for _, l := range items[i].Labels {
+			labels[l.Name] = l.Value
+		}
+		name := metricName(items[i].Labels)
+		for _, s := range items[i].Samples {
+			// NaN and Inf, stale markers among them, are not valid json
+			if math.IsNaN(s.Value) || math.IsInf(s.Value, 0) {
+				continue
+			}
+			series = append(series, kafkaSeries{
+				Metric:    name,
+				Labels:    labels,
+				Value:     s.Value,
+				Timestamp: s.Timestamp,
+			})
+		}
+	}
+	if len(series) == 0 {
+		return nil, nil
+	}
+	return json.Marshal(series)
+}
+
+func decodeKafkaPayload(payload []byte) ([]*sarama.ProducerMessage, error) {
+	var msgs []*sarama.ProducerMessage
+	for len(payload) > 0 {
+		var fields [2][]byte
+		for i := range fields {
+			n, m := binary.Uvarint(payload)
+			if m <= 0 || uint64(len(payload)-m) < n {
+				return nil, errors.New("corrupted kafka payload")
+			}
+			fields[i] = payload[m : m+int(n)]
+			payload = payload[m+int(n):]
+		}
+		msgs = append(msgs, &sarama.ProducerMessage{
+			Key:   sarama.ByteEncoder(fields[0]),
+			Value: sarama.ByteEncoder(fields[1]),
+		})
+	}
+	return msgs, nil
+}
+
+func (k *kafka) send(payload []byte, format byte) error {
+	if format != formatKafka {
+		return &postError{StatusCode: http.StatusBadRequest, Err: fmt.Errorf("payload format %d is not kafka", format)}
+	}
+	msgs, err := decodeKafkaPayload(payload)
+	if err != nil {
+		return &postError{StatusCode: http.StatusBadRequest, Err: err}
+	}
+	for _, msg := range msgs {
+		msg.Topic = k.opt.Topic
+	}
+
+	k.Lock()
+	defer k.Unlock()
+	if k.producer == nil {
+		k.producer, err = sarama.NewSyncProducer(k.brokers, k.cfg)
+		if err != nil {
+			return &postError{Err: err}
+		}
+	}
+
+	err = k.producer.SendMessages(msgs)
+	if err == nil {
+		return nil
+	}
+	var perrs sarama.ProducerErrors
+	if errors.As(err, &perrs) && len(perrs) > 0 {
+		switch perrs[0].Err {
+		case sarama.ErrMessageSizeTooLarge, sarama.ErrInvalidMessage:
+			return &postError{StatusCode: http.StatusBadRequest, Err: err}
+		}
+	}
+	return &postError{Err: err}
+}
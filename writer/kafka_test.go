@@ -0,0 +1,90 @@
+package writer
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+
+	"github.com/prometheus/prometheus/prompb"
+
+	"flashcat.cloud/categraf/config"
+)
+
+func TestKafkaPayloadKeyedByIdent(t *testing.T) {
+	k := &kafka{opt: config.WriterOption{Encoding: config.WriterEncodingJSON}}
+	items := []prompb.TimeSeries{
+		{
+			Labels:  []prompb.Label{{Name: "__name__", Value: "cpu_usage_idle"}, {Name: "ident", Value: "host-a"}},
+			Samples: []prompb.Sample{{Value: 1, Timestamp: 1000}},
+		},
+		{
+			Labels:  []prompb.Label{{Name: "__name__", Value: "cpu_usage_idle"}, {Name: "ident", Value: "host-b"}},
+			Samples: []prompb.Sample{{Value: 2, Timestamp: 1000}},
+		},
+		{
+			Labels:  []prompb.Label{{Name: "__name__", Value: "mem_used"}, {Name: "ident", Value: "host-a"}},
+			Samples: []prompb.Sample{{Value: 3, Timestamp: 1000}},
+		},
+	}
+
+	payload, format, err := k.encode(items)
+	if err != nil || format != formatKafka {
+		t.Fatalf("encode: %v, format %d", err, format)
+	}
+	msgs, err := decodeKafkaPayload(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msgs) != 2 {
+		t.Fatalf("expected 2 messages, got %d", len(msgs))
+	}
+
+	key, _ := msgs[0].Key.Encode()
+	value, _ := msgs[0].Value.Encode()
+	var series []kafkaSeries
+	if err := json.Unmarshal(value, &series); err != nil {
+		t.Fatal(err)
+	}
+	if string(key) != "host-a" || len(series) != 2 || series[1].Metric != "mem_used" {
+		t.Fatalf("unexpected message %s: %s", key, value)
+	}
+}
+
+func TestKafkaJSONSkipsNonFinite(t *testing.T) {
+	k := &kafka{opt: config.WriterOption{Encoding: config.WriterEncodingJSON}}
+	items := []prompb.TimeSeries{
+		{
+			Labels: []prompb.Label{{Name: "__name__", Value: "cpu_usage_idle"}, {Name: "ident", Value: "host-a"}},
+			Samples: []prompb.Sample{
+				{Value: math.NaN(), Timestamp: 1000},
+				{Value: 1, Timestamp: 2000},
+				{Value: math.Inf(1), Timestamp: 3000},
+			},
+		},
+		{
+			// nothing left to send for host-b
+			Labels:  []prompb.Label{{Name: "__name__", Value: "cpu_usage_idle"}, {Name: "ident", Value: "host-b"}},
+			Samples: []prompb.Sample{{Value: math.Inf(-1), Timestamp: 1000}},
+		},
+	}
+
+	payload, _, err := k.encode(items)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msgs, err := decodeKafkaPayload(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msgs) != 1 {
+		t.Fatalf("expected 1 message, got %d", len(msgs))
+	}
+	value, _ := msgs[0].Value.Encode()
+	var series []kafkaSeries
+	if err := json.Unmarshal(value, &series); err != nil {
+		t.Fatal(err)
+	}
+	if len(series) != 1 || series[0].Value != 1 {
+		t.Fatalf("unexpected message: %s", value)
+	}
+}
@@ -0,0 +1,104 @@
+package writer
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/prometheus/prometheus/prompb"
+
+	"flashcat.cloud/categraf/pkg/prom/writev2"
+	"flashcat.cloud/categraf/types"
+)
+
+// metadata maps series names to the metadata of their family,
+// it is filled by WriteSamples from samples carrying types.Metadata
+var metadata sync.Map
+
+func recordMetadata(samples []*types.Sample) {
+	for _, s := range samples {
+		if s == nil || s.Meta == nil {
+			continue
+		}
+		if old, ok := metadata.Load(s.Metric); ok && old.(*types.Metadata) == s.Meta {
+			continue
+		}
+		metadata.Store(s.Metric, s.Meta)
+	}
+}
+
+func lookupMetadata(name string) *types.Metadata {
+	md, ok := metadata.Load(name)
+	if !ok {
+		return nil
+	}
+	return md.(*types.Metadata)
+}
+
+func metricType(t types.ValueType) writev2.MetricType {
+	switch t {
+	case types.Counter:
+		return writev2.MetricTypeCounter
+	case types.Gauge:
+		return writev2.MetricTypeGauge
+	case types.Histogram:
+		return writev2.MetricTypeHistogram
+	case types.Summary:
+		return writev2.MetricTypeSummary
+	default:
+		return writev2.MetricTypeUnspecified
+	}
+}
+
+// familyName strips the suffixes of histogram and summary series
+func familyName(name string, t types.ValueType) string {
+	if t != types.Histogram && t != types.Summary {
+		return name
+	}
+	for _, suffix := range []string{"_bucket", "_count", "_sum"} {
+		if strings.HasSuffix(name, suffix) {
+			return strings.TrimSuffix(name, suffix)
+		}
+	}
+	return name
+}
+
+// batchMetadata returns remote write 1.0 metadata of the families in a batch
+func batchMetadata(items []prompb.TimeSeries) []prompb.MetricMetadata {
+	var ret []prompb.MetricMetadata
+	seen := make(map[string]struct{})
+	for i := range items {
+		name := metricName(items[i].Labels)
+		md := lookupMetadata(name)
+		if md == nil {
+			continue
+		}
+		family := familyName(name, md.Type)
+		if _, has := seen[family]; has {
+			continue
+		}
+		seen[family] = struct{}{}
+		ret = append(ret, prompb.MetricMetadata{
+			Type:             prompb.MetricMetadata_MetricType(metricType(md.Type)),
+			MetricFamilyName: family,
+			Help:             md.Help,
+			Unit:             md.Unit,
+		})
+	}
+	return ret
+}
+
+func encodeV2(items []prompb.TimeSeries) []byte {
+	req := writev2.NewRequest()
+	for i := range items {
+		var md *writev2.Metadata
+		if m := lookupMetadata(metricName(items[i].Labels)); m != nil {
+			md = &writev2.Metadata{
+				Type: metricType(m.Type),
+				Help: m.Help,
+				Unit: m.Unit,
+			}
+		}
+		req.AddTimeSeries(&items[i], md)
+	}
+	return req.Marshal()
+}
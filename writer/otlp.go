@@ -0,0 +1,345 @@
+package writer
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/api"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/prompb"
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/pmetric"
+	"go.opentelemetry.io/collector/pdata/pmetric/pmetricotlp"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	grpcmd "google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"flashcat.cloud/categraf/config"
+	"flashcat.cloud/categraf/pkg/prom/writev2"
+	"flashcat.cloud/categraf/types"
+)
+
+const otlpScopeName = "categraf"
+
+// otlp sends batches to an OpenTelemetry collector, over OTLP/HTTP with
+// protobuf encoding, or OTLP/gRPC
+type otlp struct {
+	opt config.WriterOption
+
+	// otlp_http
+	client api.Client
+
+	// otlp_grpc
+	conn     *grpc.ClientConn
+	exporter pmetricotlp.Client
+
+	starts *startTimes
+}
+
+// forgotten when not seen for this long
+const startTimesTTL = time.Hour
+
+// startTimes remembers when cumulative series started, when they were first
+// seen or last reset, it is the start timestamp of their data points
+type startTimes struct {
+	sync.Mutex
+	series    map[string]*seriesStart
+	lastSweep time.Time
+}
+
+type seriesStart struct {
+	// unit: ms
+	start int64
+	value float64
+	seen  time.Time
+}
+
+func newStartTimes() *startTimes {
+	return &startTimes{series: make(map[string]*seriesStart)}
+}
+
+// get returns the start of the series with labels, of value at ts
+func (st *startTimes) get(labels []prompb.Label, ts int64, value float64) int64 {
+	sorted := make([]prompb.Label, len(labels))
+	copy(sorted, labels)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Name < sorted[j].Name })
+	key := seriesSignature(sorted)
+
+	now := time.Now()
+	st.Lock()
+	defer st.Unlock()
+	s, ok := st.series[key]
+	if !ok || value < s.value {
+		// a cumulative value going down was reset
+		s = &seriesStart{start: ts}
+		st.series[key] = s
+	}
+	s.value = value
+	s.seen = now
+
+	if now.Sub(st.lastSweep) > startTimesTTL {
+		for k, v := range st.series {
+			if now.Sub(v.seen) > startTimesTTL {
+				delete(st.series, k)
+			}
+		}
+		st.lastSweep = now
+	}
+	return s.start
+}
+
+// isCounter reports whether name is a cumulative counter, as declared by its
+// metadata or, without metadata, named with the _total suffix
+func isCounter(name string, meta *types.Metadata) bool {
+	if meta != nil {
+		return meta.Type == types.Counter
+	}
+	return strings.HasSuffix(name, "_total")
+}
+
+func newOTLP(opt config.WriterOption) (*otlp, error) {
+	o := &otlp{opt: opt, starts: newStartTimes()}
+
+	if opt.Format == config.WriterFormatOTLPHttp {
+		cli, err := newHTTPClient(opt)
+		if err != nil {
+			return nil, err
+		}
+		o.client = cli
+		return o, nil
+	}
+
+	// grpc targets are host:port, a scheme is accepted for symmetry with http
+	target := opt.Url
+	if strings.HasPrefix(target, "https://") {
+		opt.UseTLS = true
+	}
+	target = strings.TrimPrefix(strings.TrimPrefix(target, "http://"), "https://")
+
+	creds := insecure.NewCredentials()
+	if opt.UseTLS {
+		tlsConfig, err := opt.TLSConfig()
+		if err != nil {
+			return nil, err
+		}
+		creds = credentials.NewTLS(tlsConfig)
+	}
+
+	// dial does not block, connection errors show up on export
+	conn, err := grpc.Dial(target, grpc.WithTransportCredentials(creds), grpc.WithUserAgent("categraf"))
+	if err != nil {
+		return nil, err
+	}
+	o.conn = conn
+	o.exporter = pmetricotlp.NewClient(conn)
+	return o, nil
+}
+
+func (o *otlp) encode(items []prompb.TimeSeries) ([]byte, byte, error) {
+	data, err := pmetricotlp.NewRequestFromMetrics(toMetrics(items, o.starts)).MarshalProto()
+	return data, formatOTLP, err
+}
+
+// native histograms are sent as exponential histograms
+func (o *otlp) sendsHistograms() bool {
+	return true
+}
+
+func (o *otlp) send(payload []byte, format byte) error {
+	if format != formatOTLP {
+		return &postError{StatusCode: http.StatusBadRequest, Err: fmt.Errorf("payload format %d is not otlp", format)}
+	}
+
+	if o.conn == nil {
+		req, err := http.NewRequest("POST", o.opt.Url, bytes.NewReader(payload))
+		if err != nil {
+			return &postError{StatusCode: http.StatusBadRequest, Err: err}
+		}
+		req.Header.Set("Content-Type", "application/x-protobuf")
+		req.Header.Set("User-Agent", "categraf")
+		return doHTTP(o.client, o.opt, req)
+	}
+
+	req := pmetricotlp.NewRequest()
+	if err := req.UnmarshalProto(payload); err != nil {
+		return &postError{StatusCode: http.StatusBadRequest, Err: err}
+	}
+
+	ctx := context.Background()
+	if o.opt.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(o.opt.Timeout)*time.Millisecond)
+		defer cancel()
+	}
+	md := grpcmd.MD{}
+	for i := 0; i < len(o.opt.Headers); i += 2 {
+		md.Append(strings.ToLower(o.opt.Headers[i]), o.opt.Headers[i+1])
+	}
+	if o.opt.BasicAuthUser != "" {
+		r := &http.Request{Header: http.Header{}}
+		r.SetBasicAuth(o.opt.BasicAuthUser, o.opt.BasicAuthPass)
+		md.Set("authorization", r.Header.Get("Authorization"))
+	}
+	if len(md) > 0 {
+		ctx = grpcmd.NewOutgoingContext(ctx, md)
+	}
+
+	if _, err := o.exporter.Export(ctx, req); err != nil {
+		return grpcError(err)
+	}
+	return nil
+}
+
+// grpcError maps the status of a failed export to a postError, following
+// the retryable codes of the OTLP specification
+func grpcError(err error) error {
+	st := status.Convert(err)
+	perr := &postError{StatusCode: http.StatusBadRequest, Err: err}
+	switch st.Code() {
+	case codes.Canceled, codes.DeadlineExceeded, codes.Aborted, codes.OutOfRange, codes.Unavailable, codes.DataLoss:
+		perr.StatusCode = http.StatusServiceUnavailable
+	case codes.ResourceExhausted:
+		perr.StatusCode = http.StatusTooManyRequests
+	}
+	for _, d := range st.Details() {
+		if info, ok := d.(*errdetails.RetryInfo); ok && info.RetryDelay != nil {
+			perr.RetryAfter = info.RetryDelay.AsDuration()
+		}
+	}
+	return perr
+}
+
+// toMetrics converts series to OTLP data points of one resource, described
+// by the global labels and the hostname. Counters become monotonic cumulative
+// sums, native histograms exponential histograms and everything else gauges,
+// starts tracks the start timestamp of cumulative points.
+func toMetrics(items []prompb.TimeSeries, starts *startTimes) pmetric.Metrics {
+	md := pmetric.NewMetrics()
+	rm := md.ResourceMetrics().AppendEmpty()
+
+	resource := config.GlobalLabels()
+	attrs := rm.Resource().Attributes()
+	for k, v := range resource {
+		attrs.UpsertString(k, v)
+	}
+	hostname := config.Config.GetHostname()
+	attrs.UpsertString("host.name", hostname)
+
+	sm := rm.ScopeMetrics().AppendEmpty()
+	sm.Scope().SetName(otlpScopeName)
+	sm.Scope().SetVersion(config.Version)
+
+	setAttributes := func(attrs pcommon.Map, labels []prompb.Label) {
+		for _, l := range labels {
+			if l.Name == model.MetricNameLabel {
+				continue
+			}
+			// carried by the resource already
+			if v, ok := resource[l.Name]; ok && v == l.Value {
+				continue
+			}
+			if l.Name == "agent_hostname" && l.Value == hostname {
+				continue
+			}
+			attrs.UpsertString(l.Name, l.Value)
+		}
+	}
+
+	metrics := make(map[string]pmetric.Metric)
+	histograms := make(map[string]pmetric.Metric)
+	for i := range items {
+		name := metricName(items[i].Labels)
+		if len(items[i].Samples) == 0 {
+			hs, err := writev2.ParseV1(items[i].XXX_unrecognized)
+			if err != nil || len(hs) == 0 {
+				continue
+			}
+			m, has := histograms[name]
+			if !has {
+				m = sm.Metrics().AppendEmpty()
+				m.SetName(name)
+				m.SetDataType(pmetric.MetricDataTypeExponentialHistogram)
+				m.ExponentialHistogram().SetAggregationTemporality(pmetric.MetricAggregationTemporalityCumulative)
+				if meta := lookupMetadata(name); meta != nil {
+					m.SetDescription(meta.Help)
+					m.SetUnit(meta.Unit)
+				}
+				histograms[name] = m
+			}
+			for _, h := range hs {
+				dp := m.ExponentialHistogram().DataPoints().AppendEmpty()
+				setExponentialHistogram(dp, h)
+				start := starts.get(items[i].Labels, h.Timestamp, float64(h.Count))
+				dp.SetStartTimestamp(pcommon.Timestamp(start * int64(time.Millisecond)))
+				setAttributes(dp.Attributes(), items[i].Labels)
+			}
+			continue
+		}
+
+		m, has := metrics[name]
+		if !has {
+			m = sm.Metrics().AppendEmpty()
+			m.SetName(name)
+			m.SetDataType(pmetric.MetricDataTypeGauge)
+			meta := lookupMetadata(name)
+			if meta != nil {
+				m.SetDescription(meta.Help)
+				m.SetUnit(meta.Unit)
+			}
+			if isCounter(name, meta) {
+				m.SetDataType(pmetric.MetricDataTypeSum)
+				m.Sum().SetAggregationTemporality(pmetric.MetricAggregationTemporalityCumulative)
+				m.Sum().SetIsMonotonic(true)
+			}
+			metrics[name] = m
+		}
+
+		cumulative := m.DataType() == pmetric.MetricDataTypeSum
+		var points pmetric.NumberDataPointSlice
+		if cumulative {
+			points = m.Sum().DataPoints()
+		} else {
+			points = m.Gauge().DataPoints()
+		}
+		for _, s := range items[i].Samples {
+			dp := points.AppendEmpty()
+			dp.SetDoubleVal(s.Value)
+			dp.SetTimestamp(pcommon.Timestamp(s.Timestamp * int64(time.Millisecond)))
+			if cumulative {
+				start := starts.get(items[i].Labels, s.Timestamp, s.Value)
+				dp.SetStartTimestamp(pcommon.Timestamp(start * int64(time.Millisecond)))
+			}
+			setAttributes(dp.Attributes(), items[i].Labels)
+		}
+	}
+	return md
+}
+
+// setExponentialHistogram converts a native histogram, both share the scale
+// of buckets, bucket i of prometheus is (base^(i-1), base^i] when bucket i of
+// otlp is (base^i, base^(i+1)]
+func setExponentialHistogram(dp pmetric.ExponentialHistogramDataPoint, h *writev2.Histogram) {
+	dp.SetTimestamp(pcommon.Timestamp(h.Timestamp * int64(time.Millisecond)))
+	dp.SetCount(h.Count)
+	dp.SetSum(h.Sum)
+	dp.SetScale(h.Schema)
+	dp.SetZeroCount(h.ZeroCount)
+	if first, counts := writev2.BucketCounts(h.PositiveSpans, h.PositiveDeltas); len(counts) > 0 {
+		dp.Positive().SetOffset(first - 1)
+		dp.Positive().SetMBucketCounts(counts)
+	}
+	if first, counts := writev2.BucketCounts(h.NegativeSpans, h.NegativeDeltas); len(counts) > 0 {
+		dp.Negative().SetOffset(first - 1)
+		dp.Negative().SetMBucketCounts(counts)
+	}
+}
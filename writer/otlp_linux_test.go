@@ -0,0 +1,68 @@
+//go:build linux
+
+package writer
+
+import (
+	"testing"
+
+	"github.com/prometheus/prometheus/prompb"
+	"go.opentelemetry.io/collector/pdata/pmetric"
+
+	"flashcat.cloud/categraf/config"
+	"flashcat.cloud/categraf/inputs"
+	_ "flashcat.cloud/categraf/inputs/kernel"
+	"flashcat.cloud/categraf/types"
+)
+
+func TestOTLPTypesOfNativeInput(t *testing.T) {
+	config.Config = &config.ConfigType{}
+	config.HostInfo = &config.HostInfoCache{}
+
+	slist := types.NewSampleList()
+	inputs.InputCreators["kernel"]().(interface{ Gather(*types.SampleList) }).Gather(slist)
+	samples := slist.PopBackAll()
+	recordMetadata(samples)
+
+	var items []prompb.TimeSeries
+	for _, s := range samples {
+		items = append(items, *s.ConvertTimeSeries("ms"))
+	}
+	items = append(items, prompb.TimeSeries{
+		Labels:  []prompb.Label{{Name: "__name__", Value: "http_requests_total"}},
+		Samples: []prompb.Sample{{Value: 10, Timestamp: 1000}},
+	})
+
+	starts := newStartTimes()
+	ms := toMetrics(items, starts).ResourceMetrics().At(0).ScopeMetrics().At(0).Metrics()
+	got := make(map[string]pmetric.Metric)
+	for i := 0; i < ms.Len(); i++ {
+		got[ms.At(i).Name()] = ms.At(i)
+	}
+
+	for _, name := range []string{"kernel_context_switches", "http_requests_total"} {
+		m, ok := got[name]
+		if !ok {
+			t.Fatalf("%s not exported", name)
+		}
+		if m.DataType() != pmetric.MetricDataTypeSum || !m.Sum().IsMonotonic() ||
+			m.Sum().AggregationTemporality() != pmetric.MetricAggregationTemporalityCumulative {
+			t.Fatalf("%s exported as %s, want a monotonic cumulative sum", name, m.DataType())
+		}
+		dp := m.Sum().DataPoints().At(0)
+		if dp.StartTimestamp() == 0 || dp.StartTimestamp() > dp.Timestamp() {
+			t.Fatalf("%s start %d, timestamp %d", name, dp.StartTimestamp(), dp.Timestamp())
+		}
+	}
+	if m, ok := got["kernel_boot_time"]; !ok || m.DataType() != pmetric.MetricDataTypeGauge {
+		t.Fatal("kernel_boot_time should be a gauge")
+	}
+
+	// the start is kept while the counter grows, and moves when it is reset
+	labels := []prompb.Label{{Name: "__name__", Value: "http_requests_total"}}
+	if start := starts.get(labels, 2000, 20); start != 1000 {
+		t.Fatalf("start moved to %d while the counter grew", start)
+	}
+	if start := starts.get(labels, 3000, 5); start != 3000 {
+		t.Fatalf("start %d after a reset, want 3000", start)
+	}
+}
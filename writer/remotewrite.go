@@ -0,0 +1,164 @@
+package writer
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/snappy"
+	"github.com/prometheus/client_golang/api"
+	"github.com/prometheus/prometheus/prompb"
+
+	"flashcat.cloud/categraf/config"
+	"flashcat.cloud/categraf/pkg/prom/writev2"
+)
+
+// remoteWrite sends batches with prometheus remote write
+type remoteWrite struct {
+	opt    config.WriterOption
+	client api.Client
+
+	// negotiated remote write version, protoV1 or protoV2
+	protocol uint32
+}
+
+func newHTTPClient(opt config.WriterOption) (api.Client, error) {
+	tr := &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout: time.Duration(opt.DialTimeout) * time.Millisecond,
+		}).DialContext,
+		ResponseHeaderTimeout: time.Duration(opt.Timeout) * time.Millisecond,
+		MaxIdleConnsPerHost:   opt.MaxIdleConnsPerHost,
+	}
+	if opt.UseTLS || strings.HasPrefix(opt.Url, "https") {
+		opt.UseTLS = true
+		tlsConfig, err := opt.TLSConfig()
+		if err != nil {
+			return nil, err
+		}
+		tr.TLSClientConfig = tlsConfig
+	}
+	return api.NewClient(api.Config{
+		Address:      opt.Url,
+		RoundTripper: tr,
+	})
+}
+
+func newRemoteWrite(opt config.WriterOption) (*remoteWrite, error) {
+	cli, err := newHTTPClient(opt)
+	if err != nil {
+		return nil, err
+	}
+
+	rw := &remoteWrite{
+		opt:    opt,
+		client: cli,
+	}
+	switch opt.Protocol {
+	case config.WriterProtocolV1:
+		rw.protocol = uint32(protoV1)
+	case config.WriterProtocolV2, config.WriterProtocolAuto:
+		rw.protocol = uint32(protoV2)
+	default:
+		return nil, fmt.Errorf("unknown protocol %q", opt.Protocol)
+	}
+	return rw, nil
+}
+
+// encode marshals items with the negotiated remote write version
+func (rw *remoteWrite) encode(items []prompb.TimeSeries) ([]byte, byte, error) {
+	if byte(atomic.LoadUint32(&rw.protocol)) == protoV2 {
+		return snappy.Encode(nil, encodeV2(items)), protoV2, nil
+	}
+
+	req := &prompb.WriteRequest{
+		Timeseries: items,
+	}
+	if rw.opt.SendMetadata {
+		req.Metadata = batchMetadata(items)
+	}
+
+	data, err := proto.Marshal(req)
+	if err != nil {
+		return nil, protoV1, err
+	}
+	return snappy.Encode(nil, data), protoV1, nil
+}
+
+func (rw *remoteWrite) sendsHistograms() bool {
+	return true
+}
+
+// downgrade falls back to remote write 1.0 when a 2.0 request was refused by
+// a receiver speaking 1.0 only, in auto protocol
+func (rw *remoteWrite) downgrade(err error, format byte) bool {
+	if format != protoV2 || rw.opt.Protocol != config.WriterProtocolAuto {
+		return false
+	}
+	var perr *postError
+	if !errors.As(err, &perr) || perr.StatusCode != http.StatusUnsupportedMediaType {
+		return false
+	}
+	log.Println("I! writer", rw.opt.Url, "does not support remote write 2.0, fall back to 1.0")
+	atomic.StoreUint32(&rw.protocol, uint32(protoV1))
+	return true
+}
+
+func (rw *remoteWrite) send(req []byte, version byte) error {
+	httpReq, err := http.NewRequest("POST", rw.opt.Url, bytes.NewReader(req))
+	if err != nil {
+		log.Println("W! create remote write request got error:", err)
+		return &postError{StatusCode: http.StatusBadRequest, Err: err}
+	}
+
+	httpReq.Header.Add("Content-Encoding", "snappy")
+	httpReq.Header.Set("User-Agent", "categraf")
+	if version == protoV2 {
+		httpReq.Header.Set("Content-Type", writev2.ContentType)
+		httpReq.Header.Set("X-Prometheus-Remote-Write-Version", writev2.Version)
+	} else {
+		httpReq.Header.Set("Content-Type", "application/x-protobuf")
+		httpReq.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+	}
+
+	return doHTTP(rw.client, rw.opt, httpReq)
+}
+
+// doHTTP adds the headers and credentials of the writer to req and runs it
+func doHTTP(client api.Client, opt config.WriterOption, req *http.Request) error {
+	for i := 0; i < len(opt.Headers); i += 2 {
+		req.Header.Add(opt.Headers[i], opt.Headers[i+1])
+		if opt.Headers[i] == "Host" {
+			req.Host = opt.Headers[i+1]
+		}
+	}
+
+	if opt.BasicAuthUser != "" {
+		req.SetBasicAuth(opt.BasicAuthUser, opt.BasicAuthPass)
+	}
+
+	resp, body, err := client.Do(context.Background(), req)
+	if err != nil {
+		log.Println("W! push data to", opt.Url, "got error:", err, "response body:", string(body))
+		return &postError{Err: err}
+	}
+
+	if resp.StatusCode >= 400 {
+		return &postError{
+			StatusCode: resp.StatusCode,
+			RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After")),
+			Err:        fmt.Errorf("push data to %s got status code: %v, response body: %s", opt.Url, resp.StatusCode, string(body)),
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,117 @@
+package writer
+
+import (
+	"hash/fnv"
+	"sort"
+	"time"
+
+	"github.com/prometheus/prometheus/prompb"
+)
+
+// router decides which writers receive a batch, according to their mode
+type router struct {
+	broadcast []*Writer
+	shard     []*Writer
+	failover  []*Writer
+
+	shardLabels []string
+}
+
+func (r *router) route(timeSeries []prompb.TimeSeries) {
+	for _, w := range r.broadcast {
+		w.Enqueue(timeSeries)
+	}
+
+	if len(r.shard) > 0 {
+		r.routeShard(timeSeries)
+	}
+
+	if len(r.failover) > 0 {
+		r.activeFailover().Enqueue(timeSeries)
+	}
+}
+
+// routeShard splits series between shard writers with rendezvous hashing,
+// adding or removing a writer only moves the series owned by that writer
+func (r *router) routeShard(timeSeries []prompb.TimeSeries) {
+	if len(r.shard) == 1 {
+		r.shard[0].Enqueue(timeSeries)
+		return
+	}
+
+	parts := make([][]prompb.TimeSeries, len(r.shard))
+	for i := range timeSeries {
+		idx := r.shardOf(timeSeries[i].Labels)
+		parts[idx] = append(parts[idx], timeSeries[i])
+	}
+
+	for i, part := range parts {
+		if len(part) > 0 {
+			r.shard[i].Enqueue(part)
+		}
+	}
+}
+
+// shardOf returns the index of the shard writer owning the series, the one
+// scoring the highest for its key
+func (r *router) shardOf(labels []prompb.Label) int {
+	key := r.shardKey(labels)
+	idx := 0
+	var max uint64
+	for j, w := range r.shard {
+		h := fnv.New64a()
+		h.Write([]byte(w.Opts.Url))
+		h.Write([]byte{0})
+		h.Write(key)
+		if score := h.Sum64(); j == 0 || score > max {
+			idx, max = j, score
+		}
+	}
+	return idx
+}
+
+func (r *router) shardKey(labels []prompb.Label) []byte {
+	var key []byte
+	if len(r.shardLabels) == 0 {
+		sorted := make([]prompb.Label, len(labels))
+		copy(sorted, labels)
+		sort.Slice(sorted, func(i, j int) bool { return sorted[i].Name < sorted[j].Name })
+		for _, l := range sorted {
+			key = append(key, l.Name...)
+			key = append(key, '=')
+			key = append(key, l.Value...)
+			key = append(key, 0)
+		}
+		return key
+	}
+
+	for _, name := range r.shardLabels {
+		for _, l := range labels {
+			if l.Name == name {
+				key = append(key, l.Value...)
+				break
+			}
+		}
+		key = append(key, 0)
+	}
+	return key
+}
+
+// activeFailover returns the first writer whose circuit breaker lets requests
+// through, one whose cooldown expired included so that it gets its probe and
+// takes traffic back once recovered. If all of them are isolated, the one
+// recovering first is returned.
+func (r *router) activeFailover() *Writer {
+	next := r.failover[0]
+	var min time.Duration
+	for i, w := range r.failover {
+		remaining := w.breaker.Remaining()
+		if remaining == 0 {
+			return w
+		}
+		if i == 0 || remaining < min {
+			next, min = w, remaining
+		}
+	}
+	return next
+}
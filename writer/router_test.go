@@ -0,0 +1,145 @@
+package writer
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/prometheus/prometheus/prompb"
+
+	"flashcat.cloud/categraf/config"
+)
+
+func TestRouterFailback(t *testing.T) {
+	opt := config.WriterOption{BreakerThreshold: 1, BreakerCooldown: config.Duration(30 * time.Millisecond)}
+	primary := newTestWriter(&fakeSender{}, opt)
+	secondary := newTestWriter(&fakeSender{}, opt)
+	r := &router{failover: []*Writer{primary, secondary}}
+
+	r.route(testSeries(1))
+	if len(primary.batches) != 1 {
+		t.Fatal("healthy primary did not get the batch")
+	}
+
+	primary.breaker.Failure()
+	r.route(testSeries(2))
+	if len(secondary.batches) != 1 {
+		t.Fatal("batch did not fail over to the secondary")
+	}
+
+	// past the cooldown the primary gets the probe, and keeps the traffic
+	// once it succeeded
+	time.Sleep(40 * time.Millisecond)
+	r.route(testSeries(3))
+	if len(primary.batches) != 2 {
+		t.Fatal("primary did not get traffic back after its cooldown")
+	}
+	primary.breaker.Allow()
+	primary.breaker.Success()
+	r.route(testSeries(4))
+	if len(primary.batches) != 3 || len(secondary.batches) != 1 {
+		t.Fatal("traffic did not fail back to the primary")
+	}
+
+	// all isolated, the one recovering first is chosen
+	primary.breaker.Failure()
+	time.Sleep(10 * time.Millisecond)
+	secondary.breaker.Failure()
+	r.route(testSeries(5))
+	if len(primary.batches) != 4 {
+		t.Fatal("expected the writer recovering first")
+	}
+}
+
+func TestRouterShard(t *testing.T) {
+	newShards := func(n int) []*Writer {
+		ws := make([]*Writer, n)
+		for i := range ws {
+			ws[i] = newTestWriter(&fakeSender{}, config.WriterOption{Url: fmt.Sprintf("http://writer-%d", i)})
+		}
+		return ws
+	}
+	series := func(instance, path string) prompb.TimeSeries {
+		return prompb.TimeSeries{
+			Labels: []prompb.Label{
+				{Name: "__name__", Value: "disk_used"},
+				{Name: "instance", Value: instance},
+				{Name: "path", Value: path},
+			},
+			Samples: []prompb.Sample{{Value: 1, Timestamp: 1000}},
+		}
+	}
+
+	const instances = 2000
+	r := &router{shard: newShards(4), shardLabels: []string{"instance"}}
+	owners := make([]string, instances)
+	counts := make(map[string]int)
+	for i := 0; i < instances; i++ {
+		instance := fmt.Sprintf("host-%d", i)
+		owner := r.shard[r.shardOf(series(instance, "/").Labels)].Opts.Url
+		// labels out of shard_labels do not matter
+		if other := r.shard[r.shardOf(series(instance, "/data").Labels)].Opts.Url; other != owner {
+			t.Fatalf("%s sharded to %s and %s", instance, owner, other)
+		}
+		owners[i] = owner
+		counts[owner]++
+	}
+	for url, n := range counts {
+		if n < instances/4/2 || n > instances/4*2 {
+			t.Fatalf("unbalanced shards: %s got %d of %d", url, n, instances)
+		}
+	}
+
+	// a writer added only takes about 1/5 of the series, from every other
+	added := &router{shard: append(newShards(4), newTestWriter(&fakeSender{}, config.WriterOption{Url: "http://writer-new"})), shardLabels: r.shardLabels}
+	moved := 0
+	for i := 0; i < instances; i++ {
+		owner := added.shard[added.shardOf(series(fmt.Sprintf("host-%d", i), "/").Labels)].Opts.Url
+		if owner == owners[i] {
+			continue
+		}
+		if owner != "http://writer-new" {
+			t.Fatalf("host-%d moved from %s to %s", i, owners[i], owner)
+		}
+		moved++
+	}
+	if moved < instances/5/2 || moved > instances/5*2 {
+		t.Fatalf("%d of %d series moved to the new writer", moved, instances)
+	}
+
+	// a writer removed only gives away its own series
+	removed := &router{shard: newShards(4)[1:], shardLabels: r.shardLabels}
+	moved = 0
+	for i := 0; i < instances; i++ {
+		owner := removed.shard[removed.shardOf(series(fmt.Sprintf("host-%d", i), "/").Labels)].Opts.Url
+		if owner == owners[i] {
+			continue
+		}
+		if owners[i] != "http://writer-0" {
+			t.Fatalf("host-%d moved from %s to %s", i, owners[i], owner)
+		}
+		moved++
+	}
+	if moved != counts["http://writer-0"] {
+		t.Fatalf("%d series moved, writer-0 owned %d", moved, counts["http://writer-0"])
+	}
+
+	// routed batches follow the same owners
+	r.route([]prompb.TimeSeries{series("host-0", "/"), series("host-1", "/"), series("host-0", "/data")})
+	routed := 0
+	for _, w := range r.shard {
+		for len(w.batches) > 0 {
+			for _, ts := range <-w.batches {
+				i := 0
+				fmt.Sscanf(ts.Labels[1].Value, "host-%d", &i)
+				if owners[i] != w.Opts.Url {
+					t.Fatalf("%s routed to %s, owned by %s", ts.Labels[1].Value, w.Opts.Url, owners[i])
+				}
+				routed++
+			}
+		}
+	}
+	if routed != 3 {
+		t.Fatalf("%d of 3 series routed", routed)
+	}
+}
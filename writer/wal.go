@@ -0,0 +1,382 @@
+package writer
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"flashcat.cloud/categraf/config"
+)
+
+const (
+	walSegmentSuffix  = ".seg"
+	walCheckpointFile = "checkpoint"
+	// length(4) + crc32(4)
+	walRecordHeaderSize = 8
+)
+
+var errWalCorrupted = errors.New("wal record corrupted")
+
+// wal is a segmented on-disk queue of series batches. Records are appended
+// to the head segment, sealed once it reaches the segment size; the reader
+// consumes segments from the oldest one, the head included, and persists its
+// position in a checkpoint file, so pending records survive an agent restart.
+type wal struct {
+	sync.Mutex
+
+	dir         string
+	segmentSize int64
+	maxSize     int64
+	maxAge      time.Duration
+
+	// sealed segments, ascending
+	segments []uint64
+	sizes    map[uint64]int64
+
+	head     *os.File
+	headSeq  uint64
+	headSize int64
+
+	reader    *os.File
+	readerBuf *bufio.Reader
+	readSeq   uint64
+	readOff   int64
+	peeked    int64
+
+	size     int64
+	replayed uint64
+	dropped  uint64
+
+	// signaled on append, so the reader does not have to poll
+	ready chan struct{}
+}
+
+func openWAL(dir string, opt config.WalOpt) (*wal, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	w := &wal{
+		dir:         dir,
+		segmentSize: opt.SegmentSize * 1024 * 1024,
+		maxSize:     opt.MaxSize * 1024 * 1024,
+		maxAge:      time.Duration(opt.MaxAge),
+		sizes:       make(map[uint64]int64),
+		ready:       make(chan struct{}, 1),
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), walSegmentSuffix) {
+			continue
+		}
+		seq, err := strconv.ParseUint(strings.TrimSuffix(entry.Name(), walSegmentSuffix), 10, 64)
+		if err != nil {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil, err
+		}
+		w.segments = append(w.segments, seq)
+		w.sizes[seq] = info.Size()
+		w.size += info.Size()
+	}
+	sort.Slice(w.segments, func(i, j int) bool { return w.segments[i] < w.segments[j] })
+	if len(w.segments) > 0 {
+		w.headSeq = w.segments[len(w.segments)-1] + 1
+	}
+
+	w.readCheckpoint()
+	return w, nil
+}
+
+func (w *wal) segmentPath(seq uint64) string {
+	return filepath.Join(w.dir, fmt.Sprintf("%020d%s", seq, walSegmentSuffix))
+}
+
+func (w *wal) readCheckpoint() {
+	bs, err := os.ReadFile(filepath.Join(w.dir, walCheckpointFile))
+	if err != nil {
+		return
+	}
+	var seq uint64
+	var off int64
+	if _, err := fmt.Sscanf(string(bs), "%d %d", &seq, &off); err != nil {
+		log.Println("W! wal:", w.dir, "invalid checkpoint:", err)
+		return
+	}
+	if len(w.segments) > 0 && w.segments[0] == seq {
+		w.readSeq = seq
+		w.readOff = off
+	}
+}
+
+func (w *wal) writeCheckpoint() {
+	tmp := filepath.Join(w.dir, walCheckpointFile+".tmp")
+	data := []byte(fmt.Sprintf("%d %d", w.readSeq, w.readOff))
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		log.Println("W! wal:", w.dir, "write checkpoint error:", err)
+		return
+	}
+	if err := os.Rename(tmp, filepath.Join(w.dir, walCheckpointFile)); err != nil {
+		log.Println("W! wal:", w.dir, "rename checkpoint error:", err)
+	}
+}
+
+// Append writes one record to the head segment
+func (w *wal) Append(data []byte) error {
+	w.Lock()
+	defer w.Unlock()
+
+	if w.head == nil {
+		f, err := os.OpenFile(w.segmentPath(w.headSeq), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return err
+		}
+		w.head = f
+		w.headSize = 0
+	}
+
+	hdr := make([]byte, walRecordHeaderSize)
+	binary.BigEndian.PutUint32(hdr[0:4], uint32(len(data)))
+	binary.BigEndian.PutUint32(hdr[4:8], crc32.ChecksumIEEE(data))
+	if _, err := w.head.Write(append(hdr, data...)); err != nil {
+		return err
+	}
+
+	n := int64(walRecordHeaderSize + len(data))
+	w.headSize += n
+	w.size += n
+
+	if w.headSize >= w.segmentSize {
+		w.seal()
+	}
+	w.truncate()
+
+	select {
+	case w.ready <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// seal closes the head segment and hands it over to the reader
+func (w *wal) seal() {
+	if w.head == nil {
+		return
+	}
+	if err := w.head.Sync(); err != nil {
+		log.Println("W! wal:", w.dir, "sync segment error:", err)
+	}
+	w.head.Close()
+	w.head = nil
+	w.segments = append(w.segments, w.headSeq)
+	w.sizes[w.headSeq] = w.headSize
+	w.headSeq++
+	w.headSize = 0
+}
+
+// truncate drops the oldest sealed segments exceeding size and age limits
+func (w *wal) truncate() {
+	for len(w.segments) > 0 {
+		seq := w.segments[0]
+		expired := false
+		if w.maxAge > 0 {
+			if info, err := os.Stat(w.segmentPath(seq)); err == nil && time.Since(info.ModTime()) > w.maxAge {
+				expired = true
+			}
+		}
+		if !expired && (w.maxSize <= 0 || w.size <= w.maxSize) {
+			return
+		}
+		log.Println("W! wal:", w.dir, "drop segment", seq, "expired:", expired, "size:", w.size)
+		atomic.AddUint64(&w.dropped, 1)
+		w.removeSegment(seq)
+	}
+}
+
+func (w *wal) removeSegment(seq uint64) {
+	if len(w.segments) > 0 && w.segments[0] == seq {
+		w.segments = w.segments[1:]
+	}
+	w.size -= w.sizes[seq]
+	delete(w.sizes, seq)
+	if err := os.Remove(w.segmentPath(seq)); err != nil && !os.IsNotExist(err) {
+		log.Println("W! wal:", w.dir, "remove segment error:", err)
+	}
+	next := w.headSeq
+	if len(w.segments) > 0 {
+		next = w.segments[0]
+	}
+	w.resetReader(next)
+	w.writeCheckpoint()
+}
+
+// Peek returns the oldest pending record without consuming it,
+// io.EOF means the wal is empty.
+func (w *wal) Peek() ([]byte, error) {
+	w.Lock()
+	defer w.Unlock()
+
+	for len(w.segments) > 0 {
+		seq := w.segments[0]
+		data, err := w.readRecord(seq, w.sizes[seq])
+		if err == nil {
+			return data, nil
+		}
+		if err != io.EOF {
+			log.Println("W! wal:", w.dir, "segment", seq, "read error:", err, "skip the rest of it")
+		}
+		w.removeSegment(seq)
+	}
+	return w.peekHead()
+}
+
+// peekHead reads the head segment while it is still appended to, it is only
+// sealed once full, so a wal kept nearly empty keeps writing the same file
+func (w *wal) peekHead() ([]byte, error) {
+	if w.head == nil {
+		return nil, io.EOF
+	}
+	if w.readSeq != w.headSeq {
+		w.resetReader(w.headSeq)
+	}
+	if w.readOff >= w.headSize {
+		return nil, io.EOF
+	}
+	data, err := w.readRecord(w.headSeq, w.headSize)
+	if err == nil {
+		return data, nil
+	}
+	log.Println("W! wal:", w.dir, "segment", w.headSeq, "read error:", err, "skip the rest of it")
+	seq := w.headSeq
+	w.seal()
+	w.removeSegment(seq)
+	return nil, io.EOF
+}
+
+// resetReader moves the reader to the beginning of segment seq
+func (w *wal) resetReader(seq uint64) {
+	if w.reader != nil {
+		w.reader.Close()
+		w.reader = nil
+		w.readerBuf = nil
+	}
+	w.readSeq = seq
+	w.readOff = 0
+	w.peeked = 0
+}
+
+// readRecord reads the record at the read offset of segment seq, holding
+// size bytes
+func (w *wal) readRecord(seq uint64, size int64) ([]byte, error) {
+	if w.readSeq != seq {
+		w.resetReader(seq)
+	}
+	if w.reader == nil {
+		f, err := os.Open(w.segmentPath(seq))
+		if err != nil {
+			return nil, err
+		}
+		if _, err := f.Seek(w.readOff, io.SeekStart); err != nil {
+			f.Close()
+			return nil, err
+		}
+		w.reader = f
+		w.readerBuf = bufio.NewReader(f)
+		w.peeked = 0
+	}
+
+	if w.peeked > 0 {
+		// a previous Peek was not committed, rewind to it
+		if _, err := w.reader.Seek(w.readOff, io.SeekStart); err != nil {
+			return nil, err
+		}
+		w.readerBuf.Reset(w.reader)
+		w.peeked = 0
+	}
+
+	hdr := make([]byte, walRecordHeaderSize)
+	if _, err := io.ReadFull(w.readerBuf, hdr); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return nil, errWalCorrupted
+		}
+		return nil, err
+	}
+	length := binary.BigEndian.Uint32(hdr[0:4])
+	if int64(length) > size {
+		return nil, errWalCorrupted
+	}
+	data := make([]byte, length)
+	if _, err := io.ReadFull(w.readerBuf, data); err != nil {
+		return nil, errWalCorrupted
+	}
+	if crc32.ChecksumIEEE(data) != binary.BigEndian.Uint32(hdr[4:8]) {
+		return nil, errWalCorrupted
+	}
+	w.peeked = int64(walRecordHeaderSize) + int64(length)
+	return data, nil
+}
+
+// Commit consumes the record returned by the last Peek
+func (w *wal) Commit() {
+	w.Lock()
+	defer w.Unlock()
+
+	if w.peeked == 0 {
+		return
+	}
+	w.readOff += w.peeked
+	atomic.AddUint64(&w.replayed, uint64(w.peeked))
+	w.peeked = 0
+
+	if len(w.segments) > 0 && w.readSeq == w.segments[0] && w.readOff >= w.sizes[w.readSeq] {
+		w.removeSegment(w.segments[0])
+		return
+	}
+	w.writeCheckpoint()
+}
+
+// Size returns bytes buffered on disk
+func (w *wal) Size() int64 {
+	w.Lock()
+	defer w.Unlock()
+	return w.size
+}
+
+func (w *wal) Replayed() uint64 {
+	return atomic.LoadUint64(&w.replayed)
+}
+
+func (w *wal) Dropped() uint64 {
+	return atomic.LoadUint64(&w.dropped)
+}
+
+func (w *wal) Close() error {
+	w.Lock()
+	defer w.Unlock()
+	if w.reader != nil {
+		w.reader.Close()
+		w.reader = nil
+	}
+	if w.head != nil {
+		w.seal()
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+package writer
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"testing"
+
+	"flashcat.cloud/categraf/config"
+)
+
+func TestWALReplayAfterReopen(t *testing.T) {
+	dir := t.TempDir()
+	opt := config.WalOpt{SegmentSize: 1, MaxSize: 16}
+
+	w, err := openWAL(dir, opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		if err := w.Append([]byte(fmt.Sprintf("record-%d", i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	data, err := w.Peek()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "record-0" {
+		t.Fatalf("unexpected first record %q", data)
+	}
+	w.Commit()
+
+	// an uncommitted peek must be returned again
+	if data, _ = w.Peek(); string(data) != "record-1" {
+		t.Fatalf("unexpected second record %q", data)
+	}
+	w.Close()
+
+	w, err = openWAL(dir, opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i < 3; i++ {
+		data, err := w.Peek()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := fmt.Sprintf("record-%d", i); string(data) != want {
+			t.Fatalf("got %q, want %q", data, want)
+		}
+		w.Commit()
+	}
+	if _, err := w.Peek(); err != io.EOF {
+		t.Fatalf("expected empty wal, got %v", err)
+	}
+	if w.Size() != 0 {
+		t.Fatalf("expected no bytes buffered, got %d", w.Size())
+	}
+}
+
+func TestWALMaxSize(t *testing.T) {
+	w, err := openWAL(t.TempDir(), config.WalOpt{SegmentSize: 1, MaxSize: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	record := make([]byte, 600*1024)
+	for i := 0; i < 4; i++ {
+		if err := w.Append(record); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if w.Dropped() == 0 {
+		t.Fatal("expected oldest segments to be dropped")
+	}
+	if w.Size() > 1024*1024+int64(len(record))+walRecordHeaderSize {
+		t.Fatalf("wal exceeds its size cap: %d", w.Size())
+	}
+}
+
+func TestWALReadsHeadWithoutSealing(t *testing.T) {
+	dir := t.TempDir()
+	w, err := openWAL(dir, config.WalOpt{SegmentSize: 1, MaxSize: 16})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	for i := 0; i < 10; i++ {
+		if err := w.Append([]byte(fmt.Sprintf("record-%d", i))); err != nil {
+			t.Fatal(err)
+		}
+		data, err := w.Peek()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := fmt.Sprintf("record-%d", i); string(data) != want {
+			t.Fatalf("got %q, want %q", data, want)
+		}
+		w.Commit()
+		if _, err := w.Peek(); err != io.EOF {
+			t.Fatalf("expected nothing pending, got %v", err)
+		}
+	}
+
+	segments, _ := filepath.Glob(filepath.Join(dir, "*"+walSegmentSuffix))
+	if len(segments) != 1 {
+		t.Fatalf("expected a single segment, got %d", len(segments))
+	}
+}
@@ -1,115 +1,374 @@
 package writer
 
 import (
-	"bytes"
-	"context"
+	"errors"
 	"fmt"
+	"io"
 	"log"
-	"net"
 	"net/http"
+	"path/filepath"
+	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 
-	"github.com/golang/protobuf/proto"
 	"github.com/golang/snappy"
-	"github.com/prometheus/client_golang/api"
 	"github.com/prometheus/prometheus/prompb"
 
 	"flashcat.cloud/categraf/config"
+	"flashcat.cloud/categraf/pkg/backoff"
+)
+
+// formats of encoded payloads, also the first byte of wal records
+const (
+	// wal records holding series, encoded for the backend when sent
+	walSeries byte = 0
+
+	protoV1      byte = 1
+	protoV2      byte = 2
+	formatOTLP   byte = 3
+	formatKafka  byte = 4
+	formatInflux byte = 5
+)
+
+var (
+	walDirReplacer = strings.NewReplacer(":", "_", "/", "_", "?", "_", "&", "_", "=", "_")
+
+	errBreakerOpen = errors.New("circuit breaker is open")
 )
 
 type Writer struct {
-	Opts   config.WriterOption
-	Client api.Client
+	Opts config.WriterOption
+
+	sender  sender
+	batches chan []prompb.TimeSeries
+	filter  *seriesFilter
+	policy  backoff.Policy
+	breaker *breaker
+	wal     *wal
+
+	retried           uint64
+	dropped           uint64
+	droppedHistograms uint64
+}
+
+// sender encodes batches for one kind of backend and delivers them, the format
+// returned by encode is handed back to send
+type sender interface {
+	encode(items []prompb.TimeSeries) ([]byte, byte, error)
+	send(payload []byte, format byte) error
+}
+
+// histogramSender is implemented by senders able to encode native
+// histograms, they are dropped from the batches of the other ones
+type histogramSender interface {
+	sendsHistograms() bool
+}
+
+// downgrader is implemented by senders able to switch to an older encoding
+// when the backend refuses the current one, the batch is then encoded again
+type downgrader interface {
+	downgrade(err error, format byte) bool
+}
+
+// postError is returned by senders when the remote answered, or failed to answer,
+// in a way that tells whether the request is worth retrying
+type postError struct {
+	StatusCode int
+	RetryAfter time.Duration
+	Err        error
+}
+
+func (e *postError) Error() string {
+	return e.Err.Error()
+}
+
+// retryable reports whether err is caused by a network error, 5xx or 429
+func retryable(err error) bool {
+	var perr *postError
+	if !errors.As(err, &perr) {
+		return true
+	}
+	return perr.StatusCode == 0 || perr.StatusCode == http.StatusTooManyRequests || perr.StatusCode >= 500
 }
 
 // newWriter creates a new Writer from config.WriterOption
-func newWriter(opt config.WriterOption) (Writer, error) {
-	tr := &http.Transport{
-		Proxy: http.ProxyFromEnvironment,
-		DialContext: (&net.Dialer{
-			Timeout: time.Duration(opt.DialTimeout) * time.Millisecond,
-		}).DialContext,
-		ResponseHeaderTimeout: time.Duration(opt.Timeout) * time.Millisecond,
-		MaxIdleConnsPerHost:   opt.MaxIdleConnsPerHost,
-	}
-	if opt.UseTLS || strings.HasPrefix(opt.Url, "https") {
-		opt.UseTLS = true
-		tlsConfig, err := opt.TLSConfig()
-		if err != nil {
-			return Writer{}, err
-		}
-		tr.TLSClientConfig = tlsConfig
+func newWriter(opt config.WriterOption) (*Writer, error) {
+	w := &Writer{
+		Opts:    opt,
+		batches: make(chan []prompb.TimeSeries, opt.QueueSize),
+		policy: backoff.NewPolicy(2, time.Duration(opt.RetryBackoffBase).Seconds(),
+			time.Duration(opt.RetryBackoffMax).Seconds(), 1, false),
+		breaker: newBreaker(opt.BreakerThreshold, time.Duration(opt.BreakerCooldown)),
 	}
-	cli, err := api.NewClient(api.Config{
-		Address:      opt.Url,
-		RoundTripper: tr,
-	})
 
+	var err error
+	switch opt.Format {
+	case config.WriterFormatPrometheus:
+		w.sender, err = newRemoteWrite(opt)
+	case config.WriterFormatOTLPGrpc, config.WriterFormatOTLPHttp:
+		w.sender, err = newOTLP(opt)
+	case config.WriterFormatKafka:
+		w.sender, err = newKafka(opt)
+	case config.WriterFormatInflux:
+		w.sender, err = newInflux(opt)
+	default:
+		err = fmt.Errorf("unknown format %q", opt.Format)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("writer %s: %v", opt.Url, err)
+	}
+
+	w.filter, err = newSeriesFilter(opt)
 	if err != nil {
-		return Writer{}, err
+		return nil, fmt.Errorf("writer %s filters error: %v", opt.Url, err)
 	}
 
-	return Writer{
-		Opts:   opt,
-		Client: cli,
-	}, nil
+	if config.Config.WriterOpt.Wal.Enable {
+		dir := filepath.Join(config.Config.WriterOpt.Wal.Dir, walDirReplacer.Replace(opt.Url))
+		w.wal, err = openWAL(dir, config.Config.WriterOpt.Wal)
+		if err != nil {
+			return nil, fmt.Errorf("open wal of %s error: %v", opt.Url, err)
+		}
+	}
+
+	return w, nil
 }
 
-func (w Writer) Write(items []prompb.TimeSeries) {
+// Enqueue hands a batch over to the writer goroutine without blocking,
+// so a slow endpoint does not stall delivery to the others. With the wal
+// enabled, the batch is written ahead to it and sent from there in order.
+func (w *Writer) Enqueue(items []prompb.TimeSeries) {
+	if w.filter != nil {
+		items = w.filter.Apply(items)
+	}
+	if hs, ok := w.sender.(histogramSender); !ok || !hs.sendsHistograms() {
+		var n int
+		if items, n = withoutHistograms(items); n > 0 {
+			total := atomic.AddUint64(&w.droppedHistograms, uint64(n))
+			// logged on the first drop, then every 1000 series
+			if before := total - uint64(n); before == 0 || before/1000 != total/1000 {
+				log.Printf("W! writer %s can not send native histograms, %d series dropped", w.Opts.Url, total)
+			}
+		}
+	}
 	if len(items) == 0 {
 		return
 	}
 
-	req := &prompb.WriteRequest{
-		Timeseries: items,
+	if w.wal != nil {
+		w.spool(items)
+		return
 	}
 
-	data, err := proto.Marshal(req)
-	if err != nil {
-		log.Println("W! marshal prom data to proto got error:", err, "data:", items)
+	select {
+	case w.batches <- items:
+	default:
+		atomic.AddUint64(&w.dropped, uint64(len(items)))
+		log.Printf("E! queue of writer %s is full(%d), drop %d series", w.Opts.Url, cap(w.batches), len(items))
+	}
+}
+
+// withoutHistograms removes the series holding native histograms only, and
+// returns how many were removed
+func withoutHistograms(items []prompb.TimeSeries) ([]prompb.TimeSeries, int) {
+	n := 0
+	for i := range items {
+		if len(items[i].Samples) == 0 && len(items[i].XXX_unrecognized) > 0 {
+			n++
+		}
+	}
+	if n == 0 {
+		return items, 0
+	}
+	ret := make([]prompb.TimeSeries, 0, len(items)-n)
+	for i := range items {
+		if len(items[i].Samples) == 0 && len(items[i].XXX_unrecognized) > 0 {
+			continue
+		}
+		ret = append(ret, items[i])
+	}
+	return ret, n
+}
+
+// run writes the queued batches one by one, it never returns
+func (w *Writer) run() {
+	if w.wal != nil {
+		w.drain()
 		return
 	}
+	for items := range w.batches {
+		w.Write(items)
+	}
+}
 
-	if err := w.post(snappy.Encode(nil, data)); err != nil {
+func (w *Writer) Write(items []prompb.TimeSeries) {
+	if len(items) == 0 {
+		return
+	}
+
+	// wait for the probe of an isolated endpoint rather than dropping the
+	// batch, the following ones are held in the queue meanwhile
+	if d := w.breaker.Remaining(); d > 0 {
+		time.Sleep(d)
+	}
+
+	if err := w.deliver(items); err != nil {
 		log.Println("W! post to", w.Opts.Url, "got error:", err)
 		log.Println("W! example timeseries:", items[0].String())
+		atomic.AddUint64(&w.dropped, uint64(len(items)))
 	}
 }
 
-func (w Writer) post(req []byte) error {
-	httpReq, err := http.NewRequest("POST", w.Opts.Url, bytes.NewReader(req))
+// deliver encodes items for the backend and sends them, they are encoded
+// again if the sender downgraded its encoding
+func (w *Writer) deliver(items []prompb.TimeSeries) error {
+	payload, format, err := w.sender.encode(items)
 	if err != nil {
-		log.Println("W! create remote write request got error:", err)
-		return err
+		return &postError{StatusCode: http.StatusBadRequest, Err: fmt.Errorf("marshal prom data to proto got error: %v", err)}
+	}
+	if len(payload) == 0 {
+		// nothing the backend can take, e.g. NaN only for line protocol
+		return nil
 	}
 
-	httpReq.Header.Add("Content-Encoding", "snappy")
-	httpReq.Header.Set("Content-Type", "application/x-protobuf")
-	httpReq.Header.Set("User-Agent", "categraf")
-	httpReq.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
-
-	for i := 0; i < len(w.Opts.Headers); i += 2 {
-		httpReq.Header.Add(w.Opts.Headers[i], w.Opts.Headers[i+1])
-		if w.Opts.Headers[i] == "Host" {
-			httpReq.Host = w.Opts.Headers[i+1]
+	err = w.send(payload, format)
+	if d, ok := w.sender.(downgrader); ok && err != nil && d.downgrade(err, format) {
+		if payload, format, err = w.sender.encode(items); err == nil {
+			err = w.send(payload, format)
 		}
 	}
+	return err
+}
+
+// send delivers the payload, retrying with exponential backoff on retryable errors
+func (w *Writer) send(payload []byte, format byte) error {
+	var lastErr error
+	numErrors := 0
+	for attempt := 0; ; attempt++ {
+		if !w.breaker.Allow() {
+			if lastErr != nil {
+				return fmt.Errorf("%w, last error: %v", errBreakerOpen, lastErr)
+			}
+			return errBreakerOpen
+		}
 
-	if w.Opts.BasicAuthUser != "" {
-		httpReq.SetBasicAuth(w.Opts.BasicAuthUser, w.Opts.BasicAuthPass)
+		err := w.sender.send(payload, format)
+		if err == nil {
+			w.breaker.Success()
+			return nil
+		}
+		if !retryable(err) {
+			// the endpoint is alive, it is the payload being rejected
+			w.breaker.Success()
+			return err
+		}
+		lastErr = err
+		if w.breaker.Failure() {
+			log.Printf("E! circuit breaker of writer %s opened for %s, last error: %v", w.Opts.Url, time.Duration(w.Opts.BreakerCooldown), err)
+		}
+		if attempt >= w.Opts.MaxRetries {
+			return err
+		}
+
+		numErrors = w.policy.IncError(numErrors)
+		delay := w.policy.GetBackoffDuration(numErrors)
+		var perr *postError
+		if errors.As(err, &perr) && perr.RetryAfter > delay {
+			delay = perr.RetryAfter
+		}
+		// a large Retry-After would stall the writer
+		if max := time.Duration(w.Opts.RetryBackoffMax); max > 0 && delay > max {
+			delay = max
+		}
+		atomic.AddUint64(&w.retried, 1)
+		time.Sleep(delay)
 	}
+}
 
-	resp, body, err := w.Client.Do(context.Background(), httpReq)
+// spool appends items to the wal
+func (w *Writer) spool(items []prompb.TimeSeries) {
+	data, err := (&prompb.WriteRequest{Timeseries: items}).Marshal()
 	if err != nil {
-		log.Println("W! push data with remote write request got error:", err, "response body:", string(body))
-		return err
+		log.Println("E! marshal series for wal of", w.Opts.Url, "got error:", err)
+		return
+	}
+	record := make([]byte, 0, len(data)+1)
+	record = append(record, walSeries)
+	record = append(record, snappy.Encode(nil, data)...)
+	if err := w.wal.Append(record); err != nil {
+		atomic.AddUint64(&w.dropped, uint64(len(items)))
+		log.Println("E! append to wal of", w.Opts.Url, "got error:", err)
+	}
+}
+
+// drain sends the records of the wal in order, one at a time, a record is
+// only consumed once delivered or refused by the backend, so series written
+// while the backend is down queue up behind the backlog. It never returns.
+func (w *Writer) drain() {
+	interval := time.Duration(config.Config.WriterOpt.Wal.ReplayInterval)
+	for {
+		record, err := w.wal.Peek()
+		if err == io.EOF {
+			select {
+			case <-w.wal.ready:
+			case <-time.After(time.Second):
+			}
+			continue
+		}
+		if err != nil {
+			log.Println("E! read wal of", w.Opts.Url, "got error:", err)
+			time.Sleep(interval)
+			continue
+		}
+
+		count, err := w.sendRecord(record)
+		if err != nil {
+			if retryable(err) {
+				log.Println("W! send wal to", w.Opts.Url, "got error:", err)
+				time.Sleep(interval)
+				continue
+			}
+			log.Println("E! send wal to", w.Opts.Url, "got error:", err, "drop it")
+			atomic.AddUint64(&w.dropped, uint64(count))
+		}
+		w.wal.Commit()
 	}
+}
 
-	if resp.StatusCode >= 400 {
-		err = fmt.Errorf("push data with remote write request got status code: %v, response body: %s", resp.StatusCode, string(body))
-		return err
+// sendRecord sends one wal record and returns the number of series in it
+func (w *Writer) sendRecord(record []byte) (int, error) {
+	if len(record) < 2 {
+		return 0, nil
+	}
+	if record[0] != walSeries {
+		// payload spooled already encoded by a previous version
+		return 0, w.send(record[1:], record[0])
 	}
 
-	return nil
+	data, err := snappy.Decode(nil, record[1:])
+	if err != nil {
+		return 0, &postError{StatusCode: http.StatusBadRequest, Err: fmt.Errorf("decode wal record: %v", err)}
+	}
+	var req prompb.WriteRequest
+	if err := req.Unmarshal(data); err != nil {
+		return 0, &postError{StatusCode: http.StatusBadRequest, Err: fmt.Errorf("decode wal record: %v", err)}
+	}
+	return len(req.Timeseries), w.deliver(req.Timeseries)
+}
+
+// parseRetryAfter accepts both delay-seconds and HTTP-date forms
+func parseRetryAfter(v string) time.Duration {
+	if v == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(v); err == nil && secs > 0 {
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d
+		}
+	}
+	return 0
 }
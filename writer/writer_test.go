@@ -0,0 +1,205 @@
+package writer
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/prometheus/prompb"
+
+	"flashcat.cloud/categraf/config"
+	"flashcat.cloud/categraf/pkg/backoff"
+)
+
+// fakeSender records the first sample value of every batch it accepts
+type fakeSender struct {
+	sync.Mutex
+	status int
+	sent   []float64
+}
+
+func (f *fakeSender) encode(items []prompb.TimeSeries) ([]byte, byte, error) {
+	return []byte{byte(items[0].Samples[0].Value)}, protoV1, nil
+}
+
+func (f *fakeSender) send(payload []byte, format byte) error {
+	f.Lock()
+	defer f.Unlock()
+	if f.status != 0 {
+		return &postError{StatusCode: f.status, Err: http.ErrHandlerTimeout}
+	}
+	f.sent = append(f.sent, float64(payload[0]))
+	return nil
+}
+
+func (f *fakeSender) setStatus(status int) {
+	f.Lock()
+	f.status = status
+	f.Unlock()
+}
+
+func (f *fakeSender) sentValues() []float64 {
+	f.Lock()
+	defer f.Unlock()
+	return append([]float64(nil), f.sent...)
+}
+
+func newTestWriter(s sender, opt config.WriterOption) *Writer {
+	return &Writer{
+		Opts:    opt,
+		sender:  s,
+		batches: make(chan []prompb.TimeSeries, 10),
+		policy: backoff.NewPolicy(2, time.Duration(opt.RetryBackoffBase).Seconds(),
+			time.Duration(opt.RetryBackoffMax).Seconds(), 1, false),
+		breaker: newBreaker(opt.BreakerThreshold, time.Duration(opt.BreakerCooldown)),
+	}
+}
+
+func testSeries(v float64) []prompb.TimeSeries {
+	return []prompb.TimeSeries{{
+		Labels:  []prompb.Label{{Name: "__name__", Value: "test"}},
+		Samples: []prompb.Sample{{Value: v, Timestamp: 1000}},
+	}}
+}
+
+func TestWriterWalKeepsOrder(t *testing.T) {
+	config.Config = &config.ConfigType{}
+	config.Config.WriterOpt.Wal.ReplayInterval = config.Duration(10 * time.Millisecond)
+
+	f := &fakeSender{status: http.StatusServiceUnavailable}
+	w := newTestWriter(f, config.WriterOption{BreakerThreshold: 100, BreakerCooldown: config.Duration(time.Hour)})
+	var err error
+	if w.wal, err = openWAL(t.TempDir(), config.WalOpt{SegmentSize: 1, MaxSize: 16}); err != nil {
+		t.Fatal(err)
+	}
+	go w.run()
+
+	// written ahead while the backend is down
+	for i := 1; i <= 3; i++ {
+		w.Enqueue(testSeries(float64(i)))
+	}
+	time.Sleep(50 * time.Millisecond)
+	f.setStatus(0)
+	w.Enqueue(testSeries(4))
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(f.sentValues()) < 4 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	got := f.sentValues()
+	if len(got) != 4 {
+		t.Fatalf("got %v", got)
+	}
+	for i, v := range got {
+		if v != float64(i+1) {
+			t.Fatalf("series sent out of order: %v", got)
+		}
+	}
+}
+
+func TestWriterSendRetries(t *testing.T) {
+	cases := []struct {
+		name       string
+		status     int
+		retryAfter string
+		maxRetries int
+		threshold  int
+		requests   int32
+		retryable  bool
+		breaker    bool
+	}{
+		{name: "4xx is dropped", status: http.StatusBadRequest, maxRetries: 2, threshold: 10, requests: 1},
+		{name: "5xx is retried", status: http.StatusInternalServerError, maxRetries: 2, threshold: 10, requests: 3, retryable: true},
+		{name: "429 is retried", status: http.StatusTooManyRequests, maxRetries: 2, threshold: 10, requests: 3, retryable: true},
+		{name: "retry-after is capped", status: http.StatusTooManyRequests, retryAfter: "3600", maxRetries: 1, threshold: 10, requests: 2, retryable: true},
+		{name: "breaker opens", status: http.StatusServiceUnavailable, maxRetries: 5, threshold: 2, requests: 2, retryable: true, breaker: true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var requests int32
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				atomic.AddInt32(&requests, 1)
+				if c.retryAfter != "" {
+					w.Header().Set("Retry-After", c.retryAfter)
+				}
+				w.WriteHeader(c.status)
+			}))
+			defer srv.Close()
+
+			opt := config.WriterOption{
+				Url:              srv.URL,
+				Protocol:         config.WriterProtocolV1,
+				Timeout:          5000,
+				DialTimeout:      1000,
+				MaxRetries:       c.maxRetries,
+				RetryBackoffBase: config.Duration(time.Millisecond),
+				RetryBackoffMax:  config.Duration(20 * time.Millisecond),
+				BreakerThreshold: c.threshold,
+				BreakerCooldown:  config.Duration(time.Hour),
+			}
+			rw, err := newRemoteWrite(opt)
+			if err != nil {
+				t.Fatal(err)
+			}
+			w := newTestWriter(rw, opt)
+
+			begin := time.Now()
+			err = w.send([]byte("payload"), protoV1)
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+			if time.Since(begin) > time.Second {
+				t.Fatalf("send took %s", time.Since(begin))
+			}
+			if got := atomic.LoadInt32(&requests); got != c.requests {
+				t.Fatalf("got %d requests, want %d", got, c.requests)
+			}
+			if retryable(err) != c.retryable {
+				t.Fatalf("retryable(%v) = %v", err, !c.retryable)
+			}
+			if c.breaker {
+				if !errors.Is(err, errBreakerOpen) || !strings.Contains(err.Error(), "503") {
+					t.Fatalf("expected breaker error wrapping the last error, got %v", err)
+				}
+			}
+		})
+	}
+}
+
+func TestBreakerTransitions(t *testing.T) {
+	b := newBreaker(2, 20*time.Millisecond)
+	if b.Failure() || b.State() != breakerClosed {
+		t.Fatal("breaker opened before threshold")
+	}
+	if !b.Failure() || b.State() != breakerOpen {
+		t.Fatal("breaker did not open at threshold")
+	}
+	if b.Allow() {
+		t.Fatal("open breaker allowed a request")
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	if !b.Allow() || b.State() != breakerHalfOpen {
+		t.Fatal("breaker did not let a probe through after cooldown")
+	}
+	if b.Allow() {
+		t.Fatal("half-open breaker allowed a second probe")
+	}
+	// a failed probe opens it again
+	if !b.Failure() || b.State() != breakerOpen {
+		t.Fatal("failed probe did not open the breaker")
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	b.Allow()
+	b.Success()
+	if b.State() != breakerClosed || !b.Allow() {
+		t.Fatal("successful probe did not close the breaker")
+	}
+}
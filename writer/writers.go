@@ -6,6 +6,7 @@ import (
 	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/prometheus/prometheus/prompb"
@@ -17,7 +18,8 @@ import (
 // Writers manage all writers and metric queue
 type (
 	Writers struct {
-		writerMap map[string]Writer
+		writerMap map[string]*Writer
+		router    *router
 		queue     *types.SafeListLimited[*prompb.TimeSeries]
 		sync.Mutex
 
@@ -31,12 +33,29 @@ type (
 
 		QueueSize uint64
 	}
+
+	WriterSnapshot struct {
+		Url               string
+		QueueSize         int
+		RetriedCount      uint64
+		DroppedSeries     uint64
+		DroppedHistograms uint64
+		BreakerOpen       bool
+
+		Wal             bool
+		BufferedBytes   int64
+		ReplayedBytes   uint64
+		DroppedSegments uint64
+	}
 )
 
 var writers *Writers
 
 func InitWriters() error {
-	writerMap := map[string]Writer{}
+	writerMap := map[string]*Writer{}
+	r := &router{
+		shardLabels: config.Config.WriterOpt.ShardLabels,
+	}
 	opts := config.Config.Writers
 	for _, opt := range opts {
 		writer, err := newWriter(opt)
@@ -44,17 +63,46 @@ func InitWriters() error {
 			return err
 		}
 		writerMap[opt.Url] = writer
+
+		switch opt.Mode {
+		case config.WriterModeBroadcast:
+			r.broadcast = append(r.broadcast, writer)
+		case config.WriterModeShard:
+			r.shard = append(r.shard, writer)
+		case config.WriterModeFailover:
+			r.failover = append(r.failover, writer)
+		default:
+			return fmt.Errorf("writer %s: unknown mode %q", opt.Url, opt.Mode)
+		}
 	}
 
 	writers = &Writers{
 		writerMap: writerMap,
+		router:    r,
 		queue:     types.NewSafeListLimited[*prompb.TimeSeries](config.Config.WriterOpt.ChanSize),
 	}
 
+	for _, w := range writerMap {
+		go w.run()
+	}
+
 	go writers.LoopRead()
 	return nil
 }
 
+// CloseWriters seals the wal of every writer, series written ahead to it
+// are sent after restart
+func CloseWriters() {
+	if writers == nil {
+		return
+	}
+	for _, w := range writers.writerMap {
+		if w.wal != nil {
+			w.wal.Close()
+		}
+	}
+}
+
 func (ws *Writers) LoopRead() {
 	for {
 		series := ws.queue.PopBackN(config.Config.WriterOpt.Batch)
@@ -81,10 +129,12 @@ func WriteSamples(samples []*types.Sample) {
 		printTestMetrics(samples)
 		return
 	}
-	if config.Config.DebugMode {
+	if config.DebugMode() {
 		printTestMetrics(samples)
 	}
 
+	recordMetadata(samples)
+
 	items := make([]*prompb.TimeSeries, 0, len(samples))
 	for _, sample := range samples {
 		item := sample.ConvertTimeSeries(config.Config.Global.Precision)
@@ -93,6 +143,16 @@ func WriteSamples(samples []*types.Sample) {
 		}
 		items = append(items, item)
 	}
+	if ExposeEnabled() {
+		exposed.store(items)
+	}
+	if config.Config.WriterOpt.Wal.Enable {
+		// written ahead to the wal of the writers right away, nothing is
+		// held in memory to be lost
+		writeAhead(items)
+		go snapshot(uint64(len(items)), 0, true)
+		return
+	}
 	success := writers.queue.PushFrontN(items)
 	l := writers.queue.Len()
 	if !success {
@@ -101,6 +161,24 @@ func WriteSamples(samples []*types.Sample) {
 	go snapshot(uint64(len(items)), uint64(l), success)
 }
 
+// writeAhead routes items to the writers in batches, they append them to
+// their wal
+func writeAhead(items []*prompb.TimeSeries) {
+	batch := config.Config.WriterOpt.Batch
+	for len(items) > 0 {
+		n := len(items)
+		if batch > 0 && n > batch {
+			n = batch
+		}
+		series := make([]prompb.TimeSeries, n)
+		for i := 0; i < n; i++ {
+			series[i] = *items[i]
+		}
+		WriteTimeSeries(series)
+		items = items[n:]
+	}
+}
+
 func snapshot(count, size uint64, success bool) {
 	writers.Lock()
 	defer writers.Unlock()
@@ -119,21 +197,37 @@ func QueueMetrics() *Snapshot {
 	return &ss
 }
 
-// WriteTimeSeries write prompb.TimeSeries to all writers
+// WriterMetrics returns the delivery state of every writer
+func WriterMetrics() []WriterSnapshot {
+	ret := make([]WriterSnapshot, 0, len(writers.writerMap))
+	for url, w := range writers.writerMap {
+		ws := WriterSnapshot{
+			Url:               url,
+			QueueSize:         len(w.batches),
+			RetriedCount:      atomic.LoadUint64(&w.retried),
+			DroppedSeries:     atomic.LoadUint64(&w.dropped),
+			DroppedHistograms: atomic.LoadUint64(&w.droppedHistograms),
+			BreakerOpen:       w.breaker.State() != breakerClosed,
+		}
+		if w.wal != nil {
+			ws.Wal = true
+			ws.BufferedBytes = w.wal.Size()
+			ws.ReplayedBytes = w.wal.Replayed()
+			ws.DroppedSegments = w.wal.Dropped()
+		}
+		ret = append(ret, ws)
+	}
+	return ret
+}
+
+// WriteTimeSeries hands prompb.TimeSeries over to the queue of writers,
+// routed according to their mode
 func WriteTimeSeries(timeSeries []prompb.TimeSeries) {
 	if len(timeSeries) == 0 {
 		return
 	}
 
-	wg := sync.WaitGroup{}
-	for key := range writers.writerMap {
-		wg.Add(1)
-		go func(key string) {
-			defer wg.Done()
-			writers.writerMap[key].Write(timeSeries)
-		}(key)
-	}
-	wg.Wait()
+	writers.router.route(timeSeries)
 }
 
 func printTestMetrics(samples []*types.Sample) {
@@ -163,7 +257,34 @@ func printTestMetric(sample *types.Sample) {
 	}
 
 	sb.WriteString(" ")
-	sb.WriteString(fmt.Sprint(sample.Value))
+	if sample.Histogram != nil {
+		sb.WriteString(fmt.Sprintf("histogram(count=%d,sum=%v)", sample.Histogram.GetSampleCount(), sample.Histogram.GetSampleSum()))
+	} else {
+		sb.WriteString(fmt.Sprint(sample.Value))
+	}
 
 	fmt.Println(sb.String())
 }
+
+// CheckWriters validates format, mode and filters of the configured writers
+// without connecting to them
+func CheckWriters() []string {
+	var problems []string
+	for _, opt := range config.Config.Writers {
+		switch opt.Format {
+		case config.WriterFormatPrometheus, config.WriterFormatOTLPGrpc, config.WriterFormatOTLPHttp,
+			config.WriterFormatKafka, config.WriterFormatInflux:
+		default:
+			problems = append(problems, fmt.Sprintf("writer %s: unknown format %q", opt.Url, opt.Format))
+		}
+		switch opt.Mode {
+		case config.WriterModeBroadcast, config.WriterModeShard, config.WriterModeFailover:
+		default:
+			problems = append(problems, fmt.Sprintf("writer %s: unknown mode %q", opt.Url, opt.Mode))
+		}
+		if _, err := newSeriesFilter(opt); err != nil {
+			problems = append(problems, fmt.Sprintf("writer %s filters error: %v", opt.Url, err))
+		}
+	}
+	return problems
+}